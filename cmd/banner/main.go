@@ -2,12 +2,141 @@ package main
 
 import (
 	"banner/internal/app"
+	"banner/internal/config"
 	logerr "banner/internal/lib/logger/logerr"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 )
 
+const usage = `Usage:
+  banner [-config path]                 start the server
+  banner config check [-config path]    print the effective config and validate it
+  banner snapshot export [-config path] [-o file]
+                                        write features, tags and banners to an archive
+                                        (stdout by default)
+  banner snapshot import [-config path] [-dry-run] file
+                                        replace them with the archive, keeping its IDs;
+                                        -dry-run only prints the changes
+
+The config path defaults to $CONFIG_PATH, then ./config/config.yaml.
+`
+
 func main() {
-	if err := app.Run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
 		log.Fatalf("Failed to start server %v", logerr.Err(err))
 	}
 }
+
+func run(args []string) error {
+	if len(args) >= 2 && args[0] == "config" && args[1] == "check" {
+		configPath, err := parseFlags("config check", args[2:])
+		if err != nil {
+			return err
+		}
+
+		if err := app.ConfigCheck(configPath, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	if len(args) >= 2 && args[0] == "snapshot" {
+		if err := runSnapshot(args[1], args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	configPath, err := parseFlags("banner", args)
+	if err != nil {
+		return err
+	}
+
+	return app.Run(configPath)
+}
+
+func parseFlags(name string, args []string) (string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	configPath := flags.String("config", "", "path to the config file")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		return "", err
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return "", fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	return config.ResolvePath(*configPath), nil
+}
+
+func runSnapshot(command string, args []string) error {
+	flags := flag.NewFlagSet("snapshot "+command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	configPath := flags.String("config", "", "path to the config file")
+
+	switch command {
+	case "export":
+		output := flags.String("o", "", "archive file, stdout if empty")
+		if err := parseSnapshotFlags(flags, args, 0); err != nil {
+			return err
+		}
+
+		if *output == "" {
+			return app.SnapshotExport(config.ResolvePath(*configPath), os.Stdout)
+		}
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		if err := app.SnapshotExport(config.ResolvePath(*configPath), file); err != nil {
+			file.Close()
+			os.Remove(*output)
+			return err
+		}
+		return file.Close()
+
+	case "import":
+		dryRun := flags.Bool("dry-run", false, "print the changes without importing")
+		if err := parseSnapshotFlags(flags, args, 1); err != nil {
+			return err
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return app.SnapshotImport(config.ResolvePath(*configPath), file, *dryRun, os.Stdout)
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown snapshot command %q", command)
+	}
+}
+
+func parseSnapshotFlags(flags *flag.FlagSet, args []string, nArgs int) error {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		return err
+	}
+
+	if flags.NArg() != nArgs {
+		flags.Usage()
+		return fmt.Errorf("expected %d arguments, got %v", nArgs, flags.Args())
+	}
+
+	return nil
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"banner/pkg/client"
+)
+
+func bannerCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError("banner: missing subcommand")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listBanners(ctx, c, args[1:], out)
+	case "get":
+		return getBanner(ctx, c, args[1:], out)
+	case "create":
+		return createBanner(ctx, c, args[1:], out)
+	case "update":
+		return updateBanner(ctx, c, args[1:], out)
+	case "edit":
+		return editBanner(ctx, c, args[1:], out)
+	case "draft":
+		return getBannerDraft(ctx, c, args[1:], out)
+	case "publish":
+		return publishBanner(ctx, c, args[1:], out)
+	case "discard":
+		return discardBannerDraft(ctx, c, args[1:], out)
+	case "submit":
+		return submitBanner(ctx, c, args[1:], out)
+	case "delete":
+		return deleteBanner(ctx, c, args[1:], out)
+	case "trash":
+		return listTrash(ctx, c, args[1:], out)
+	case "restore":
+		return restoreBanner(ctx, c, args[1:], out)
+	case "clone":
+		return cloneBanner(ctx, c, args[1:], out)
+	}
+
+	return usageError("banner: unknown subcommand %q", args[0])
+}
+
+func listBanners(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	var (
+		features, tags intList
+		active         optionalBool
+	)
+	flags := newFlagSet("banner list")
+	flags.Var(&features, "feature", "feature IDs, comma-separated")
+	flags.Var(&tags, "tag", "tag IDs, comma-separated")
+	flags.Var(&active, "active", "only active or inactive banners")
+	query := flags.String("q", "", "full-text search over the content")
+	path := flags.String("path", "", "JSONPath predicate over the content")
+	sort := flags.String("sort", "", "sort by id, created_at or updated_at")
+	order := flags.String("order", "", "asc or desc")
+	limit := flags.Int("limit", 0, "page size")
+	cursor := flags.String("cursor", "", "cursor of the page to list")
+	all := flags.Bool("all", false, "list every page")
+	output := outputFlag(flags)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	opts := client.ListOptions{
+		FeatureIDs: features,
+		TagIDs:     tags,
+		IsActive:   active.value,
+		Sort:       *sort,
+		Order:      *order,
+		Limit:      *limit,
+		Cursor:     *cursor,
+	}
+
+	var banners []client.Banner
+	for {
+		var (
+			page *client.BannerPage
+			err  error
+		)
+		if *query != "" || *path != "" {
+			page, err = c.SearchBanners(ctx, client.SearchOptions{Query: *query, Path: *path, ListOptions: opts})
+		} else {
+			page, err = c.ListBanners(ctx, opts)
+		}
+		if err != nil {
+			return err
+		}
+
+		banners = append(banners, page.Items...)
+		if !*all || page.NextCursor == "" {
+			if !*all && page.NextCursor != "" && *output == outputTable {
+				defer fmt.Fprintf(out, "\nnext page: -cursor %s\n", page.NextCursor)
+			}
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	return printBanners(out, *output, banners)
+}
+
+func getBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner get")
+	output := outputFlag(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	banner, err := c.GetBanner(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printBanner(out, *output, banner)
+}
+
+// contentFlags are the -content and -content-file flags of create and
+// update.
+type contentFlags struct {
+	inline *string
+	file   *string
+}
+
+func newContentFlags(flags *flag.FlagSet) contentFlags {
+	return contentFlags{
+		inline: flags.String("content", "", "content as a JSON object"),
+		file:   flags.String("content-file", "", "file with the content as a JSON object, - for stdin"),
+	}
+}
+
+// content returns the content given by the flags, or nil if none was given.
+func (f contentFlags) content() (map[string]any, error) {
+	var data []byte
+	switch {
+	case *f.inline != "" && *f.file != "":
+		return nil, errors.New("-content and -content-file are exclusive")
+	case *f.inline != "":
+		data = []byte(*f.inline)
+	case *f.file == "-":
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
+		}
+	case *f.file != "":
+		var err error
+		if data, err = os.ReadFile(*f.file); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	return parseContent(data)
+}
+
+func parseContent(data []byte) (map[string]any, error) {
+	var content map[string]any
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("invalid content: %w", err)
+	}
+	if content == nil {
+		return nil, errors.New("invalid content: not a JSON object")
+	}
+
+	return content, nil
+}
+
+// parseLocales parses the -locales flag, a JSON object of content by
+// language, or returns nil if it is empty.
+func parseLocales(data string) (map[string]map[string]any, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var locales map[string]map[string]any
+	if err := json.Unmarshal([]byte(data), &locales); err != nil {
+		return nil, fmt.Errorf("invalid locales: %w", err)
+	}
+
+	return locales, nil
+}
+
+func parseTemplate(data string) (*client.BannerTemplate, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var template client.BannerTemplate
+	if err := json.Unmarshal([]byte(data), &template); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return &template, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func createBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	var tags intList
+	flags := newFlagSet("banner create")
+	feature := flags.Int("feature", 0, "feature ID")
+	flags.Var(&tags, "tags", "tag IDs, comma-separated")
+	active := flags.Bool("active", true, "whether users see the banner")
+	defaultLocale := flags.String("default-locale", "", "language of the content, a BCP 47 tag")
+	localesFlag := flags.String("locales", "", `content in other languages as a JSON object, {"en": {...}}`)
+	platforms := flags.String("platforms", "", "platforms the banner is for, comma-separated: ios, android, web")
+	appVersion := flags.String("app-version", "", `app versions the banner is for, e.g. ">=7.2 <8"`)
+	targetingRule := flags.String("rule", "", `users the banner is for, e.g. 'country == "KZ"'`)
+	templateFlag := flags.String("template", "", `placeholder settings as a JSON object, {"variables": ["name"]}`)
+	contentFlags := newContentFlags(flags)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	locales, err := parseLocales(*localesFlag)
+	if err != nil {
+		return err
+	}
+	template, err := parseTemplate(*templateFlag)
+	if err != nil {
+		return err
+	}
+
+	content, err := contentFlags.content()
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		return usageError("banner create: -content or -content-file is required")
+	}
+
+	banner, err := c.CreateBanner(ctx, client.NewBanner{
+		TagIDs:    tags,
+		FeatureID: *feature,
+		Content:   content,
+		IsActive:  *active,
+
+		DefaultLocale: *defaultLocale,
+		Locales:       locales,
+		Platforms:     splitList(*platforms),
+		AppVersion:    *appVersion,
+		Rule:          *targetingRule,
+		Template:      template,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created banner %d\n", banner.ID)
+
+	return nil
+}
+
+func updateBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	var (
+		tags   intList
+		active optionalBool
+	)
+	flags := newFlagSet("banner update")
+	feature := flags.Int("feature", 0, "feature ID")
+	flags.Var(&tags, "tags", "tag IDs, comma-separated, replacing the current ones")
+	flags.Var(&active, "active", "whether users see the banner")
+	version := flags.Int64("version", 0, "version the update is based on, the current one by default")
+	defaultLocale := flags.String("default-locale", "", "language of the content, a BCP 47 tag")
+	localesFlag := flags.String("locales", "", "content in other languages as a JSON object, replacing the current ones")
+	platforms := flags.String("platforms", "", "platforms the banner is for, comma-separated; empty for all")
+	appVersion := flags.String("app-version", "", "app versions the banner is for; empty for all")
+	targetingRule := flags.String("rule", "", "users the banner is for; empty for all")
+	templateFlag := flags.String("template", "", "placeholder settings as a JSON object; empty turns placeholders off")
+	contentFlags := newContentFlags(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	patch := client.BannerPatch{TagIDs: tags, IsActive: active.value}
+	if *feature != 0 {
+		patch.FeatureID = feature
+	}
+	if patch.Content, err = contentFlags.content(); err != nil {
+		return err
+	}
+	if *defaultLocale != "" {
+		patch.DefaultLocale = defaultLocale
+	}
+	if patch.Locales, err = parseLocales(*localesFlag); err != nil {
+		return err
+	}
+	if patch.Template, err = parseTemplate(*templateFlag); err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "platforms":
+			list := splitList(*platforms)
+			patch.Platforms = &list
+		case "app-version":
+			patch.AppVersion = appVersion
+		case "rule":
+			patch.Rule = targetingRule
+		case "template":
+			patch.RemoveTemplate = patch.Template == nil
+		}
+	})
+
+	if *version == 0 {
+		banner, err := c.GetBanner(ctx, id)
+		if err != nil {
+			return err
+		}
+		*version = banner.Version
+	}
+
+	draft, err := c.UpdateBanner(ctx, id, *version, patch)
+	if err != nil {
+		return versionError(err)
+	}
+	printDraftSaved(out, draft)
+
+	return nil
+}
+
+func printDraftSaved(w io.Writer, draft *client.Banner) {
+	fmt.Fprintf(w, "saved the draft of banner %d at version %d, run bannerctl banner publish %d to show it to users\n",
+		draft.ID, draft.Version, draft.ID)
+}
+
+// editBanner opens the content of the banner draft, or of the banner if it
+// has none, in $EDITOR and saves it to the draft if it was changed, unless the
+// banner was changed by someone else meanwhile.
+func editBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner edit")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	banner, err := c.GetBanner(ctx, id)
+	if err != nil {
+		return err
+	}
+	if banner.HasDraft {
+		if banner, err = c.GetBannerDraft(ctx, id); err != nil {
+			return err
+		}
+	}
+	original, err := json.MarshalIndent(banner.Content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	edited, err := runEditor(append(original, '\n'))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bytes.TrimSpace(edited), original) {
+		fmt.Fprintln(out, "content not changed")
+		return nil
+	}
+
+	content, err := parseContent(edited)
+	if err != nil {
+		return err
+	}
+	draft, err := c.UpdateBanner(ctx, id, banner.Version, client.BannerPatch{Content: content})
+	if err != nil {
+		return versionError(err)
+	}
+	printDraftSaved(out, draft)
+
+	return nil
+}
+
+// runEditor lets the user edit data in $EDITOR and returns the result.
+func runEditor(data []byte) ([]byte, error) {
+	file, err := os.CreateTemp("", "banner-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may have arguments, so let the shell split it.
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor: %w", err)
+	}
+
+	return os.ReadFile(file.Name())
+}
+
+func getBannerDraft(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner draft")
+	output := outputFlag(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	draft, err := c.GetBannerDraft(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return printBanner(out, *output, draft)
+}
+
+func publishBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner publish")
+	version := flags.Int64("version", 0, "version the publish is based on, the current one by default")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		banner, err := c.GetBanner(ctx, id)
+		if err != nil {
+			return err
+		}
+		*version = banner.Version
+	}
+
+	banner, err := c.PublishBanner(ctx, id, *version)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Code == client.CodeApprovalRequired {
+		return fmt.Errorf("the banner feature requires approval, run bannerctl banner submit %d and ask another admin to approve it", id)
+	}
+	if err != nil {
+		return versionError(err)
+	}
+	fmt.Fprintf(out, "published banner %d at version %d\n", banner.ID, banner.Version)
+
+	return nil
+}
+
+// submitBanner sends the banner draft for approval by another admin.
+func submitBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner submit")
+	version := flags.Int64("version", 0, "version the draft is submitted at, the current one by default")
+	comment := flags.String("comment", "", "what the change is for")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		banner, err := c.GetBanner(ctx, id)
+		if err != nil {
+			return err
+		}
+		*version = banner.Version
+	}
+
+	change, err := c.CreateChangeRequest(ctx, id, *version, *comment)
+	if err != nil {
+		return versionError(err)
+	}
+	fmt.Fprintf(out, "created change request %d for banner %d, another admin approves it with bannerctl change approve %d\n",
+		change.ID, id, change.ID)
+
+	return nil
+}
+
+func discardBannerDraft(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner discard")
+	version := flags.Int64("version", 0, "version the discard is based on, the current one by default")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		banner, err := c.GetBanner(ctx, id)
+		if err != nil {
+			return err
+		}
+		*version = banner.Version
+	}
+
+	if err := c.DiscardBannerDraft(ctx, id, *version); err != nil {
+		return versionError(err)
+	}
+	fmt.Fprintf(out, "discarded the draft of banner %d\n", id)
+
+	return nil
+}
+
+func deleteBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner delete")
+	version := flags.Int64("version", 0, "version the delete is based on, the current one by default")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		banner, err := c.GetBanner(ctx, id)
+		if err != nil {
+			return err
+		}
+		*version = banner.Version
+	}
+
+	if err := c.DeleteBanner(ctx, id, *version); err != nil {
+		return versionError(err)
+	}
+	fmt.Fprintf(out, "moved banner %d to the trash\n", id)
+
+	return nil
+}
+
+func listTrash(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner trash")
+	limit := flags.Int("limit", 0, "number of banners, most recently deleted first")
+	output := outputFlag(flags)
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	banners, err := c.ListTrash(ctx, *limit)
+	if err != nil {
+		return err
+	}
+
+	return printTrash(out, *output, banners)
+}
+
+// maxTrashLimit is the most banners the server lists from the trash at once.
+const maxTrashLimit = 1000
+
+func restoreBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	flags := newFlagSet("banner restore")
+	version := flags.Int64("version", 0, "version the restore is based on, the one in the trash by default")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+
+	if *version == 0 {
+		trash, err := c.ListTrash(ctx, maxTrashLimit)
+		if err != nil {
+			return err
+		}
+		for _, banner := range trash {
+			if banner.ID == id {
+				*version = banner.Version
+			}
+		}
+		if *version == 0 {
+			return fmt.Errorf("banner %d is not in the trash", id)
+		}
+	}
+
+	banner, err := c.RestoreBanner(ctx, id, *version)
+	if err != nil {
+		return versionError(err)
+	}
+	fmt.Fprintf(out, "restored banner %d at version %d\n", banner.ID, banner.Version)
+
+	return nil
+}
+
+func cloneBanner(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	var (
+		features intList
+		tags     tagSets
+	)
+	flags := newFlagSet("banner clone")
+	flags.Var(&features, "feature", "feature IDs to copy to, comma-separated; the banner's feature by default")
+	flags.Var(&tags, "tags", "tag IDs of one copy, comma-separated; repeat for more copies; the banner's tags by default")
+	disabled := flags.Bool("disabled", false, "create the copies inactive")
+	output := outputFlag(flags)
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := intArg(flags, 0)
+	if err != nil {
+		return err
+	}
+	if len(features) == 0 && len(tags) == 0 {
+		return usageError("banner clone: -feature or -tags is required")
+	}
+
+	report, err := c.CloneBanner(ctx, id, client.CloneOptions{FeatureIDs: features, TagSets: tags, Disabled: *disabled})
+	if err != nil {
+		return err
+	}
+	if err := printCloneReport(out, *output, report); err != nil {
+		return err
+	}
+	if failed := len(report.Results) - report.Created; failed > 0 {
+		return fmt.Errorf("%d of %d copies were not created", failed, len(report.Results))
+	}
+
+	return nil
+}
+
+// versionError explains a 412: the banner was changed since it was read.
+func versionError(err error) error {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusPreconditionFailed {
+		if apiErr.CurrentVersion != nil {
+			return fmt.Errorf("the banner was changed by someone else, it is at version %d now; fetch it and try again",
+				*apiErr.CurrentVersion)
+		}
+		return errors.New("the banner was changed by someone else; fetch it and try again")
+	}
+
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"banner/pkg/client"
+)
+
+// namedResource is the part of the client for tags or features, which only
+// have a name.
+type namedResource struct {
+	name   string
+	list   func(c *client.Client, ctx context.Context) (any, []int, []string, error)
+	get    func(c *client.Client, ctx context.Context, id int) (any, []int, []string, error)
+	create func(c *client.Client, ctx context.Context, name string) (int, error)
+	rename func(c *client.Client, ctx context.Context, id int, name string) error
+	delete func(c *client.Client, ctx context.Context, id int) error
+	// approval turns approval of banner changes on or off; only features
+	// have it.
+	approval func(c *client.Client, ctx context.Context, id int, required bool) error
+}
+
+var tagResource = namedResource{
+	name: "tag",
+	list: func(c *client.Client, ctx context.Context) (any, []int, []string, error) {
+		tags, err := c.ListTags(ctx)
+		ids, names := make([]int, len(tags)), make([]string, len(tags))
+		for i, tag := range tags {
+			ids[i], names[i] = tag.ID, tag.Name
+		}
+		return tags, ids, names, err
+	},
+	get: func(c *client.Client, ctx context.Context, id int) (any, []int, []string, error) {
+		tag, err := c.GetTag(ctx, id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return tag, []int{tag.ID}, []string{tag.Name}, nil
+	},
+	create: func(c *client.Client, ctx context.Context, name string) (int, error) {
+		tag, err := c.CreateTag(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		return tag.ID, nil
+	},
+	rename: func(c *client.Client, ctx context.Context, id int, name string) error {
+		_, err := c.RenameTag(ctx, id, name)
+		return err
+	},
+	delete: (*client.Client).DeleteTag,
+}
+
+var featureResource = namedResource{
+	name: "feature",
+	list: func(c *client.Client, ctx context.Context) (any, []int, []string, error) {
+		features, err := c.ListFeatures(ctx)
+		ids, names := make([]int, len(features)), make([]string, len(features))
+		for i, feature := range features {
+			ids[i], names[i] = feature.ID, feature.Name
+		}
+		return features, ids, names, err
+	},
+	get: func(c *client.Client, ctx context.Context, id int) (any, []int, []string, error) {
+		feature, err := c.GetFeature(ctx, id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return feature, []int{feature.ID}, []string{feature.Name}, nil
+	},
+	create: func(c *client.Client, ctx context.Context, name string) (int, error) {
+		feature, err := c.CreateFeature(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		return feature.ID, nil
+	},
+	rename: func(c *client.Client, ctx context.Context, id int, name string) error {
+		_, err := c.RenameFeature(ctx, id, name)
+		return err
+	},
+	delete: (*client.Client).DeleteFeature,
+	approval: func(c *client.Client, ctx context.Context, id int, required bool) error {
+		_, err := c.SetFeatureApproval(ctx, id, required)
+		return err
+	},
+}
+
+func namedCommand(ctx context.Context, res namedResource, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError("%s: missing subcommand", res.name)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	flags := newFlagSet(res.name + " " + args[0])
+	switch args[0] {
+	case "list":
+		output := outputFlag(flags)
+		if err := parseFlags(flags, args[1:], 0); err != nil {
+			return err
+		}
+		v, ids, names, err := res.list(c, ctx)
+		if err != nil {
+			return err
+		}
+		return printNamed(out, *output, v, ids, names)
+
+	case "get":
+		output := outputFlag(flags)
+		if err := parseFlags(flags, args[1:], 1); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		v, ids, names, err := res.get(c, ctx, id)
+		if err != nil {
+			return err
+		}
+		return printNamed(out, *output, v, ids, names)
+
+	case "create":
+		if err := parseFlags(flags, args[1:], 1); err != nil {
+			return err
+		}
+		id, err := res.create(c, ctx, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created %s %d\n", res.name, id)
+		return nil
+
+	case "rename":
+		if err := parseFlags(flags, args[1:], 2); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		if err := res.rename(c, ctx, id, flags.Arg(1)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "renamed %s %d\n", res.name, id)
+		return nil
+
+	case "delete":
+		if err := parseFlags(flags, args[1:], 1); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		if err := res.delete(c, ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "deleted %s %d\n", res.name, id)
+		return nil
+
+	case "approval":
+		if res.approval == nil {
+			break
+		}
+		if err := parseFlags(flags, args[1:], 2); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		var required bool
+		switch flags.Arg(1) {
+		case "on":
+			required = true
+		case "off":
+		default:
+			return usageError("%s approval: want on or off, got %q", res.name, flags.Arg(1))
+		}
+		if err := res.approval(c, ctx, id, required); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "turned approval of %s %d %s\n", res.name, id, flags.Arg(1))
+		return nil
+	}
+
+	return usageError("%s: unknown subcommand %q", res.name, args[0])
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"banner/pkg/client"
+)
+
+func changeCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError("change: missing subcommand")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	flags := newFlagSet("change " + args[0])
+	switch args[0] {
+	case "list":
+		status := flags.String("status", "", "pending, approved, rejected or canceled")
+		bannerID := flags.Int("banner", 0, "banner ID")
+		limit := flags.Int("limit", 0, "number of requests, newest first")
+		output := outputFlag(flags)
+		if err := parseFlags(flags, args[1:], 0); err != nil {
+			return err
+		}
+		changes, err := c.ListChangeRequests(ctx, client.ChangeRequestOptions{Status: *status, BannerID: *bannerID, Limit: *limit})
+		if err != nil {
+			return err
+		}
+		return printChangeRequests(out, *output, changes)
+
+	case "get":
+		output := outputFlag(flags)
+		if err := parseFlags(flags, args[1:], 1); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		change, err := c.GetChangeRequest(ctx, id)
+		if err != nil {
+			return err
+		}
+		return printChangeRequest(out, *output, change)
+
+	case "approve", "reject":
+		comment := flags.String("comment", "", "reason for the decision")
+		if err := parseFlags(flags, args[1:], 1); err != nil {
+			return err
+		}
+		id, err := intArg(flags, 0)
+		if err != nil {
+			return err
+		}
+		decide := c.ApproveChangeRequest
+		if args[0] == "reject" {
+			decide = c.RejectChangeRequest
+		}
+		change, err := decide(ctx, id, *comment)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s change request %d of banner %d\n", change.Status, change.ID, change.BannerID)
+		return nil
+	}
+
+	return usageError("change: unknown subcommand %q", args[0])
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ctlConfig is what bannerctl remembers between runs. It is kept in
+// $BANNERCTL_CONFIG or bannerctl/config.json in the user config directory,
+// readable only by the user since it holds the token.
+type ctlConfig struct {
+	Server string `json:"server"`
+	User   string `json:"user,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("BANNERCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the config directory, set BANNERCTL_CONFIG: %w", err)
+	}
+
+	return filepath.Join(dir, "bannerctl", "config.json"), nil
+}
+
+func loadConfig() (ctlConfig, error) {
+	var cfg ctlConfig
+
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func saveConfig(cfg ctlConfig) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write and rename, so a failed write does not lose the old config.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
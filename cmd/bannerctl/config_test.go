@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bannerctl", "config.json")
+	t.Setenv("BANNERCTL_CONFIG", path)
+
+	cfg, err := loadConfig()
+	if err != nil || cfg != (ctlConfig{}) {
+		t.Fatalf("loadConfig() without a file = %+v, %v, want empty config", cfg, err)
+	}
+
+	want := ctlConfig{Server: "http://banner.example.com", User: "admin", Token: "token"}
+	if err := saveConfig(want); err != nil {
+		t.Fatalf("saveConfig() error = %v", err)
+	}
+	if cfg, err = loadConfig(); err != nil || cfg != want {
+		t.Errorf("loadConfig() = %+v, %v, want %+v", cfg, err, want)
+	}
+
+	// The token is readable by the user only.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("config mode = %v, want 0600", info.Mode().Perm())
+	}
+	if info, err = os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("config directory mode = %v, %v, want 0700", info.Mode().Perm(), err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// Logging out keeps the server.
+	want.Token = ""
+	if err := saveConfig(want); err != nil {
+		t.Fatalf("saveConfig() error = %v", err)
+	}
+	if cfg, err = loadConfig(); err != nil || cfg != want {
+		t.Errorf("loadConfig() after logout = %+v, %v, want %+v", cfg, err, want)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("BANNERCTL_CONFIG", path)
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "invalid config "+path) {
+		t.Errorf("loadConfig() error = %v, want invalid config", err)
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	t.Setenv("BANNERCTL_SERVER", "")
+	if got := serverURL(ctlConfig{}); got != "http://localhost:8080" {
+		t.Errorf("serverURL() default = %q", got)
+	}
+	if got := serverURL(ctlConfig{Server: "http://saved"}); got != "http://saved" {
+		t.Errorf("serverURL() = %q, want the saved server", got)
+	}
+
+	t.Setenv("BANNERCTL_SERVER", "http://env")
+	if got := serverURL(ctlConfig{Server: "http://saved"}); got != "http://env" {
+		t.Errorf("serverURL() = %q, want $BANNERCTL_SERVER", got)
+	}
+}
@@ -0,0 +1,311 @@
+// Command bannerctl manages banners, tags and features of a banner service
+// from the command line.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"banner/pkg/client"
+
+	"golang.org/x/term"
+)
+
+const usage = `Usage:
+  bannerctl login [-server url] [-password-stdin] name
+  bannerctl logout
+
+  bannerctl banner list [-feature id] [-tag id] [-active bool] [-q text] [-path jsonpath]
+                        [-sort field] [-order asc|desc] [-limit n] [-all] [-o table|json]
+  bannerctl banner get [-o table|json] id
+  bannerctl banner create -feature id [-tags 1,2] [-active=false] (-content json | -content-file path)
+                          [-default-locale tag] [-locales json] [-platforms ios,android] [-app-version range]
+                          [-rule expr] [-template json]
+  bannerctl banner update [-feature id] [-tags 1,2] [-active bool] [-content json | -content-file path]
+                          [-default-locale tag] [-locales json] [-platforms list] [-app-version range]
+                          [-rule expr] [-template json] id
+  bannerctl banner edit id                 edit the draft content in $EDITOR
+  bannerctl banner draft [-o table|json] id
+  bannerctl banner publish id              show the draft to users
+  bannerctl banner discard id              delete the draft
+  bannerctl banner submit [-comment text] id
+                                           send the draft for approval
+  bannerctl banner delete id               move the banner to the trash
+  bannerctl banner trash [-limit n] [-o table|json]
+  bannerctl banner restore id              take the banner out of the trash
+  bannerctl banner clone [-feature 1,2] [-tags 1,2]... [-disabled] [-o table|json] id
+                                           copy the banner to other features and tag sets
+
+  bannerctl tag list|get|create|rename|delete ...
+  bannerctl feature list|get|create|rename|delete ...
+      list [-o table|json]   get [-o table|json] id   create name   rename id name   delete id
+  bannerctl feature approval id on|off     require approval of banner changes
+
+  bannerctl change list [-status pending|approved|rejected|canceled] [-banner id] [-limit n] [-o table|json]
+  bannerctl change get [-o table|json] id
+  bannerctl change approve|reject [-comment text] id
+
+The server and the token from login are kept in $BANNERCTL_CONFIG, by default
+bannerctl/config.json in the user config directory. $BANNERCTL_SERVER overrides
+the server.
+
+Updates and edits are saved to the banner draft, which users do not see until
+it is published. Drafts of features that require approval are submitted and
+published when another admin approves them.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "bannerctl:", err)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			fmt.Fprintln(os.Stderr, "run bannerctl login to get a new token")
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+
+	switch args[0] {
+	case "login":
+		return login(ctx, args[1:], out)
+	case "logout":
+		return logout()
+	case "banner", "banners":
+		return bannerCommand(ctx, args[1:], out)
+	case "tag", "tags":
+		return namedCommand(ctx, tagResource, args[1:], out)
+	case "feature", "features":
+		return namedCommand(ctx, featureResource, args[1:], out)
+	case "change", "changes":
+		return changeCommand(ctx, args[1:], out)
+	}
+
+	return usageError("unknown command %q", args[0])
+}
+
+func usageError(format string, args ...any) error {
+	return fmt.Errorf(format+"\n\n%s", append(args, usage)...)
+}
+
+func login(ctx context.Context, args []string, out io.Writer) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := newFlagSet("login")
+	server := flags.String("server", serverURL(cfg), "banner service URL")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	name := flags.Arg(0)
+
+	password, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	c, err := client.New(*server)
+	if err != nil {
+		return err
+	}
+	if err := c.Login(ctx, name, password); err != nil {
+		return err
+	}
+
+	cfg.Server, cfg.User, cfg.Token = *server, name, c.Token()
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "logged in to %s as %s\n", cfg.Server, name)
+
+	return nil
+}
+
+func logout() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	cfg.Token = ""
+
+	return saveConfig(cfg)
+}
+
+// readPassword reads a line from stdin, without echo if it is a terminal.
+func readPassword(fromStdin bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !fromStdin && term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func serverURL(cfg ctlConfig) string {
+	if server := os.Getenv("BANNERCTL_SERVER"); server != "" {
+		return server
+	}
+	if cfg.Server != "" {
+		return cfg.Server
+	}
+
+	return "http://localhost:8080"
+}
+
+// newClient returns a client of the configured server with the saved token.
+func newClient() (*client.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("not logged in, run bannerctl login first")
+	}
+
+	return client.New(serverURL(cfg), client.WithToken(cfg.Token))
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+
+	return flags
+}
+
+// parseFlags parses args and checks that nArgs positional arguments are
+// left.
+func parseFlags(flags *flag.FlagSet, args []string, nArgs int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != nArgs {
+		return usageError("%s: expected %d arguments, got %d", flags.Name(), nArgs, flags.NArg())
+	}
+
+	return nil
+}
+
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("o", outputTable, "output format: table or json")
+}
+
+func intArg(flags *flag.FlagSet, i int) (int, error) {
+	n, err := strconv.Atoi(flags.Arg(i))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an ID", flags.Name(), flags.Arg(i))
+	}
+
+	return n, nil
+}
+
+// intList is a flag of comma-separated integers that may be repeated.
+type intList []int
+
+func (l *intList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return joinInts(*l)
+}
+
+func (l *intList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", part)
+		}
+		*l = append(*l, n)
+	}
+
+	return nil
+}
+
+// tagSets is a flag of comma-separated tag IDs that is repeated once per
+// tag set.
+type tagSets [][]int
+
+func (s *tagSets) String() string {
+	if s == nil {
+		return ""
+	}
+
+	sets := make([]string, len(*s))
+	for i, set := range *s {
+		sets[i] = joinInts(set)
+	}
+
+	return strings.Join(sets, " ")
+}
+
+func (s *tagSets) Set(value string) error {
+	var set intList
+	if err := set.Set(value); err != nil {
+		return err
+	}
+	if len(set) == 0 {
+		return errors.New("empty tag set")
+	}
+	*s = append(*s, set)
+
+	return nil
+}
+
+// optionalBool is a bool flag that tells whether it was set.
+type optionalBool struct {
+	value *bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || b.value == nil {
+		return ""
+	}
+
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
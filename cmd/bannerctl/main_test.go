@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"banner/internal/app"
+	jwt "banner/internal/lib/auth/jwt"
+	password "banner/internal/lib/auth/password"
+	"banner/internal/models"
+	"banner/internal/repository/cache"
+	"banner/internal/repository/memory"
+	"banner/pkg/client"
+)
+
+const adminPassword = "admin-password"
+
+// newTestServer serves the real router on in-memory repositories with one
+// admin and points bannerctl at a fresh config file.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	bannerCache := cache.New(cache.Options{TTL: time.Minute, HardTTL: time.Hour, MaxEntries: 100, Shards: 1})
+	t.Cleanup(bannerCache.Close)
+
+	hash, err := password.HashPassword(adminPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.CreateUser(context.Background(), &models.User{Username: "admin", Password: hash, Role: "admin"})
+
+	router, err := app.NewRouter(app.Dependencies{
+		Log:                     log,
+		Features:                store,
+		Tags:                    store,
+		Users:                   store,
+		Banners:                 store,
+		Idempotency:             store,
+		Cache:                   bannerCache,
+		JWT:                     jwt.NewJWTSecret("bannerctl-test-secret", log),
+		IdempotencyTTL:          time.Hour,
+		IdempotencyLockTimeout:  time.Minute,
+		IdempotencyMaxBodyBytes: 1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	t.Setenv("BANNERCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("BANNERCTL_SERVER", "")
+
+	return server
+}
+
+// setStdin makes input the standard input of the test.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+// runOK runs bannerctl with args and returns what it printed.
+func runOK(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := run(context.Background(), args, &out); err != nil {
+		t.Fatalf("bannerctl %s error = %v", strings.Join(args, " "), err)
+	}
+
+	return out.String()
+}
+
+func loginAdmin(t *testing.T, server *httptest.Server) {
+	t.Helper()
+
+	setStdin(t, adminPassword+"\n")
+	if out := runOK(t, "login", "-server", server.URL, "-password-stdin", "admin"); out != "logged in to "+server.URL+" as admin\n" {
+		t.Fatalf("login printed %q", out)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	server := newTestServer(t)
+
+	if err := run(context.Background(), []string{"tag", "list"}, io.Discard); err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Errorf("tag list before login error = %v, want not logged in", err)
+	}
+
+	setStdin(t, "wrong-password\n")
+	if err := run(context.Background(), []string{"login", "-server", server.URL, "-password-stdin", "admin"}, io.Discard); err == nil {
+		t.Error("login with a wrong password succeeded")
+	}
+
+	loginAdmin(t, server)
+	cfg, err := loadConfig()
+	if err != nil || cfg.Server != server.URL || cfg.User != "admin" || cfg.Token == "" {
+		t.Fatalf("config after login = %+v, %v", cfg, err)
+	}
+
+	runOK(t, "logout")
+	if cfg, err = loadConfig(); err != nil || cfg.Token != "" || cfg.Server != server.URL {
+		t.Errorf("config after logout = %+v, %v, want the server without a token", cfg, err)
+	}
+}
+
+func TestBannerCommands(t *testing.T) {
+	server := newTestServer(t)
+	loginAdmin(t, server)
+
+	if out := runOK(t, "feature", "create", "onboarding"); out != "created feature 1\n" {
+		t.Errorf("feature create printed %q", out)
+	}
+	if out := runOK(t, "tag", "create", "new users"); out != "created tag 1\n" {
+		t.Errorf("tag create printed %q", out)
+	}
+	if out := runOK(t, "banner", "create", "-feature", "1", "-tags", "1", "-content", `{"title":"Hi"}`); out != "created banner 1\n" {
+		t.Errorf("banner create printed %q", out)
+	}
+
+	var banners []client.Banner
+	if err := json.Unmarshal([]byte(runOK(t, "banner", "list", "-o", "json")), &banners); err != nil {
+		t.Fatalf("banner list -o json printed invalid JSON: %v", err)
+	}
+	if len(banners) != 1 || banners[0].FeatureID != 1 || banners[0].Content["title"] != "Hi" {
+		t.Errorf("banner list = %+v", banners)
+	}
+
+	table := runOK(t, "tag", "list")
+	if !strings.HasPrefix(table, "ID  NAME\n") || !strings.Contains(table, "1   new users\n") {
+		t.Errorf("tag list printed %q", table)
+	}
+
+	// Drafts of the feature go through change requests now.
+	if out := runOK(t, "feature", "approval", "1", "on"); out != "turned approval of feature 1 on\n" {
+		t.Errorf("feature approval printed %q", out)
+	}
+	runOK(t, "banner", "update", "-content", `{"title":"Bye"}`, "1")
+
+	err := run(context.Background(), []string{"banner", "publish", "1"}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "bannerctl banner submit 1") {
+		t.Errorf("banner publish error = %v, want the approval hint", err)
+	}
+
+	if err := run(context.Background(), []string{"banner", "frobnicate"}, io.Discard); err == nil || !strings.Contains(err.Error(), "Usage:") {
+		t.Errorf("unknown subcommand error = %v, want usage", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"banner/pkg/client"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+
+	contentColumnWidth = 60
+)
+
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// printTable writes rows under the header with aligned columns.
+func printTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func printBanners(w io.Writer, output string, banners []client.Banner) error {
+	if output == outputJSON {
+		return printJSON(w, banners)
+	}
+
+	rows := make([][]string, len(banners))
+	for i, b := range banners {
+		content, _ := json.Marshal(b.Content)
+		rows[i] = []string{
+			strconv.Itoa(b.ID),
+			strconv.Itoa(b.FeatureID),
+			joinInts(b.TagIDs),
+			strconv.FormatBool(b.IsActive),
+			strconv.FormatInt(b.Version, 10),
+			yesNo(b.HasDraft),
+			b.UpdatedAt.Local().Format(time.DateTime),
+			truncate(string(content), contentColumnWidth),
+		}
+	}
+
+	return printTable(w, []string{"ID", "FEATURE", "TAGS", "ACTIVE", "VERSION", "DRAFT", "UPDATED", "CONTENT"}, rows)
+}
+
+func printBanner(w io.Writer, output string, banner *client.Banner) error {
+	if output == outputJSON {
+		return printJSON(w, banner)
+	}
+
+	content, err := json.MarshalIndent(banner.Content, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "ID:       %d\n", banner.ID)
+	fmt.Fprintf(w, "Feature:  %d\n", banner.FeatureID)
+	fmt.Fprintf(w, "Tags:     %s\n", joinInts(banner.TagIDs))
+	fmt.Fprintf(w, "Active:   %t\n", banner.IsActive)
+	fmt.Fprintf(w, "Version:  %d\n", banner.Version)
+	fmt.Fprintf(w, "Draft:    %s\n", yesNo(banner.HasDraft))
+	if !banner.CreatedAt.IsZero() {
+		fmt.Fprintf(w, "Created:  %s\n", banner.CreatedAt.Local().Format(time.DateTime))
+		fmt.Fprintf(w, "Updated:  %s\n", banner.UpdatedAt.Local().Format(time.DateTime))
+	}
+	if len(banner.Platforms) > 0 {
+		fmt.Fprintf(w, "Platform: %s\n", strings.Join(banner.Platforms, ","))
+	}
+	if banner.AppVersion != "" {
+		fmt.Fprintf(w, "Versions: %s\n", banner.AppVersion)
+	}
+	if banner.Rule != "" {
+		fmt.Fprintf(w, "Rule:     %s\n", banner.Rule)
+	}
+	if banner.Template != nil {
+		fmt.Fprintf(w, "Template: %s (escape %s, missing %s)\n", strings.Join(banner.Template.Variables, ","),
+			banner.Template.Escape, banner.Template.OnMissing)
+	}
+	if banner.DefaultLocale != "" {
+		fmt.Fprintf(w, "Language: %s\n", banner.DefaultLocale)
+	}
+	fmt.Fprintf(w, "Content:\n%s\n", content)
+	for _, locale := range sortedKeys(banner.Locales) {
+		localized, err := json.MarshalIndent(banner.Locales[locale], "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Content (%s):\n%s\n", locale, localized)
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func printTrash(w io.Writer, output string, banners []client.Banner) error {
+	if output == outputJSON {
+		return printJSON(w, banners)
+	}
+
+	rows := make([][]string, len(banners))
+	for i, b := range banners {
+		content, _ := json.Marshal(b.Content)
+		var deleted string
+		if b.DeletedAt != nil {
+			deleted = b.DeletedAt.Local().Format(time.DateTime)
+		}
+		rows[i] = []string{
+			strconv.Itoa(b.ID),
+			strconv.Itoa(b.FeatureID),
+			joinInts(b.TagIDs),
+			strconv.FormatInt(b.Version, 10),
+			deleted,
+			truncate(string(content), contentColumnWidth),
+		}
+	}
+
+	return printTable(w, []string{"ID", "FEATURE", "TAGS", "VERSION", "DELETED", "CONTENT"}, rows)
+}
+
+func printCloneReport(w io.Writer, output string, report *client.CloneReport) error {
+	if output == outputJSON {
+		return printJSON(w, report)
+	}
+
+	rows := make([][]string, len(report.Results))
+	for i, r := range report.Results {
+		var banner string
+		switch {
+		case r.BannerID != 0:
+			banner = strconv.Itoa(r.BannerID)
+		case r.ConflictingBannerID != 0:
+			banner = strconv.Itoa(r.ConflictingBannerID)
+		}
+		rows[i] = []string{
+			strconv.Itoa(r.FeatureID),
+			joinInts(r.TagIDs),
+			r.Status,
+			banner,
+			truncate(r.Error, contentColumnWidth),
+		}
+	}
+
+	return printTable(w, []string{"FEATURE", "TAGS", "STATUS", "BANNER", "ERROR"}, rows)
+}
+
+func printChangeRequests(w io.Writer, output string, changes []client.ChangeRequest) error {
+	if output == outputJSON {
+		return printJSON(w, changes)
+	}
+
+	rows := make([][]string, len(changes))
+	for i, c := range changes {
+		rows[i] = []string{
+			strconv.Itoa(c.ID),
+			strconv.Itoa(c.BannerID),
+			c.Status,
+			c.Author,
+			c.Reviewer,
+			c.CreatedAt.Local().Format(time.DateTime),
+			truncate(c.Comment, contentColumnWidth),
+		}
+	}
+
+	return printTable(w, []string{"ID", "BANNER", "STATUS", "AUTHOR", "REVIEWER", "CREATED", "COMMENT"}, rows)
+}
+
+func printChangeRequest(w io.Writer, output string, change *client.ChangeRequest) error {
+	if output == outputJSON {
+		return printJSON(w, change)
+	}
+
+	content, err := json.MarshalIndent(change.Content, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "ID:        %d\n", change.ID)
+	fmt.Fprintf(w, "Banner:    %d at version %d\n", change.BannerID, change.BaseVersion)
+	fmt.Fprintf(w, "Status:    %s\n", change.Status)
+	fmt.Fprintf(w, "Author:    %s\n", change.Author)
+	fmt.Fprintf(w, "Created:   %s\n", change.CreatedAt.Local().Format(time.DateTime))
+	if change.Comment != "" {
+		fmt.Fprintf(w, "Comment:   %s\n", change.Comment)
+	}
+	if change.ReviewedAt != nil {
+		fmt.Fprintf(w, "Reviewer:  %s\n", change.Reviewer)
+		fmt.Fprintf(w, "Reviewed:  %s\n", change.ReviewedAt.Local().Format(time.DateTime))
+		if change.ReviewComment != "" {
+			fmt.Fprintf(w, "Review:    %s\n", change.ReviewComment)
+		}
+	}
+	fmt.Fprintf(w, "Feature:   %d\n", change.FeatureID)
+	fmt.Fprintf(w, "Tags:      %s\n", joinInts(change.TagIDs))
+	fmt.Fprintf(w, "Active:    %t\n", change.IsActive)
+	fmt.Fprintf(w, "Content:\n%s\n", content)
+
+	return nil
+}
+
+// printNamed prints tags or features as an ID and name table.
+func printNamed(w io.Writer, output string, v any, ids []int, names []string) error {
+	if output == outputJSON {
+		return printJSON(w, v)
+	}
+
+	rows := make([][]string, len(ids))
+	for i := range ids {
+		rows[i] = []string{strconv.Itoa(ids[i]), names[i]}
+	}
+
+	return printTable(w, []string{"ID", "NAME"}, rows)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func joinInts(ids []int) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.Itoa(id)
+	}
+
+	return strings.Join(strs, ",")
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+
+	return string(runes[:width-1]) + "…"
+}
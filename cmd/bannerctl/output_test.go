@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"banner/pkg/client"
+)
+
+func TestPrintBanners(t *testing.T) {
+	banners := []client.Banner{
+		{ID: 1, FeatureID: 2, TagIDs: []int{3, 4}, IsActive: true, Version: 5, HasDraft: true,
+			Content: map[string]any{"title": strings.Repeat("long ", 20)}, UpdatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{ID: 10, FeatureID: 20, TagIDs: []int{30}, Version: 1, Content: map[string]any{"title": "Hi"}},
+	}
+
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printBanners(&out, outputTable, banners); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("printBanners() printed %d lines, want a header and 2 rows:\n%s", len(lines), out.String())
+		}
+		if got := strings.Fields(lines[0]); !reflect.DeepEqual(got, []string{"ID", "FEATURE", "TAGS", "ACTIVE", "VERSION", "DRAFT", "UPDATED", "CONTENT"}) {
+			t.Errorf("header = %q", got)
+		}
+		if got := strings.Fields(lines[1])[:6]; !reflect.DeepEqual(got, []string{"1", "2", "3,4", "true", "5", "yes"}) {
+			t.Errorf("first row = %q", lines[1])
+		}
+		if !strings.HasSuffix(lines[1], "…") {
+			t.Errorf("first row = %q, want the content truncated", lines[1])
+		}
+		if got := strings.Fields(lines[2]); got[5] != "no" || got[len(got)-1] != `{"title":"Hi"}` {
+			t.Errorf("second row = %q", lines[2])
+		}
+		// Columns line up under the header.
+		if strings.Index(lines[0], "CONTENT") != strings.Index(lines[2], `{"title"`) {
+			t.Errorf("columns are not aligned:\n%s", out.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printBanners(&out, outputJSON, banners); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []client.Banner
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("printBanners() printed invalid JSON: %v\n%s", err, out.String())
+		}
+		if !reflect.DeepEqual(got, banners) {
+			t.Errorf("printBanners() = %+v, want %+v", got, banners)
+		}
+	})
+}
+
+func TestPrintNamed(t *testing.T) {
+	tags := []client.Tag{{ID: 1, Name: "new users"}, {ID: 2, Name: "vip"}}
+
+	var out bytes.Buffer
+	if err := printNamed(&out, outputTable, tags, []int{1, 2}, []string{"new users", "vip"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "ID  NAME\n1   new users\n2   vip\n"; out.String() != want {
+		t.Errorf("printNamed() table = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := printNamed(&out, outputJSON, tags, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []client.Tag
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil || !reflect.DeepEqual(got, tags) {
+		t.Errorf("printNamed() json = %s, %v", out.String(), err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 5, "too …"},
+		{"привет мир", 7, "привет…"},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.width); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
@@ -2,25 +2,20 @@ package app
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"banner/internal/config"
-	"banner/internal/lib/api/middlewares"
 	jwt "banner/internal/lib/auth/jwt"
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/repo"
+	"banner/internal/repository/cache"
 	"banner/internal/repository/postgres"
-	"banner/internal/server/handlers/banners"
-	"banner/internal/server/handlers/features"
-	"banner/internal/server/handlers/tags"
-	"banner/internal/server/handlers/users/login"
-	user "banner/internal/server/handlers/users/user"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
 const (
@@ -29,9 +24,9 @@ const (
 	envProd  = "prod"
 )
 
-func Run() error {
+func Run(configPath string) error {
 	// Configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
 		return err
 	}
@@ -58,57 +53,48 @@ func Run() error {
 	}
 	log.Info("Application started...", slog.String("env", cfg.Env))
 
-	// Router
-	router := chi.NewRouter()
-
-	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-
-	ftr := repo.NewFeatureRepo(db.DB, log)
-	tg := repo.NewTagRepo(db.DB, log)
-	us := repo.NewUserRepo(db.DB, log)
-	br := repo.NewBannerRepo(db.DB, log)
-	btr := repo.NewBannerTagRepo(db.DB, log)
-	jwt := jwt.NewJWTSecret(cfg.Jwt.Secret, log)
-
-	router.Post("/login", login.Login(log, us, jwt))
-	router.Post("/users", user.NewUser(log, us))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthMiddleware(jwt, next)
-	}).Get("/user_banner", banners.GetBannerUser(log, br))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthMiddleware(jwt, next)
-	}).Post("/tags", tags.NewTag(log, tg))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthAndRoleMiddleware(jwt, next)
-	}).Post("/features", features.NewFeature(log, ftr))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthAndRoleMiddleware(jwt, next)
-	}).Get("/banner", banners.GetBanners(br, log))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthAndRoleMiddleware(jwt, next)
-	}).Post("/banners", banners.NewBanner(log, br, btr))
-
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthAndRoleMiddleware(jwt, next)
-	}).Patch("/banner/{id}", banners.UpdateBanner(br, log))
+	bannerCache := cache.New(cache.Options{
+		TTL:             cfg.Cache.TTL,
+		HardTTL:         cfg.Cache.HardTTL,
+		NegativeTTL:     cfg.Cache.NegativeTTL,
+		MaxEntries:      cfg.Cache.MaxEntries,
+		Shards:          cfg.Cache.Shards,
+		CleanupInterval: cfg.Cache.CleanupInterval,
+	})
+	defer bannerCache.Close()
+	expvar.Publish("banner_cache", expvar.Func(func() any { return bannerCache.Stats() }))
+
+	idempotencyRepo := repo.NewIdempotencyRepo(db.DB, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cleanupIdempotencyKeys(ctx, idempotencyRepo, cfg.Idempotency.TTL, log)
+
+	bannerRepo := repo.NewBannerRepo(db.DB, log)
+	go purgeTrash(ctx, bannerRepo, cfg.Trash.Retention, log)
 
-	router.With(func(next http.Handler) http.Handler {
-		return middlewares.TokenAuthAndRoleMiddleware(jwt, next)
-	}).Delete("/banner/{id}", banners.DeleteBanner(log, br))
+	// Router
+	router, err := NewRouter(Dependencies{
+		Log:                     log,
+		Features:                repo.NewFeatureRepo(db.DB, log),
+		Tags:                    repo.NewTagRepo(db.DB, log),
+		Users:                   repo.NewUserRepo(db.DB, log),
+		Banners:                 bannerRepo,
+		Idempotency:             idempotencyRepo,
+		Cache:                   bannerCache,
+		JWT:                     jwt.NewJWTSecret(cfg.Jwt.Secret, log),
+		IdempotencyTTL:          cfg.Idempotency.TTL,
+		IdempotencyLockTimeout:  cfg.Idempotency.LockTimeout,
+		IdempotencyMaxBodyBytes: cfg.Idempotency.MaxBodyBytes,
+	})
+	if err != nil {
+		return err
+	}
 
 	// Server
-	log.Info("Starting server at", slog.String(cfg.Server.Host, cfg.Server.Port))
+	addr := net.JoinHostPort(cfg.Server.Host, cfg.Server.Port)
+	log.Info("Starting server at", slog.String("address", addr))
 	server := &http.Server{
-		Addr:         "localhost:8080",
+		Addr:         addr,
 		Handler:      router,
 		ReadTimeout:  cfg.Server.Timeout,
 		WriteTimeout: cfg.Server.Timeout,
@@ -121,6 +107,48 @@ func Run() error {
 	return nil
 }
 
+// cleanupIdempotencyKeys deletes expired idempotency records every hour
+// until ctx is done.
+func cleanupIdempotencyKeys(ctx context.Context, keys *repo.IdempotencyRepo, ttl time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := keys.DeleteExpiredIdempotencyKeys(ctx, now.Add(-ttl))
+			if err != nil {
+				log.Error("Failed to delete expired idempotency keys", logerr.Err(err))
+				continue
+			}
+			log.Debug("Expired idempotency keys deleted", slog.Int64("count", deleted))
+		}
+	}
+}
+
+// purgeTrash deletes banners that have been in the trash for longer than
+// retention every hour until ctx is done.
+func purgeTrash(ctx context.Context, bannerRepo *repo.BannerRepo, retention time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := bannerRepo.PurgeBanners(ctx, now.Add(-retention))
+			if err != nil {
+				log.Error("Failed to purge trashed banners", logerr.Err(err))
+				continue
+			}
+			log.Debug("Trashed banners purged", slog.Int64("count", purged))
+		}
+	}
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
@@ -148,14 +176,7 @@ func setupLogger(env string) *slog.Logger {
 }
 
 func setupConnectToPostgres(cfg *config.Config, log *slog.Logger) (*postgres.Postgres, error) {
-	connection := fmt.Sprintf("host=%s port=%s user=%s password=%s database=%s",
-		cfg.Postgres.Host,
-		cfg.Postgres.Port,
-		cfg.Postgres.User,
-		cfg.Postgres.Password,
-		cfg.Postgres.Database)
-
-	db, err := postgres.NewPostgres(context.Background(), connection, log)
+	db, err := postgres.NewPostgres(context.Background(), cfg.Postgres.DSN(), log)
 
 	return db, err
 }
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"banner/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigCheck prints the effective configuration with secrets redacted and
+// lists every validation problem. It fails if the configuration is invalid.
+func ConfigCheck(configPath string, out io.Writer) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	source := configPath
+	if source == "" {
+		source = "environment only"
+	}
+	fmt.Fprintf(out, "# source: %s\n", source)
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		var validationErr *config.ValidationError
+		if errors.As(err, &validationErr) {
+			fmt.Fprintln(out, "# problems:")
+			for _, problem := range validationErr.Problems {
+				fmt.Fprintf(out, "#   - %s\n", problem)
+			}
+		}
+		return err
+	}
+
+	fmt.Fprintln(out, "# config is valid")
+
+	return nil
+}
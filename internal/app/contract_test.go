@@ -0,0 +1,968 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"banner/api"
+	jwt "banner/internal/lib/auth/jwt"
+	password "banner/internal/lib/auth/password"
+	"banner/internal/models"
+	"banner/internal/repository/cache"
+	"banner/internal/repository/memory"
+	"banner/internal/server/handlers/banners"
+	"banner/internal/server/handlers/features"
+	"banner/internal/server/handlers/tags"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+)
+
+// contract sends requests to the router and checks every response against
+// the OpenAPI spec, recording which operations were exercised.
+type contract struct {
+	t       *testing.T
+	spec    *openapi3.T
+	routes  routers.Router
+	handler http.Handler
+	store   *memory.Store
+	covered map[string]bool
+}
+
+func newContract(t *testing.T) *contract {
+	t.Helper()
+
+	spec, err := api.Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	routes, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		t.Fatalf("build spec router: %v", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	bannerCache := cache.New(cache.Options{TTL: time.Minute, HardTTL: time.Hour, NegativeTTL: time.Second, MaxEntries: 100, Shards: 1})
+	t.Cleanup(bannerCache.Close)
+
+	handler, err := NewRouter(Dependencies{
+		Log:                     log,
+		Features:                store,
+		Tags:                    store,
+		Users:                   store,
+		Banners:                 store,
+		Idempotency:             store,
+		Cache:                   bannerCache,
+		JWT:                     jwt.NewJWTSecret("contract-test-secret", log),
+		IdempotencyTTL:          time.Hour,
+		IdempotencyLockTimeout:  time.Minute,
+		IdempotencyMaxBodyBytes: 1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	return &contract{t: t, spec: spec, routes: routes, handler: handler, store: store, covered: make(map[string]bool)}
+}
+
+// do sends a request and fails the test if the response status differs from
+// want or the response does not match the spec.
+func (c *contract) do(method, target, token string, body any, header http.Header, want int) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	// Strings are sent as they are, with the Content-Type given in header.
+	var data []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		data = []byte(body)
+	default:
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			c.t.Fatalf("marshal body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+
+	if rec.Code != want {
+		c.t.Fatalf("%s %s: status = %d, want %d; body: %s", method, target, rec.Code, want, rec.Body)
+	}
+
+	route, pathParams, err := c.routes.FindRoute(req)
+	if err != nil {
+		c.t.Fatalf("%s %s is not in the spec: %v", method, target, err)
+	}
+	c.covered[method+" "+route.Path] = true
+
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status:  rec.Code,
+		Header:  rec.Header(),
+		Body:    io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options: &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+		c.t.Fatalf("%s %s: response does not match the spec: %v", method, target, err)
+	}
+
+	return rec
+}
+
+func (c *contract) login(name, pass string) string {
+	c.t.Helper()
+
+	rec := c.do(http.MethodPost, "/login", "", map[string]string{"name": name, "password": pass}, nil, http.StatusOK)
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	return resp.Token
+}
+
+// run runs step as a subtest, with the requests it sends failing the
+// subtest. Steps build on what the earlier ones did, so a failed step ends
+// the test.
+func (c *contract) run(name string, step func(t *testing.T)) {
+	c.t.Helper()
+
+	parent := c.t
+	if !parent.Run(name, func(t *testing.T) {
+		c.t = t
+		defer func() { c.t = parent }()
+		step(t)
+	}) {
+		parent.FailNow()
+	}
+}
+
+func decodeID(t *testing.T, rec *httptest.ResponseRecorder, field string) int {
+	t.Helper()
+
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	id, ok := resp[field].(float64)
+	if !ok {
+		t.Fatalf("response has no %s: %s", field, rec.Body)
+	}
+
+	return int(id)
+}
+
+func decodeChangeRequest(t *testing.T, rec *httptest.ResponseRecorder) models.ChangeRequest {
+	t.Helper()
+
+	var change models.ChangeRequest
+	if err := json.Unmarshal(rec.Body.Bytes(), &change); err != nil {
+		t.Fatalf("decode change request: %v", err)
+	}
+
+	return change
+}
+
+func decodePage(t *testing.T, rec *httptest.ResponseRecorder) banners.ResponseGetBanners {
+	t.Helper()
+
+	var page banners.ResponseGetBanners
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode page: %v", err)
+	}
+
+	return page
+}
+
+func decodeBanner(t *testing.T, rec *httptest.ResponseRecorder) models.Banner {
+	t.Helper()
+
+	var banner models.Banner
+	if err := json.Unmarshal(rec.Body.Bytes(), &banner); err != nil {
+		t.Fatalf("decode banner: %v", err)
+	}
+
+	return banner
+}
+
+func decodeImport(t *testing.T, rec *httptest.ResponseRecorder) banners.ResponseImport {
+	t.Helper()
+
+	var report banners.ResponseImport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode import report: %v", err)
+	}
+
+	return report
+}
+
+func decodeClone(t *testing.T, rec *httptest.ResponseRecorder) banners.ResponseClone {
+	t.Helper()
+
+	var report banners.ResponseClone
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode clone report: %v", err)
+	}
+
+	return report
+}
+
+func TestAPIContract(t *testing.T) {
+	c := newContract(t)
+
+	hash, err := password.HashPassword("admin-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.store.CreateUser(context.Background(), &models.User{Username: "admin", Password: hash, Role: "admin"})
+	c.store.CreateUser(context.Background(), &models.User{Username: "reviewer", Password: hash, Role: "admin"})
+
+	// The steps share what the earlier ones created.
+	var (
+		userToken, adminToken, reviewerToken             string
+		featureID, campaignID, tagID, otherTagID         int
+		bannerID                                         int
+		bannerPath, featurePath, userBanner, publishPath string
+		created, patched                                 models.Banner
+		etag, restoredETag, localizedPath                string
+	)
+
+	c.run("users", func(t *testing.T) {
+		c.do(http.MethodPost, "/users", "", map[string]string{"name": "user", "password": "user-password"}, nil, http.StatusCreated)
+		c.do(http.MethodPost, "/users", "", map[string]string{"name": "user"}, nil, http.StatusBadRequest)
+		if !strings.Contains(c.do(http.MethodPost, "/users", "", map[string]string{"name": "user", "password": "other"}, nil, http.StatusConflict).Body.String(), `"code":"conflict"`) {
+			t.Error("duplicate user is not a conflict")
+		}
+		c.do(http.MethodPost, "/login", "", map[string]string{"name": "user", "password": "wrong"}, nil, http.StatusUnauthorized)
+
+		userToken = c.login("user", "user-password")
+		adminToken = c.login("admin", "admin-password")
+		reviewerToken = c.login("reviewer", "admin-password")
+	})
+
+	c.run("create banners", func(t *testing.T) {
+		featureID = decodeID(t, c.do(http.MethodPost, "/features", adminToken, map[string]string{"name": "onboarding"}, nil, http.StatusCreated), "feature_id")
+		c.do(http.MethodPost, "/features", userToken, map[string]string{"name": "promo"}, nil, http.StatusForbidden)
+		tagID = decodeID(t, c.do(http.MethodPost, "/tags", userToken, map[string]string{"name": "new-users"}, nil, http.StatusCreated), "tag_id")
+		c.do(http.MethodPost, "/tags", "", map[string]string{"name": "anonymous"}, nil, http.StatusUnauthorized)
+
+		newBanner := map[string]any{
+			"tag_ids":    []int{tagID},
+			"feature_id": featureID,
+			"content":    map[string]any{"title": "Welcome"},
+			"is_active":  true,
+		}
+		bannerID = decodeID(t, c.do(http.MethodPost, "/banner", adminToken, newBanner, nil, http.StatusCreated), "banner_id")
+		if rec := c.do(http.MethodPost, "/banner", adminToken, newBanner, nil, http.StatusConflict); !strings.Contains(rec.Body.String(), fmt.Sprintf("Banner %d already has", bannerID)) {
+			t.Errorf("duplicate banner: %s", rec.Body)
+		}
+		otherTagID = decodeID(t, c.do(http.MethodPost, "/tags", userToken, map[string]string{"name": "returning-users"}, nil, http.StatusCreated), "tag_id")
+		newBanner["tag_ids"] = []int{otherTagID}
+		newBanner["is_active"] = false
+		idempotencyKey := http.Header{"Idempotency-Key": {"create-inactive-banner"}}
+		created = decodeBanner(t, c.do(http.MethodPost, "/banners", adminToken, newBanner, idempotencyKey, http.StatusCreated))
+		if created.IsActive {
+			t.Fatal("banner created with is_active false is active")
+		}
+		rec := c.do(http.MethodPost, "/banners", adminToken, newBanner, idempotencyKey, http.StatusCreated)
+		if replayed := decodeBanner(t, rec); replayed.ID != created.ID || rec.Header().Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("retry with the same Idempotency-Key created banner %d, want replay of %d", replayed.ID, created.ID)
+		}
+		newBanner["is_active"] = true
+		c.do(http.MethodPost, "/banners", adminToken, newBanner, idempotencyKey, http.StatusUnprocessableEntity)
+		// Keys are per caller: another user's key neither replays nor blocks.
+		for _, token := range []string{userToken, adminToken} {
+			rec := c.do(http.MethodPost, "/tags", token, map[string]string{"name": "keyed"}, idempotencyKey, http.StatusCreated)
+			if rec.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatal("Idempotency-Key of another user replayed")
+			}
+			c.do(http.MethodDelete, fmt.Sprintf("/tags/%d", decodeID(t, rec, "tag_id")), adminToken, nil, nil, http.StatusNoContent)
+		}
+		c.do(http.MethodPost, "/tags", userToken, map[string]string{"name": strings.Repeat("x", 1<<20)}, http.Header{"Idempotency-Key": {"large"}}, http.StatusRequestEntityTooLarge)
+		c.do(http.MethodPost, "/banner", adminToken, map[string]any{"feature_id": "one"}, nil, http.StatusBadRequest)
+
+		bannerPath = fmt.Sprintf("/banner/%d", bannerID)
+		featurePath = fmt.Sprintf("/features/%d", featureID)
+		userBanner = fmt.Sprintf("/user_banner?feature_id=%d&tag_id=%d", featureID, tagID)
+		publishPath = bannerPath + "/publish"
+	})
+
+	c.run("tags", func(t *testing.T) {
+		tagPath := fmt.Sprintf("/tags/%d", tagID)
+		var tagList tags.ResponseTags
+		json.Unmarshal(c.do(http.MethodGet, "/tags", userToken, nil, nil, http.StatusOK).Body.Bytes(), &tagList)
+		if len(tagList.Items) != 2 || tagList.Items[0].Name != "new-users" {
+			t.Fatalf("tags = %+v", tagList)
+		}
+		c.do(http.MethodGet, tagPath, userToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/tags/999", userToken, nil, nil, http.StatusNotFound)
+		c.do(http.MethodPatch, tagPath, userToken, map[string]string{"name": "newcomers"}, nil, http.StatusForbidden)
+		c.do(http.MethodPatch, tagPath, adminToken, map[string]string{"name": "newcomers"}, nil, http.StatusOK)
+		c.do(http.MethodPatch, tagPath, adminToken, map[string]string{"name": "new-users"}, nil, http.StatusOK)
+		c.do(http.MethodPatch, "/tags/999", adminToken, map[string]string{"name": "x"}, nil, http.StatusNotFound)
+		c.do(http.MethodDelete, tagPath, adminToken, nil, nil, http.StatusConflict)
+		unusedTag := decodeID(t, c.do(http.MethodPost, "/tags", userToken, map[string]string{"name": "unused"}, nil, http.StatusCreated), "tag_id")
+		c.do(http.MethodDelete, fmt.Sprintf("/tags/%d", unusedTag), adminToken, nil, nil, http.StatusNoContent)
+		c.do(http.MethodDelete, fmt.Sprintf("/tags/%d", unusedTag), adminToken, nil, nil, http.StatusNotFound)
+	})
+
+	c.run("features", func(t *testing.T) {
+		c.do(http.MethodGet, "/features", adminToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/features", userToken, nil, nil, http.StatusForbidden)
+		c.do(http.MethodGet, featurePath, adminToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/features/abc", adminToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodPatch, featurePath, adminToken, map[string]string{"name": "onboarding"}, nil, http.StatusOK)
+		c.do(http.MethodDelete, featurePath, adminToken, nil, nil, http.StatusConflict)
+		unusedFeature := decodeID(t, c.do(http.MethodPost, "/features", adminToken, map[string]string{"name": "unused"}, nil, http.StatusCreated), "feature_id")
+		c.do(http.MethodDelete, fmt.Sprintf("/features/%d", unusedFeature), adminToken, nil, nil, http.StatusNoContent)
+	})
+
+	c.run("list banners", func(t *testing.T) {
+		rec := c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK)
+		if decodeBanner(t, rec).ID != bannerID || rec.Header().Get("ETag") == "" {
+			t.Fatalf("GET %s = %s", bannerPath, rec.Body)
+		}
+		c.do(http.MethodGet, "/banner/999", adminToken, nil, nil, http.StatusNotFound)
+
+		first := decodePage(t, c.do(http.MethodGet, "/banner?limit=1&include_total=true", adminToken, nil, nil, http.StatusOK))
+		if len(first.Items) != 1 || first.NextCursor == "" || first.Total == nil || *first.Total != 2 {
+			t.Fatalf("first page = %+v, want 1 of 2 banners and a cursor", first)
+		}
+		last := decodePage(t, c.do(http.MethodGet, "/banner?limit=1&cursor="+first.NextCursor, adminToken, nil, nil, http.StatusOK))
+		if len(last.Items) != 1 || last.Items[0].ID == first.Items[0].ID || last.NextCursor != "" {
+			t.Fatalf("last page = %+v, want the other banner and no cursor", last)
+		}
+		c.do(http.MethodGet, "/banner?sort=updated_at&cursor="+first.NextCursor, adminToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodGet, fmt.Sprintf("/banner?feature_id=%d&tag_id=%d&tag_id=999&is_active=true&sort=created_at&order=desc&created_after=2000-01-01T00:00:00Z", featureID, tagID), adminToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/banner?limit=abc", adminToken, nil, nil, http.StatusBadRequest)
+
+		found := decodePage(t, c.do(http.MethodGet, fmt.Sprintf("/banner/search?q=welcome&tag_id=%d", tagID), adminToken, nil, nil, http.StatusOK))
+		if len(found.Items) != 1 || found.Items[0].ID != bannerID {
+			t.Fatalf("search = %+v, want banner %d", found, bannerID)
+		}
+		c.do(http.MethodGet, "/banner/search", adminToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodGet, "/banner/search?q=welcome", userToken, nil, nil, http.StatusForbidden)
+		c.do(http.MethodGet, "/banner", userToken, nil, nil, http.StatusForbidden)
+		c.do(http.MethodGet, "/banner", "", nil, nil, http.StatusUnauthorized)
+	})
+
+	c.run("user banner", func(t *testing.T) {
+		rec := c.do(http.MethodGet, userBanner, userToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, userBanner, userToken, nil, http.Header{"If-None-Match": {rec.Header().Get("ETag")}}, http.StatusNotModified)
+		c.do(http.MethodGet, userBanner+"&use_last_revision=true", userToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/user_banner?feature_id=999&tag_id=999", userToken, nil, nil, http.StatusNotFound)
+		c.do(http.MethodGet, "/user_banner?feature_id=1", userToken, nil, nil, http.StatusBadRequest)
+	})
+
+	c.run("update banner", func(t *testing.T) {
+		update := map[string]any{
+			"tag_ids":    []int{tagID},
+			"feature_id": featureID,
+			"content":    map[string]any{"title": "Hello"},
+			"is_active":  true,
+			"version":    1,
+		}
+		rec := c.do(http.MethodPatch, bannerPath, adminToken, update, nil, http.StatusOK)
+		if decodeBanner(t, rec).Version != 2 || rec.Header().Get("ETag") == "" {
+			t.Fatalf("update did not bump the version: %s %s", rec.Header().Get("ETag"), rec.Body)
+		}
+		c.do(http.MethodPatch, "/banner/999", adminToken, update, nil, http.StatusNotFound)
+
+		// update still carries version 1, which is stale now.
+		rec = c.do(http.MethodPatch, bannerPath, adminToken, update, nil, http.StatusPreconditionFailed)
+		var problem struct {
+			CurrentVersion int64 `json:"current_version"`
+		}
+		if json.Unmarshal(rec.Body.Bytes(), &problem); problem.CurrentVersion != 2 {
+			t.Fatalf("412 current_version = %d, want 2", problem.CurrentVersion)
+		}
+		c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"is_active": true}, nil, http.StatusPreconditionRequired)
+
+		etag = rec.Header().Get("ETag")
+		patchHeader := func(contentType string) http.Header {
+			return http.Header{"Content-Type": {contentType}, "If-Match": {etag}}
+		}
+
+		rec = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{
+			"is_active": false,
+			"content":   map[string]any{"text": "Hi", "title": nil},
+		}, patchHeader("application/merge-patch+json"), http.StatusOK)
+		patched, etag = decodeBanner(t, rec), rec.Header().Get("ETag")
+		if patched.IsActive || patched.Content["text"] != "Hi" || patched.Content["title"] != nil || patched.FeatureID != featureID {
+			t.Fatalf("after merge patch = %+v", patched)
+		}
+		rec = c.do(http.MethodPatch, bannerPath, adminToken, []map[string]any{
+			{"op": "test", "path": "/content/text", "value": "Hi"},
+			{"op": "replace", "path": "/content/text", "value": "Hello"},
+		}, patchHeader("application/json-patch+json"), http.StatusOK)
+		patched, etag = decodeBanner(t, rec), rec.Header().Get("ETag")
+		if patched.Content["text"] != "Hello" || len(patched.TagIDs) != 1 {
+			t.Fatalf("after JSON patch = %+v", patched)
+		}
+		c.do(http.MethodPatch, bannerPath, adminToken, []map[string]any{{"op": "test", "path": "/content/text", "value": "Hi"}}, patchHeader("application/json-patch+json"), http.StatusConflict)
+		c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"feature_id": nil}, patchHeader("application/merge-patch+json"), http.StatusBadRequest)
+		c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"is_active": true}, patchHeader("text/plain"), http.StatusUnsupportedMediaType)
+	})
+
+	// Edits go to the draft; users see the published banner until it is
+	// published.
+	c.run("drafts", func(t *testing.T) {
+		rec := c.do(http.MethodGet, userBanner+"&use_last_revision=true", userToken, nil, nil, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "Welcome") {
+			t.Fatalf("user banner with a draft = %s, want the published content", rec.Body)
+		}
+		if published := decodeBanner(t, c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK)); !published.HasDraft || published.Content["title"] != "Welcome" {
+			t.Fatalf("GET %s with a draft = %+v, want the published banner", bannerPath, published)
+		}
+		draftPath := bannerPath + "/draft"
+		if draft := decodeBanner(t, c.do(http.MethodGet, draftPath, adminToken, nil, nil, http.StatusOK)); draft.Content["text"] != "Hello" || draft.Version != patched.Version {
+			t.Fatalf("GET %s = %+v, want the patched draft", draftPath, draft)
+		}
+		c.do(http.MethodGet, "/banner/999/draft", adminToken, nil, nil, http.StatusNotFound)
+
+		c.do(http.MethodPost, publishPath, adminToken, nil, nil, http.StatusPreconditionRequired)
+		c.do(http.MethodPost, publishPath, adminToken, map[string]any{"version": 1}, nil, http.StatusPreconditionFailed)
+		c.do(http.MethodPost, publishPath, userToken, nil, http.Header{"If-Match": {etag}}, http.StatusForbidden)
+		rec = c.do(http.MethodPost, publishPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusOK)
+		published := decodeBanner(t, rec)
+		etag = rec.Header().Get("ETag")
+		if published.HasDraft || published.Content["text"] != "Hello" || published.Version != patched.Version+1 {
+			t.Fatalf("published banner = %+v", published)
+		}
+		rec = c.do(http.MethodGet, userBanner, userToken, nil, nil, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "Hello") {
+			t.Fatalf("user banner after publish = %s, want the draft content", rec.Body)
+		}
+		c.do(http.MethodPost, publishPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusConflict)
+		c.do(http.MethodGet, draftPath, adminToken, nil, nil, http.StatusNotFound)
+
+		rec = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"content": map[string]any{"text": "Discarded"}}, http.Header{"If-Match": {etag}}, http.StatusOK)
+		etag = rec.Header().Get("ETag")
+		c.do(http.MethodDelete, draftPath, adminToken, nil, nil, http.StatusPreconditionRequired)
+		c.do(http.MethodDelete, draftPath, adminToken, map[string]any{"version": 1}, nil, http.StatusPreconditionFailed)
+		c.do(http.MethodDelete, draftPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusNoContent)
+		rec = c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK)
+		if discarded := decodeBanner(t, rec); discarded.HasDraft || discarded.Content["text"] != "Hello" {
+			t.Fatalf("banner after discarding the draft = %+v", discarded)
+		}
+		etag = rec.Header().Get("ETag")
+		c.do(http.MethodDelete, draftPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusNotFound)
+
+		// A draft that would take the place of another banner is not published.
+		etag = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"tag_ids": []int{otherTagID}}, http.Header{"If-Match": {etag}}, http.StatusOK).Header().Get("ETag")
+		if rec = c.do(http.MethodPost, publishPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusConflict); !strings.Contains(rec.Body.String(), fmt.Sprintf("banner %d", created.ID)) {
+			t.Fatalf("publish of a conflicting draft = %s", rec.Body)
+		}
+		c.do(http.MethodDelete, draftPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusNoContent)
+		etag = c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK).Header().Get("ETag")
+	})
+
+	// With approval required, drafts are published by another admin
+	// approving a change request.
+	c.run("change requests", func(t *testing.T) {
+		c.do(http.MethodPatch, featurePath, adminToken, map[string]any{}, nil, http.StatusBadRequest)
+		if !strings.Contains(c.do(http.MethodPatch, featurePath, adminToken, map[string]any{"requires_approval": true}, nil, http.StatusOK).Body.String(), `"requires_approval":true`) {
+			t.Fatal("feature does not require approval after PATCH")
+		}
+		rec := c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"content": map[string]any{"text": "Approved"}}, http.Header{"If-Match": {etag}}, http.StatusOK)
+		etag = rec.Header().Get("ETag")
+		if !strings.Contains(c.do(http.MethodPost, publishPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusConflict).Body.String(), "approval_required") {
+			t.Fatal("publish of a feature that requires approval is not approval_required")
+		}
+		changesPath := bannerPath + "/change_requests"
+		c.do(http.MethodPost, changesPath, adminToken, nil, nil, http.StatusPreconditionRequired)
+		c.do(http.MethodPost, changesPath, adminToken, map[string]any{"version": 1}, nil, http.StatusPreconditionFailed)
+		rec = c.do(http.MethodPost, changesPath, adminToken, map[string]any{"comment": "New text"}, http.Header{"If-Match": {etag}}, http.StatusCreated)
+		change := decodeChangeRequest(t, rec)
+		if change.Status != models.ChangeRequestPending || change.Author != "admin" || change.Content["text"] != "Approved" {
+			t.Fatalf("created change request = %+v", change)
+		}
+		c.do(http.MethodPost, changesPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusConflict)
+		if !strings.Contains(c.do(http.MethodGet, "/change_requests?status=pending", adminToken, nil, nil, http.StatusOK).Body.String(), `"author":"admin"`) {
+			t.Fatal("pending change requests do not list the created one")
+		}
+		c.do(http.MethodGet, "/change_requests?status=open", adminToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodGet, "/change_requests", userToken, nil, nil, http.StatusForbidden)
+		changePath := fmt.Sprintf("/change_requests/%d", change.ID)
+		c.do(http.MethodGet, changePath, adminToken, nil, nil, http.StatusOK)
+		c.do(http.MethodGet, "/change_requests/999", adminToken, nil, nil, http.StatusNotFound)
+
+		c.do(http.MethodPost, changePath+"/approve", adminToken, nil, nil, http.StatusForbidden)
+		rec = c.do(http.MethodPost, changePath+"/approve", reviewerToken, map[string]any{"comment": "LGTM"}, nil, http.StatusOK)
+		if approved := decodeChangeRequest(t, rec); approved.Status != models.ChangeRequestApproved || approved.Reviewer != "reviewer" || approved.ReviewedAt == nil {
+			t.Fatalf("approved change request = %+v", approved)
+		}
+		if rec = c.do(http.MethodGet, userBanner, userToken, nil, nil, http.StatusOK); !strings.Contains(rec.Body.String(), "Approved") {
+			t.Fatalf("user banner after approval = %s, want the approved content", rec.Body)
+		}
+		c.do(http.MethodPost, changePath+"/approve", reviewerToken, nil, nil, http.StatusConflict)
+		c.do(http.MethodPost, changePath+"/reject", reviewerToken, nil, nil, http.StatusConflict)
+		c.do(http.MethodPost, "/change_requests/999/approve", reviewerToken, nil, nil, http.StatusNotFound)
+
+		// A change request made stale by a later edit cannot be approved; its
+		// author withdraws it by rejecting it.
+		etag = c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK).Header().Get("ETag")
+		etag = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"is_active": false}, http.Header{"If-Match": {etag}}, http.StatusOK).Header().Get("ETag")
+		change = decodeChangeRequest(t, c.do(http.MethodPost, changesPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusCreated))
+		changePath = fmt.Sprintf("/change_requests/%d", change.ID)
+		etag = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"is_active": true}, http.Header{"If-Match": {etag}}, http.StatusOK).Header().Get("ETag")
+		c.do(http.MethodPost, changePath+"/approve", reviewerToken, nil, nil, http.StatusConflict)
+		if rejected := decodeChangeRequest(t, c.do(http.MethodPost, changePath+"/reject", adminToken, map[string]any{"comment": "Stale"}, nil, http.StatusOK)); rejected.Status != models.ChangeRequestRejected {
+			t.Fatalf("rejected change request = %+v", rejected)
+		}
+		c.do(http.MethodPost, "/change_requests/999/reject", adminToken, nil, nil, http.StatusNotFound)
+
+		// Nor is a change request that would take the place of another banner
+		// approved.
+		etag = c.do(http.MethodPatch, bannerPath, adminToken, map[string]any{"tag_ids": []int{otherTagID}}, http.Header{"If-Match": {etag}}, http.StatusOK).Header().Get("ETag")
+		change = decodeChangeRequest(t, c.do(http.MethodPost, changesPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusCreated))
+		changePath = fmt.Sprintf("/change_requests/%d", change.ID)
+		if rec = c.do(http.MethodPost, changePath+"/approve", reviewerToken, nil, nil, http.StatusConflict); !strings.Contains(rec.Body.String(), fmt.Sprintf("banner %d", created.ID)) {
+			t.Fatalf("approval of a conflicting change request = %s", rec.Body)
+		}
+		c.do(http.MethodPost, changePath+"/reject", adminToken, nil, nil, http.StatusOK)
+
+		// An import submits the drafts it saves for such banners for approval.
+		reviewed := decodeBanner(t, c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK))
+		row := fmt.Sprintf(`{"banner_id": %d, "version": %d, "feature_id": %d, "tag_ids": [%d], "content": {"text": "Imported"}, "is_active": true}`,
+			bannerID, reviewed.Version, featureID, tagID)
+		report := decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, row, http.Header{"Content-Type": {"application/x-ndjson"}}, http.StatusOK))
+		if report.Updated != 1 || report.Rows[0].ChangeRequestID == 0 {
+			t.Fatalf("import of a banner that requires approval report = %+v", report)
+		}
+		changePath = fmt.Sprintf("/change_requests/%d", report.Rows[0].ChangeRequestID)
+		if imported := decodeChangeRequest(t, c.do(http.MethodGet, changePath, adminToken, nil, nil, http.StatusOK)); imported.Status != models.ChangeRequestPending || imported.Content["text"] != "Imported" {
+			t.Fatalf("change request of the import = %+v", imported)
+		}
+		row = strings.Replace(row, fmt.Sprintf(`"version": %d`, reviewed.Version), fmt.Sprintf(`"version": %d`, reviewed.Version+1), 1)
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, row, http.Header{"Content-Type": {"application/x-ndjson"}}, http.StatusOK))
+		if report.Failed != 1 || !strings.Contains(report.Rows[0].Error, "pending change request") {
+			t.Fatalf("import of a banner with a pending change request report = %+v", report)
+		}
+		c.do(http.MethodPost, changePath+"/reject", reviewerToken, nil, nil, http.StatusOK)
+		c.do(http.MethodPatch, featurePath, adminToken, map[string]any{"requires_approval": false, "comment": "Campaign is over"}, nil, http.StatusOK)
+		c.do(http.MethodPatch, featurePath, adminToken, map[string]any{"name": "onboarding"}, nil, http.StatusOK)
+		etag = c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusOK).Header().Get("ETag")
+
+		// Only changes of the flag are recorded, newest first.
+		var history features.ResponseFeatureApprovalChanges
+		rec = c.do(http.MethodGet, featurePath+"/approval_changes", adminToken, nil, nil, http.StatusOK)
+		if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Items) != 2 || history.Items[0].RequiresApproval || history.Items[0].Comment != "Campaign is over" ||
+			!history.Items[1].RequiresApproval || history.Items[1].ChangedBy != "admin" {
+			t.Fatalf("approval changes = %+v", history.Items)
+		}
+		c.do(http.MethodGet, featurePath+"/approval_changes", userToken, nil, nil, http.StatusForbidden)
+	})
+
+	c.run("trash", func(t *testing.T) {
+		c.do(http.MethodDelete, bannerPath, adminToken, nil, nil, http.StatusPreconditionRequired)
+		c.do(http.MethodDelete, bannerPath, adminToken, map[string]any{"version": 1}, nil, http.StatusPreconditionFailed)
+		c.do(http.MethodDelete, bannerPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusNoContent)
+		c.do(http.MethodDelete, bannerPath, adminToken, nil, http.Header{"If-Match": {etag}}, http.StatusNotFound)
+		c.do(http.MethodDelete, "/banner/abc", adminToken, nil, nil, http.StatusBadRequest)
+
+		c.do(http.MethodGet, userBanner, userToken, nil, nil, http.StatusNotFound)
+		c.do(http.MethodGet, bannerPath, adminToken, nil, nil, http.StatusNotFound)
+		trash := decodePage(t, c.do(http.MethodGet, "/banner/trash?limit=10", adminToken, nil, nil, http.StatusOK))
+		if len(trash.Items) != 1 || trash.Items[0].ID != bannerID || trash.Items[0].DeletedAt == nil {
+			t.Fatalf("trash = %+v", trash)
+		}
+		c.do(http.MethodGet, "/banner/trash?limit=0", adminToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodGet, "/banner/trash", userToken, nil, nil, http.StatusForbidden)
+		restorePath := bannerPath + "/restore"
+		c.do(http.MethodPost, restorePath, adminToken, nil, nil, http.StatusPreconditionRequired)
+		// While the banner is in the trash another one can take its place.
+		rec := c.do(http.MethodPost, "/banner", adminToken, map[string]any{"tag_ids": []int{tagID}, "feature_id": featureID, "content": map[string]any{}, "is_active": true}, nil, http.StatusCreated)
+		substitutePath := fmt.Sprintf("/banner/%d", decodeBanner(t, rec).ID)
+		c.do(http.MethodPost, restorePath, adminToken, map[string]any{"version": trash.Items[0].Version}, nil, http.StatusConflict)
+		c.do(http.MethodDelete, substitutePath, adminToken, nil, http.Header{"If-Match": {rec.Header().Get("ETag")}}, http.StatusNoContent)
+		c.do(http.MethodPost, restorePath, adminToken, map[string]any{"version": 1}, nil, http.StatusPreconditionFailed)
+		rec = c.do(http.MethodPost, restorePath, adminToken, map[string]any{"version": trash.Items[0].Version}, nil, http.StatusOK)
+		if restored := decodeBanner(t, rec); restored.ID != bannerID || restored.Version != trash.Items[0].Version+1 || len(restored.TagIDs) != 1 {
+			t.Fatalf("restored banner = %+v", restored)
+		}
+		c.do(http.MethodPost, restorePath, adminToken, map[string]any{"version": trash.Items[0].Version}, nil, http.StatusNotFound)
+		c.do(http.MethodGet, userBanner, userToken, nil, nil, http.StatusOK)
+		restoredETag = rec.Header().Get("ETag")
+	})
+
+	// The clone to the banner's own feature and tag conflicts with the
+	// banner, the ones with a missing tag are invalid; the rest is created.
+	c.run("clone", func(t *testing.T) {
+		campaignID = decodeID(t, c.do(http.MethodPost, "/features", adminToken, map[string]string{"name": "campaign"}, nil, http.StatusCreated), "feature_id")
+		clonePath := bannerPath + "/clone"
+		cloneReq := map[string]any{"feature_ids": []int{featureID, campaignID}, "tag_sets": [][]int{{tagID}, {999}}, "disabled": true}
+		clones := decodeClone(t, c.do(http.MethodPost, clonePath, adminToken, cloneReq, nil, http.StatusOK))
+		if clones.Created != 1 || clones.Conflicts != 1 || clones.Invalid != 2 || len(clones.Results) != 4 ||
+			clones.Results[0].ConflictingBannerID != bannerID || clones.Results[2].Status != banners.CloneCreated {
+			t.Fatalf("clone report = %+v", clones)
+		}
+		clone := decodeBanner(t, c.do(http.MethodGet, fmt.Sprintf("/banner/%d", clones.Results[2].BannerID), adminToken, nil, nil, http.StatusOK))
+		if clone.FeatureID != campaignID || clone.IsActive || clone.Content["text"] != "Approved" {
+			t.Fatalf("clone = %+v", clone)
+		}
+		clones = decodeClone(t, c.do(http.MethodPost, clonePath, adminToken, map[string]any{"feature_ids": []int{campaignID}}, nil, http.StatusOK))
+		if clones.Conflicts != 1 || clones.Results[0].ConflictingBannerID != clone.ID {
+			t.Fatalf("repeated clone report = %+v", clones)
+		}
+		c.do(http.MethodPost, clonePath, adminToken, map[string]any{}, nil, http.StatusBadRequest)
+		c.do(http.MethodPost, clonePath, adminToken, map[string]any{"tag_sets": [][]int{{}}}, nil, http.StatusBadRequest)
+		c.do(http.MethodPost, "/banner/999/clone", adminToken, cloneReq, nil, http.StatusNotFound)
+		c.do(http.MethodPost, clonePath, userToken, cloneReq, nil, http.StatusForbidden)
+		c.do(http.MethodDelete, fmt.Sprintf("/banner/%d", clone.ID), adminToken, map[string]any{"version": clone.Version}, nil, http.StatusNoContent)
+
+		localizedPath = fmt.Sprintf("/user_banner?feature_id=%d&tag_id=%d", campaignID, otherTagID)
+	})
+
+	// Users get the content variant that matches their languages best, the
+	// default content if none does.
+	c.run("locales", func(t *testing.T) {
+		localized := decodeBanner(t, c.do(http.MethodPost, "/banner", adminToken, map[string]any{
+			"tag_ids":        []int{otherTagID},
+			"feature_id":     campaignID,
+			"content":        map[string]any{"title": "Распродажа"},
+			"default_locale": "ru",
+			"locales":        map[string]any{"en-us": map[string]any{"title": "Sale"}, "de": map[string]any{"title": "Angebot"}},
+			"is_active":      true,
+		}, nil, http.StatusCreated))
+		if localized.DefaultLocale != "ru" || localized.Locales["en-US"]["title"] != "Sale" {
+			t.Fatalf("localized banner = %+v", localized)
+		}
+		rec := c.do(http.MethodGet, localizedPath+"&lang=de-AT", userToken, nil, nil, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "Angebot") || rec.Header().Get("Content-Language") != "de" || !strings.Contains(rec.Header().Get("Vary"), "Accept-Language") {
+			t.Fatalf("user banner for de-AT = %s %v", rec.Body, rec.Header())
+		}
+		germanETag := rec.Header().Get("ETag")
+		rec = c.do(http.MethodGet, localizedPath, userToken, nil, http.Header{"Accept-Language": {"fr-CH, en;q=0.8"}}, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "Sale") || rec.Header().Get("Content-Language") != "en-US" {
+			t.Fatalf("user banner for Accept-Language fr-CH, en = %s %v", rec.Body, rec.Header())
+		}
+		rec = c.do(http.MethodGet, localizedPath+"&lang=fr", userToken, nil, http.Header{"If-None-Match": {germanETag}}, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), "Распродажа") || rec.Header().Get("Content-Language") != "ru" {
+			t.Fatalf("user banner for fr = %s %v", rec.Body, rec.Header())
+		}
+		c.do(http.MethodGet, localizedPath+"&lang=de", userToken, nil, http.Header{"If-None-Match": {germanETag}}, http.StatusNotModified)
+		c.do(http.MethodGet, localizedPath+"&lang=!", userToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodPost, "/banner", adminToken, map[string]any{
+			"tag_ids": []int{otherTagID}, "feature_id": campaignID, "content": map[string]any{}, "is_active": true,
+			"locales": map[string]any{"en_US!": map[string]any{}},
+		}, nil, http.StatusBadRequest)
+		rec = c.do(http.MethodPatch, fmt.Sprintf("/banner/%d", localized.ID), adminToken, map[string]any{"locales": map[string]any{"de": nil}, "version": localized.Version},
+			http.Header{"Content-Type": {"application/merge-patch+json"}}, http.StatusOK)
+		if draft := decodeBanner(t, rec); len(draft.Locales) != 1 || draft.Locales["en-US"] == nil {
+			t.Fatalf("draft after removing de = %+v", draft)
+		}
+		c.do(http.MethodDelete, fmt.Sprintf("/banner/%d", localized.ID), adminToken, nil, http.Header{"If-Match": {rec.Header().Get("ETag")}}, http.StatusNoContent)
+	})
+
+	// Targeting: the most specific banner the client matches wins.
+	c.run("targeting", func(t *testing.T) {
+		targetedETags := map[int]string{}
+		for _, targeted := range []map[string]any{
+			{"content": map[string]any{"title": "all"}},
+			{"content": map[string]any{"title": "mobile"}, "platforms": []string{"ios", "android", "ios"}},
+			{"content": map[string]any{"title": "new-ios"}, "platforms": []string{"ios"}, "app_version": ">=7.2 <8"},
+			{"content": map[string]any{"title": "kz"}, "rule": ` country == "KZ" and days_since_signup > 7 `},
+		} {
+			targeted["tag_ids"], targeted["feature_id"], targeted["is_active"] = []int{otherTagID}, campaignID, true
+			rec := c.do(http.MethodPost, "/banner", adminToken, targeted, nil, http.StatusCreated)
+			banner := decodeBanner(t, rec)
+			targetedETags[banner.ID] = rec.Header().Get("ETag")
+			if title := banner.Content["title"]; title == "mobile" && !slices.Equal(banner.Platforms, []string{"android", "ios"}) ||
+				title == "kz" && banner.Rule != `country == "KZ" and days_since_signup > 7` {
+				t.Fatalf("targeted banner = %+v, want normalized targeting", banner)
+			}
+		}
+		for _, tt := range []struct {
+			query  string
+			header http.Header
+			want   string
+		}{
+			{query: "&platform=ios&app_version=7.3.0", want: "new-ios"},
+			{header: http.Header{"X-Platform": {"ios"}, "X-App-Version": {"7.1"}}, want: "mobile"},
+			{query: "&platform=android&app_version=7.3.0", want: "mobile"},
+			{header: http.Header{"X-Platform": {"ios"}, "X-App-Version": {"not a version"}}, want: "mobile"},
+			{query: "&platform=web", want: "all"},
+			{want: "all"},
+			{query: "&attr[country]=KZ&attr[days_since_signup]=10", want: "kz"},
+			{query: "&platform=web&attr[country]=KZ&attr[days_since_signup]=10", want: "kz"},
+			{query: "&attr[country]=KZ&attr[days_since_signup]=3", want: "all"},
+			{query: "&attr[country]=KZ", want: "all"},
+		} {
+			rec := c.do(http.MethodGet, localizedPath+tt.query, userToken, nil, tt.header, http.StatusOK)
+			if !strings.Contains(rec.Body.String(), `"`+tt.want+`"`) || !strings.Contains(rec.Header().Get("Vary"), "X-App-Version") {
+				t.Fatalf("user banner for %s %v = %s %v, want %s", tt.query, tt.header, rec.Body, rec.Header(), tt.want)
+			}
+		}
+		c.do(http.MethodGet, localizedPath+"&platform=tv", userToken, nil, nil, http.StatusBadRequest)
+		c.do(http.MethodGet, localizedPath+"&app_version=seven", userToken, nil, nil, http.StatusBadRequest)
+		for _, invalid := range []map[string]any{{"platforms": []string{"tv"}}, {"app_version": "=>7"}} {
+			invalid["tag_ids"], invalid["feature_id"], invalid["content"], invalid["is_active"] = []int{otherTagID}, campaignID, map[string]any{}, true
+			c.do(http.MethodPost, "/banner", adminToken, invalid, nil, http.StatusBadRequest)
+		}
+		invalidRule := map[string]any{"tag_ids": []int{otherTagID}, "feature_id": campaignID, "content": map[string]any{}, "is_active": true, "rule": "country == KZ"}
+		if rec := c.do(http.MethodPost, "/banner", adminToken, invalidRule, nil, http.StatusBadRequest); !strings.Contains(rec.Body.String(), "column 12") {
+			t.Fatalf("invalid rule response = %s, want the column of the error", rec.Body)
+		}
+		for id, tag := range targetedETags {
+			c.do(http.MethodDelete, fmt.Sprintf("/banner/%d", id), adminToken, nil, http.Header{"If-Match": {tag}}, http.StatusNoContent)
+		}
+	})
+
+	// Templating: placeholders are filled from whitelisted attributes.
+	c.run("templates", func(t *testing.T) {
+		templated := map[string]any{
+			"tag_ids": []int{otherTagID}, "feature_id": campaignID, "is_active": true,
+			"content":  map[string]any{"title": "Hi {{ name | 'friend' }}, cashback {{amount}}%", "link": "/promo"},
+			"locales":  map[string]any{"en": map[string]any{"title": "Hello {{ name }}"}},
+			"template": map[string]any{"variables": []string{"name", "amount"}, "on_missing": "error"},
+		}
+		rec := c.do(http.MethodPost, "/banner", adminToken, templated, nil, http.StatusCreated)
+		templatedBanner := decodeBanner(t, rec)
+		if templatedBanner.Template == nil || templatedBanner.Template.Escape != "html" {
+			t.Fatalf("templated banner = %+v, want the default escaping", templatedBanner)
+		}
+		rec = c.do(http.MethodGet, localizedPath+"&attr[name]=%3CAnn%3E&attr[amount]=5&attr[country]=KZ", userToken, nil, nil, http.StatusOK)
+		var rendered map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &rendered)
+		if rendered["title"] != "Hi &lt;Ann&gt;, cashback 5%" || rendered["link"] != "/promo" {
+			t.Fatalf("templated user banner = %s", rec.Body)
+		}
+		rec = c.do(http.MethodGet, localizedPath+"&attr[name]=Ann", userToken, nil, nil, http.StatusUnprocessableEntity)
+		if !strings.Contains(rec.Body.String(), "missing_variables") || !strings.Contains(rec.Body.String(), "amount") {
+			t.Fatalf("user banner without amount = %s", rec.Body)
+		}
+		rec = c.do(http.MethodGet, localizedPath+"&attr[name]=Ann", userToken, nil, http.Header{"Accept-Language": {"en"}}, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), `"Hello Ann"`) {
+			t.Fatalf("localized templated user banner = %s", rec.Body)
+		}
+		for _, invalid := range []map[string]any{
+			{"content": map[string]any{"title": "Hi {{ city }}"}, "template": map[string]any{"variables": []string{"name"}}},
+			{"content": map[string]any{"title": "Hi {{ name"}, "template": map[string]any{"variables": []string{"name"}}},
+		} {
+			invalid["tag_ids"], invalid["feature_id"], invalid["is_active"] = []int{otherTagID}, campaignID, true
+			if rec = c.do(http.MethodPost, "/banner", adminToken, invalid, nil, http.StatusBadRequest); !strings.Contains(rec.Body.String(), "template: content/title") {
+				t.Fatalf("invalid template response = %s", rec.Body)
+			}
+		}
+		rec = c.do(http.MethodPatch, fmt.Sprintf("/banner/%d", templatedBanner.ID), adminToken, map[string]any{"template": nil, "version": templatedBanner.Version},
+			http.Header{"Content-Type": {"application/merge-patch+json"}}, http.StatusOK)
+		if draft := decodeBanner(t, rec); draft.Template != nil {
+			t.Fatalf("draft after removing the template = %+v", draft)
+		}
+		c.do(http.MethodDelete, fmt.Sprintf("/banner/%d", templatedBanner.ID), adminToken, nil, http.Header{"If-Match": {rec.Header().Get("ETag")}}, http.StatusNoContent)
+	})
+
+	c.run("import", func(t *testing.T) {
+		// The banner would conflict with the banner of the CSV rows.
+		c.do(http.MethodDelete, bannerPath, adminToken, nil, http.Header{"If-Match": {restoredETag}}, http.StatusNoContent)
+
+		ndjson := http.Header{"Content-Type": {"application/x-ndjson"}}
+		rows := fmt.Sprintf(`{"banner_id": %d, "version": %d, "feature_id": %d, "tag_ids": [%d], "content": {"title": "Imported"}, "is_active": true}
+{"feature_id": %d, "tag_ids": [], "content": {"title": "New"}, "is_active": true}
+
+{"feature_id": "one"}
+`, created.ID, created.Version, featureID, tagID, featureID)
+		report := decodeImport(t, c.do(http.MethodPost, "/banner/import?mode=validate", adminToken, rows, ndjson, http.StatusOK))
+		if report.Invalid != 1 || report.Rows[0].Status != "valid" || report.Rows[2].Row != 4 || report.Rows[2].Status != "invalid" {
+			t.Fatalf("validate report = %+v", report)
+		}
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, rows, ndjson, http.StatusOK))
+		if report.Created+report.Updated != 0 || report.Rows[1].Status != "skipped" {
+			t.Fatalf("atomic import with an invalid row saved rows: %+v", report)
+		}
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import?chunk_size=1", adminToken, rows, ndjson, http.StatusOK))
+		if report.Updated != 1 || report.Created != 1 || report.Rows[0].BannerID != created.ID {
+			t.Fatalf("chunked import report = %+v", report)
+		}
+		// The row for the existing banner became its draft.
+		createdPath := fmt.Sprintf("/banner/%d", created.ID)
+		if draft := decodeBanner(t, c.do(http.MethodGet, createdPath+"/draft", adminToken, nil, nil, http.StatusOK)); draft.Content["title"] != "Imported" || !draft.IsActive {
+			t.Fatalf("imported draft = %+v", draft)
+		}
+		current := decodeBanner(t, c.do(http.MethodGet, createdPath, adminToken, nil, nil, http.StatusOK))
+		if current.Content["title"] != "Welcome" || !current.HasDraft {
+			t.Fatalf("import changed the published banner: %+v", current)
+		}
+		// The same rows are now out of date, and rows for banners need a version.
+		stale := fmt.Sprintf(`{"banner_id": %d, "version": %d, "feature_id": %d, "tag_ids": [], "content": {}, "is_active": true}
+{"banner_id": %d, "feature_id": %d, "tag_ids": [], "content": {}, "is_active": true}
+`, created.ID, created.Version, featureID, created.ID, featureID)
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, stale, ndjson, http.StatusOK))
+		if report.Failed != 1 || report.Rows[0].CurrentVersion != current.Version || report.Invalid != 1 || !strings.Contains(report.Rows[1].Error, "version is required") {
+			t.Fatalf("import of stale rows report = %+v", report)
+		}
+
+		// New rows that would take the place of a banner or of each other
+		// are conflicts; the rest of their transaction is not saved.
+		conflicting := fmt.Sprintf(`{"feature_id": %d, "tag_ids": [%d], "content": {}, "is_active": true}
+{"feature_id": %d, "tag_ids": [%d], "content": {}, "platforms": ["web"], "is_active": true}
+`, featureID, otherTagID, featureID, tagID)
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, conflicting, ndjson, http.StatusOK))
+		if report.Conflicts != 1 || report.Rows[0].Status != banners.ImportRowConflict || report.Rows[0].ConflictingBannerID != created.ID ||
+			report.Rows[1].Status != banners.ImportRowFailed || report.Created != 0 {
+			t.Fatalf("import of a row conflicting with a banner report = %+v", report)
+		}
+		duplicates := strings.Repeat(strings.SplitAfter(conflicting, "\n")[1], 2)
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import", adminToken, duplicates, ndjson, http.StatusOK))
+		if report.Conflicts != 1 || report.Rows[1].Status != banners.ImportRowConflict || report.Rows[1].ConflictingBannerID != 0 ||
+			report.Rows[0].Status != banners.ImportRowFailed {
+			t.Fatalf("import of conflicting rows report = %+v", report)
+		}
+
+		csvRows := fmt.Sprintf("feature_id,tag_ids,content,is_active\n%d,[%d],\"{\"\"title\"\":\"\"CSV\"\"}\",false\n%d,x,{},true\n", featureID, tagID, featureID)
+		report = decodeImport(t, c.do(http.MethodPost, "/banner/import?chunk_size=10", adminToken, csvRows, http.Header{"Content-Type": {"text/csv"}}, http.StatusOK))
+		if report.Created != 1 || report.Invalid != 1 || report.Rows[1].Row != 3 {
+			t.Fatalf("CSV import report = %+v", report)
+		}
+		c.do(http.MethodPost, "/banner/import", adminToken, "banner_id\n1\n", http.Header{"Content-Type": {"text/csv"}}, http.StatusBadRequest)
+		c.do(http.MethodPost, "/banner/import", userToken, rows, ndjson, http.StatusForbidden)
+	})
+
+	c.run("export", func(t *testing.T) {
+		rec := c.do(http.MethodGet, "/banner/export", adminToken, nil, nil, http.StatusOK)
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		var exported banners.ExportedBanner
+		if len(lines) != 3 || json.Unmarshal([]byte(lines[0]), &exported) != nil ||
+			exported.ID != created.ID || exported.FeatureName == nil || *exported.FeatureName != "onboarding" || exported.TagNames[0] != "returning-users" || !exported.HasDraft {
+			t.Fatalf("export = %s", rec.Body)
+		}
+		rec = c.do(http.MethodGet, "/banner/export?format=csv", adminToken, nil, nil, http.StatusOK)
+		if !strings.HasPrefix(rec.Body.String(), "banner_id,feature_id,feature_name,") || strings.Count(rec.Body.String(), "\n") != 4 {
+			t.Fatalf("CSV export = %s", rec.Body)
+		}
+		c.do(http.MethodGet, "/banner/export?format=xml", adminToken, nil, nil, http.StatusBadRequest)
+	})
+
+	var missing []string
+	for path, item := range c.spec.Paths.Map() {
+		for method := range item.Operations() {
+			if !c.covered[method+" "+path] {
+				missing = append(missing, method+" "+path)
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("operations not exercised by the contract test: %s", strings.Join(missing, ", "))
+	}
+}
+
+// TestRoutesDocumented fails when a route is added to the router but not to
+// the spec.
+func TestRoutesDocumented(t *testing.T) {
+	c := newContract(t)
+
+	documented := make(map[string]bool)
+	for path, item := range c.spec.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	err := chi.Walk(c.handler.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route == "/debug/vars" {
+			return nil
+		}
+		if !documented[method+" "+route] {
+			t.Errorf("%s %s is not documented in api/api.yaml", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDebugVarsAdminOnly(t *testing.T) {
+	c := newContract(t)
+
+	hash, err := password.HashPassword("admin-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.store.CreateUser(context.Background(), &models.User{Username: "admin", Password: hash, Role: "admin"})
+	c.do(http.MethodPost, "/users", "", map[string]string{"name": "user", "password": "user-password"}, nil, http.StatusCreated)
+
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{c.login("user", "user-password"), http.StatusForbidden},
+		{c.login("admin", "admin-password"), http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		c.handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("GET /debug/vars with token %q: status = %d, want %d", tt.token, rec.Code, tt.want)
+		}
+	}
+}
+
+// TestTemplatesOfReusedRevisions serves banners that share an ID and version
+// but not content, as after a snapshot import or in another database, from
+// one process.
+func TestTemplatesOfReusedRevisions(t *testing.T) {
+	hash, err := password.HashPassword("admin-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, greeting := range []string{"Hi", "Bye"} {
+		c := newContract(t)
+		c.store.CreateUser(context.Background(), &models.User{Username: "admin", Password: hash, Role: "admin"})
+		token := c.login("admin", "admin-password")
+		featureID := decodeID(t, c.do(http.MethodPost, "/features", token, map[string]string{"name": "onboarding"}, nil, http.StatusCreated), "feature_id")
+		tagID := decodeID(t, c.do(http.MethodPost, "/tags", token, map[string]string{"name": "new-users"}, nil, http.StatusCreated), "tag_id")
+		banner := decodeBanner(t, c.do(http.MethodPost, "/banner", token, map[string]any{
+			"tag_ids": []int{tagID}, "feature_id": featureID, "is_active": true,
+			"content":  map[string]any{"title": greeting + " {{ name }}"},
+			"template": map[string]any{"variables": []string{"name"}},
+		}, nil, http.StatusCreated))
+
+		rec := c.do(http.MethodGet, fmt.Sprintf("/user_banner?feature_id=%d&tag_id=%d&attr[name]=Ann", featureID, tagID), token, nil, nil, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), `"`+greeting+` Ann"`) {
+			t.Errorf("banner %d version %d = %s, want %q", banner.ID, banner.Version, rec.Body, greeting+" Ann")
+		}
+	}
+}
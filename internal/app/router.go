@@ -0,0 +1,131 @@
+package app
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"banner/api"
+	"banner/internal/lib/api/middlewares"
+	jwt "banner/internal/lib/auth/jwt"
+	"banner/internal/repository/cache"
+	"banner/internal/server/handlers/banners"
+	"banner/internal/server/handlers/features"
+	"banner/internal/server/handlers/tags"
+	"banner/internal/server/handlers/users/login"
+	user "banner/internal/server/handlers/users/user"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Dependencies are what the HTTP handlers need. Repositories are interfaces,
+// so tests can pass in-memory implementations.
+type Dependencies struct {
+	Log         *slog.Logger
+	Features    features.Features
+	Tags        tags.Tag
+	Users       user.User
+	Banners     banners.Banners
+	Idempotency middlewares.IdempotencyKeys
+	Cache       *cache.Cache
+	JWT         *jwt.JWTSecret
+
+	// IdempotencyTTL is how long create responses are replayed for,
+	// IdempotencyLockTimeout how long a request in progress holds its key and
+	// IdempotencyMaxBodyBytes how large its body may be.
+	IdempotencyTTL          time.Duration
+	IdempotencyLockTimeout  time.Duration
+	IdempotencyMaxBodyBytes int64
+}
+
+// NewRouter builds the HTTP API. Requests are checked against the embedded
+// OpenAPI spec after authentication.
+func NewRouter(deps Dependencies) (http.Handler, error) {
+	spec, err := api.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	validate, err := middlewares.OpenAPIValidator(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	log := deps.Log
+	userAuth := func(next http.Handler) http.Handler {
+		return middlewares.TokenAuthMiddleware(deps.JWT, next)
+	}
+	adminAuth := func(next http.Handler) http.Handler {
+		return middlewares.TokenAuthAndRoleMiddleware(deps.JWT, next)
+	}
+
+	idempotent := middlewares.Idempotency(deps.Idempotency, log, deps.IdempotencyTTL, deps.IdempotencyLockTimeout, deps.IdempotencyMaxBodyBytes)
+
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(middleware.RealIP)
+	router.Use(middleware.Logger)
+	router.Use(middlewares.Recoverer(log))
+	router.Use(middleware.URLFormat)
+
+	router.NotFound(middlewares.NotFound)
+	router.MethodNotAllowed(middlewares.MethodNotAllowed)
+
+	// Runtime and cache stats reveal the process command line and memory,
+	// so only admins see them.
+	router.With(adminAuth).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+	router.Group(func(r chi.Router) {
+		r.Use(validate)
+
+		r.Post("/login", login.Login(log, deps.Users, deps.JWT))
+		r.With(idempotent).Post("/users", user.NewUser(log, deps.Users))
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(userAuth, validate)
+
+		r.Get("/user_banner", banners.GetBannerUser(log, deps.Banners, deps.Cache))
+		r.With(idempotent).Post("/tags", tags.NewTag(log, deps.Tags))
+		r.Get("/tags", tags.ListTags(log, deps.Tags))
+		r.Get("/tags/{id}", tags.GetTag(log, deps.Tags))
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(adminAuth, validate)
+
+		r.With(idempotent).Post("/features", features.NewFeature(log, deps.Features))
+		r.Get("/features", features.ListFeatures(log, deps.Features))
+		r.Get("/features/{id}", features.GetFeature(log, deps.Features))
+		r.Patch("/features/{id}", features.UpdateFeature(log, deps.Features))
+		r.Get("/features/{id}/approval_changes", features.ListFeatureApprovalChanges(log, deps.Features))
+		r.Delete("/features/{id}", features.DeleteFeature(log, deps.Features))
+		r.Patch("/tags/{id}", tags.UpdateTag(log, deps.Tags))
+		r.Delete("/tags/{id}", tags.DeleteTag(log, deps.Tags))
+		r.Get("/banner", banners.GetBanners(deps.Banners, log))
+		r.Get("/banner/search", banners.SearchBanners(deps.Banners, log))
+		r.Get("/banner/export", banners.ExportBanners(log, deps.Banners))
+		r.Get("/banner/trash", banners.ListTrashedBanners(deps.Banners, log))
+		r.With(idempotent).Post("/banner/import", banners.ImportBanners(log, deps.Banners, deps.Cache))
+		r.With(idempotent).Post("/banner", banners.NewBanner(log, deps.Banners, deps.Cache))
+		r.With(idempotent).Post("/banners", banners.NewBanner(log, deps.Banners, deps.Cache))
+		r.Get("/banner/{id}", banners.GetBanner(deps.Banners, log))
+		r.Patch("/banner/{id}", banners.UpdateBanner(deps.Banners, log))
+		r.Get("/banner/{id}/draft", banners.GetBannerDraft(deps.Banners, log))
+		r.Delete("/banner/{id}/draft", banners.DiscardBannerDraft(deps.Banners, log))
+		r.Post("/banner/{id}/publish", banners.PublishBanner(deps.Banners, log, deps.Cache))
+		r.Post("/banner/{id}/change_requests", banners.CreateChangeRequest(deps.Banners, log))
+		r.Get("/change_requests", banners.ListChangeRequests(deps.Banners, log))
+		r.Get("/change_requests/{id}", banners.GetChangeRequest(deps.Banners, log))
+		r.Post("/change_requests/{id}/approve", banners.ApproveChangeRequest(deps.Banners, log, deps.Cache))
+		r.Post("/change_requests/{id}/reject", banners.RejectChangeRequest(deps.Banners, log))
+		r.Post("/banner/{id}/restore", banners.RestoreBanner(deps.Banners, log, deps.Cache))
+		r.With(idempotent).Post("/banner/{id}/clone", banners.CloneBanner(deps.Banners, log, deps.Cache))
+		r.Delete("/banner/{id}", banners.DeleteBanner(log, deps.Banners, deps.Cache))
+	})
+
+	return router, nil
+}
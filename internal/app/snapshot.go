@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"banner/internal/config"
+	"banner/internal/repo"
+	"banner/internal/snapshot"
+)
+
+// SnapshotExport writes an archive of the banner configuration to out.
+func SnapshotExport(configPath string, out io.Writer) error {
+	snapshots, closeDB, err := openSnapshotRepo(configPath)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	snap, err := snapshots.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return snapshot.Write(out, snap)
+}
+
+// SnapshotImport replaces the banner configuration with the archive read
+// from in, after printing what changes to out. With dryRun the database is
+// left as it is.
+func SnapshotImport(configPath string, in io.Reader, dryRun bool, out io.Writer) error {
+	target, err := snapshot.Read(in)
+	if err != nil {
+		return err
+	}
+
+	snapshots, closeDB, err := openSnapshotRepo(configPath)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	current, err := snapshots.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "snapshot of %s, format version %d\n", target.CreatedAt.Format("2006-01-02 15:04:05 MST"), target.Version)
+	diff := snapshot.Compare(current, target)
+	diff.Print(out)
+
+	switch {
+	case dryRun:
+		fmt.Fprintln(out, "dry run, nothing changed")
+		return nil
+	case diff.Empty():
+		fmt.Fprintln(out, "database already matches the snapshot")
+		return nil
+	}
+
+	if err := snapshots.Restore(context.Background(), target); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "snapshot imported; running servers may serve cached banners until the cache TTL expires")
+
+	return nil
+}
+
+// openSnapshotRepo connects to the configured database. Logs go to stderr,
+// as stdout may carry the archive.
+func openSnapshotRepo(configPath string) (*repo.SnapshotRepo, func(), error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	db, err := setupConnectToPostgres(cfg, log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return repo.NewSnapshotRepo(db.DB, log), db.Close, nil
+}
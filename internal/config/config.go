@@ -1,64 +1,305 @@
 package config
 
 import (
-	logerr "banner/internal/lib/logger/logerr"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env      string         `yaml:"env"`
-	Server   ServerConfig   `yaml:"server"`
-	Postgres PostgresConfig `yaml:"postgres"`
-	Jwt      JwtConfig      `yaml:"jwt"`
+	Env         string            `yaml:"env" env:"ENV" env-default:"local"`
+	Server      ServerConfig      `yaml:"server"`
+	Postgres    PostgresConfig    `yaml:"postgres"`
+	Jwt         JwtConfig         `yaml:"jwt"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Trash       TrashConfig       `yaml:"trash"`
 }
 
 type ServerConfig struct {
-	Host        string        `yaml:"host"`
-	Port        string        `yaml:"port"`
-	Timeout     time.Duration `yaml:"timeout"`
-	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	Host        string        `yaml:"host" env:"SERVER_HOST" env-default:"localhost"`
+	Port        string        `yaml:"port" env:"SERVER_PORT" env-default:"8080"`
+	Timeout     time.Duration `yaml:"timeout" env:"SERVER_TIMEOUT" env-default:"4s"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" env-default:"60s"`
 }
 
 type PostgresConfig struct {
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Database string `yaml:"database"`
+	Host         string `yaml:"host" env:"POSTGRES_HOST" env-default:"localhost"`
+	Port         string `yaml:"port" env:"POSTGRES_PORT" env-default:"5432"`
+	User         string `yaml:"user" env:"POSTGRES_USER"`
+	Password     string `yaml:"password" env:"POSTGRES_PASSWORD"`
+	PasswordFile string `yaml:"password_file" env:"POSTGRES_PASSWORD_FILE"`
+	Database     string `yaml:"database" env:"POSTGRES_DB"`
+}
+
+// DSN returns the connection URL of the database. User, password and
+// database are escaped, so they may contain any characters.
+func (p PostgresConfig) DSN() string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(p.User, p.Password),
+		Host:   net.JoinHostPort(p.Host, p.Port),
+		Path:   "/" + p.Database,
+	}
+
+	return dsn.String()
 }
 
 type JwtConfig struct {
-	Secret string `yaml:"secret"`
+	Secret     string `yaml:"secret" env:"JWT_SECRET"`
+	SecretFile string `yaml:"secret_file" env:"JWT_SECRET_FILE"`
+}
+
+// CacheConfig controls the user banner cache. Entries older than TTL are
+// refreshed in the background and are served at most until HardTTL. Missing
+// feature/tag combinations are remembered for NegativeTTL.
+type CacheConfig struct {
+	TTL             time.Duration `yaml:"ttl" env:"CACHE_TTL" env-default:"5m"`
+	HardTTL         time.Duration `yaml:"hard_ttl" env:"CACHE_HARD_TTL" env-default:"1h"`
+	NegativeTTL     time.Duration `yaml:"negative_ttl" env:"CACHE_NEGATIVE_TTL" env-default:"30s"`
+	MaxEntries      int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES" env-default:"100000"`
+	Shards          int           `yaml:"shards" env:"CACHE_SHARDS" env-default:"16"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env:"CACHE_CLEANUP_INTERVAL" env-default:"1m"`
+}
+
+// IdempotencyConfig controls Idempotency-Key handling on create endpoints.
+// Responses are replayed for TTL; a request that has been in progress for
+// LockTimeout is considered abandoned and its key can be reused. Bodies of
+// requests with a key are read whole to fingerprint them, up to MaxBodyBytes.
+type IdempotencyConfig struct {
+	TTL          time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" env-default:"24h"`
+	LockTimeout  time.Duration `yaml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT" env-default:"1m"`
+	MaxBodyBytes int64         `yaml:"max_body_bytes" env:"IDEMPOTENCY_MAX_BODY_BYTES" env-default:"33554432"`
+}
+
+// TrashConfig controls deleted banners, which are purged for good Retention
+// after they are deleted.
+type TrashConfig struct {
+	Retention time.Duration `yaml:"retention" env:"TRASH_RETENTION" env-default:"720h"`
 }
 
 const (
+	// EnvConfigPath is the environment variable holding the path to the config file.
+	EnvConfigPath = "CONFIG_PATH"
+
 	localPathToConfig = "/config/config.yaml"
+	redacted          = "******"
+	minProdSecretLen  = 32
 )
 
-func LoadConfig() (*Config, error) {
-	log.Println("Start configuration setup")
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// ResolvePath returns the config path to use: the flag value if set, then
+// $CONFIG_PATH, then config/config.yaml in the working directory. It returns
+// an empty path when none is given and the default file does not exist.
+func ResolvePath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+
+	if envPath := os.Getenv(EnvConfigPath); envPath != "" {
+		return envPath
+	}
 
 	pwdPath, err := os.Getwd()
 	if err != nil {
-		log.Fatal("Can't get working directory path")
+		return ""
 	}
 
-	configPath := pwdPath + localPathToConfig
+	if _, err := os.Stat(pwdPath + localPathToConfig); err != nil {
+		return ""
+	}
+
+	return pwdPath + localPathToConfig
+}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatal("Config file does not exist ", logerr.Err(err))
+// LoadConfig reads and validates the configuration at path.
+func LoadConfig(path string) (*Config, error) {
+	log.Println("Start configuration setup")
+
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
 	}
 
-	var cfg Config
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatal("Cannot read config")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
 	log.Println("Configuration complete")
 
+	return cfg, nil
+}
+
+// Load reads the config file at path, applies environment overrides and
+// resolves secret files without validating the result. With an empty path
+// the configuration comes from the environment only.
+func Load(path string) (*Config, error) {
+	var cfg Config
+
+	if path == "" {
+		if err := cleanenv.ReadEnv(&cfg); err != nil {
+			return nil, fmt.Errorf("cannot read config from environment: %w", err)
+		}
+	} else {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+
+		if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+			return nil, fmt.Errorf("cannot read config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+func (cfg *Config) loadSecrets() error {
+	if cfg.Postgres.PasswordFile != "" {
+		password, err := readSecretFile(cfg.Postgres.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("postgres.password_file: %w", err)
+		}
+		cfg.Postgres.Password = password
+	}
+
+	if cfg.Jwt.SecretFile != "" {
+		secret, err := readSecretFile(cfg.Jwt.SecretFile)
+		if err != nil {
+			return fmt.Errorf("jwt.secret_file: %w", err)
+		}
+		cfg.Jwt.Secret = secret
+	}
+
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Validate checks the configuration and reports all problems at once.
+func (cfg *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch cfg.Env {
+	case "local", "dev", "prod":
+	default:
+		add("env must be one of local, dev, prod, got %q", cfg.Env)
+	}
+
+	if cfg.Server.Host == "" {
+		add("server.host is required")
+	}
+	if !validPort(cfg.Server.Port) {
+		add("server.port must be a number between 1 and 65535, got %q", cfg.Server.Port)
+	}
+	if cfg.Server.Timeout <= 0 {
+		add("server.timeout must be positive")
+	}
+	if cfg.Server.IdleTimeout <= 0 {
+		add("server.idle_timeout must be positive")
+	}
+
+	if cfg.Postgres.Host == "" {
+		add("postgres.host is required")
+	}
+	if !validPort(cfg.Postgres.Port) {
+		add("postgres.port must be a number between 1 and 65535, got %q", cfg.Postgres.Port)
+	}
+	if cfg.Postgres.User == "" {
+		add("postgres.user is required")
+	}
+	if cfg.Postgres.Database == "" {
+		add("postgres.database is required")
+	}
+
+	if cfg.Cache.TTL <= 0 {
+		add("cache.ttl must be positive")
+	}
+	if cfg.Cache.HardTTL < cfg.Cache.TTL {
+		add("cache.hard_ttl must not be less than cache.ttl")
+	}
+	if cfg.Cache.NegativeTTL < 0 || cfg.Cache.NegativeTTL > cfg.Cache.TTL {
+		add("cache.negative_ttl must be between 0 and cache.ttl")
+	}
+	if cfg.Cache.MaxEntries <= 0 {
+		add("cache.max_entries must be positive")
+	}
+	if cfg.Cache.Shards <= 0 || cfg.Cache.Shards > cfg.Cache.MaxEntries {
+		add("cache.shards must be between 1 and cache.max_entries")
+	}
+	if cfg.Cache.CleanupInterval <= 0 {
+		add("cache.cleanup_interval must be positive")
+	}
+
+	if cfg.Idempotency.TTL <= 0 {
+		add("idempotency.ttl must be positive")
+	}
+	if cfg.Idempotency.LockTimeout <= 0 || cfg.Idempotency.LockTimeout > cfg.Idempotency.TTL {
+		add("idempotency.lock_timeout must be between 0 and idempotency.ttl")
+	}
+	if cfg.Idempotency.MaxBodyBytes <= 0 {
+		add("idempotency.max_body_bytes must be positive")
+	}
+
+	if cfg.Trash.Retention <= 0 {
+		add("trash.retention must be positive")
+	}
+
+	switch {
+	case cfg.Jwt.Secret == "":
+		add("jwt.secret is required")
+	case cfg.Env == "prod" && len(cfg.Jwt.Secret) < minProdSecretLen:
+		add("jwt.secret must be at least %d bytes in prod", minProdSecretLen)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// Redacted returns a copy of the configuration with secrets masked.
+func (cfg Config) Redacted() Config {
+	if cfg.Postgres.Password != "" {
+		cfg.Postgres.Password = redacted
+	}
+	if cfg.Jwt.Secret != "" {
+		cfg.Jwt.Secret = redacted
+	}
+
+	return cfg
+}
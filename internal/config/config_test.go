@@ -0,0 +1,208 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func validConfig() Config {
+	return Config{
+		Env:         "local",
+		Server:      ServerConfig{Host: "localhost", Port: "8080", Timeout: 4 * time.Second, IdleTimeout: time.Minute},
+		Postgres:    PostgresConfig{Host: "localhost", Port: "5432", User: "user", Password: "password", Database: "db"},
+		Jwt:         JwtConfig{Secret: "secret"},
+		Cache:       CacheConfig{TTL: 5 * time.Minute, HardTTL: time.Hour, NegativeTTL: 30 * time.Second, MaxEntries: 100, Shards: 16, CleanupInterval: time.Minute},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour, LockTimeout: time.Minute, MaxBodyBytes: 1 << 20},
+		Trash:       TrashConfig{Retention: 720 * time.Hour},
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+env: "dev"
+server:
+  port: "8081"
+postgres:
+  host: "db.internal"
+  user: "banner"
+jwt:
+  secret: "from-file"
+`)
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(cfg *Config) bool
+	}{
+		{"file", nil, func(cfg *Config) bool {
+			return cfg.Env == "dev" && cfg.Server.Port == "8081" && cfg.Postgres.Host == "db.internal" && cfg.Jwt.Secret == "from-file"
+		}},
+		{"env over file", map[string]string{"SERVER_PORT": "9090", "JWT_SECRET": "from-env"}, func(cfg *Config) bool {
+			return cfg.Server.Port == "9090" && cfg.Jwt.Secret == "from-env" && cfg.Postgres.Host == "db.internal"
+		}},
+		{"defaults", nil, func(cfg *Config) bool {
+			return cfg.Server.Host == "localhost" && cfg.Cache.TTL == 5*time.Minute && cfg.Idempotency.MaxBodyBytes == 32<<20
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Load() = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	tests := []struct {
+		name, secret, want string
+	}{
+		{"plain", "s3cret", "s3cret"},
+		{"trailing newline", "s3cret\n", "s3cret"},
+		{"CRLF", "s3cret\r\n", "s3cret"},
+		{"inner spaces kept", " s3 cret \n", " s3 cret "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POSTGRES_PASSWORD", "inline")
+			t.Setenv("POSTGRES_PASSWORD_FILE", writeFile(t, "password", tt.secret))
+			t.Setenv("JWT_SECRET_FILE", writeFile(t, "secret", tt.secret))
+
+			cfg, err := Load("")
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Postgres.Password != tt.want || cfg.Jwt.Secret != tt.want {
+				t.Errorf("password = %q, secret = %q, want %q", cfg.Postgres.Password, cfg.Jwt.Secret, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+		if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "jwt.secret_file") {
+			t.Errorf("Load() error = %v, want jwt.secret_file error", err)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cfg := validConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() of a valid config error = %v", err)
+	}
+
+	tests := []struct {
+		problem string
+		change  func(cfg *Config)
+	}{
+		{`env must be one of local, dev, prod, got "test"`, func(cfg *Config) { cfg.Env = "test" }},
+		{"server.host is required", func(cfg *Config) { cfg.Server.Host = "" }},
+		{`server.port must be a number between 1 and 65535, got "http"`, func(cfg *Config) { cfg.Server.Port = "http" }},
+		{"server.timeout must be positive", func(cfg *Config) { cfg.Server.Timeout = 0 }},
+		{"server.idle_timeout must be positive", func(cfg *Config) { cfg.Server.IdleTimeout = -time.Second }},
+		{"postgres.host is required", func(cfg *Config) { cfg.Postgres.Host = "" }},
+		{`postgres.port must be a number between 1 and 65535, got "65536"`, func(cfg *Config) { cfg.Postgres.Port = "65536" }},
+		{"postgres.user is required", func(cfg *Config) { cfg.Postgres.User = "" }},
+		{"postgres.database is required", func(cfg *Config) { cfg.Postgres.Database = "" }},
+		{"cache.ttl must be positive", func(cfg *Config) { cfg.Cache.TTL, cfg.Cache.NegativeTTL = 0, 0 }},
+		{"cache.hard_ttl must not be less than cache.ttl", func(cfg *Config) { cfg.Cache.HardTTL = time.Minute }},
+		{"cache.negative_ttl must be between 0 and cache.ttl", func(cfg *Config) { cfg.Cache.NegativeTTL = time.Hour }},
+		{"cache.max_entries must be positive", func(cfg *Config) { cfg.Cache.MaxEntries = 0 }},
+		{"cache.shards must be between 1 and cache.max_entries", func(cfg *Config) { cfg.Cache.Shards = 101 }},
+		{"cache.cleanup_interval must be positive", func(cfg *Config) { cfg.Cache.CleanupInterval = 0 }},
+		{"idempotency.ttl must be positive", func(cfg *Config) { cfg.Idempotency.TTL = 0 }},
+		{"idempotency.lock_timeout must be between 0 and idempotency.ttl", func(cfg *Config) { cfg.Idempotency.LockTimeout = 48 * time.Hour }},
+		{"idempotency.max_body_bytes must be positive", func(cfg *Config) { cfg.Idempotency.MaxBodyBytes = 0 }},
+		{"trash.retention must be positive", func(cfg *Config) { cfg.Trash.Retention = 0 }},
+		{"jwt.secret is required", func(cfg *Config) { cfg.Jwt.Secret = "" }},
+		{"jwt.secret must be at least 32 bytes in prod", func(cfg *Config) { cfg.Env = "prod" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.problem, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+
+			var validationErr *ValidationError
+			if err := cfg.Validate(); !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want *ValidationError", err)
+			}
+			// Dependent settings may add a problem of their own after it.
+			if validationErr.Problems[0] != tt.problem {
+				t.Errorf("Validate() problems = %q, want %q first", validationErr.Problems, tt.problem)
+			}
+		})
+	}
+
+	t.Run("all problems at once", func(t *testing.T) {
+		cfg := validConfig()
+		cfg.Server.Host, cfg.Postgres.User, cfg.Jwt.Secret = "", "", ""
+
+		var validationErr *ValidationError
+		if err := cfg.Validate(); !errors.As(err, &validationErr) || len(validationErr.Problems) != 3 {
+			t.Errorf("Validate() error = %v, want 3 problems", err)
+		}
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	redactedCfg := cfg.Redacted()
+	if redactedCfg.Postgres.Password != redacted || redactedCfg.Jwt.Secret != redacted {
+		t.Errorf("Redacted() = %+v, want secrets masked", redactedCfg)
+	}
+	if cfg.Postgres.Password != "password" || cfg.Jwt.Secret != "secret" {
+		t.Error("Redacted() changed the original config")
+	}
+	if redactedCfg.Postgres.User != "user" || redactedCfg.Server != cfg.Server {
+		t.Errorf("Redacted() = %+v, want other fields kept", redactedCfg)
+	}
+
+	cfg.Postgres.Password = ""
+	if got := cfg.Redacted().Postgres.Password; got != "" {
+		t.Errorf("Redacted() of an empty password = %q, want empty", got)
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	for _, password := range []string{"password", "p@ss word", `quote' and "double" \ slash`, "a=b c=d", "/?#:%"} {
+		t.Run(password, func(t *testing.T) {
+			p := PostgresConfig{Host: "db.internal", Port: "6432", User: "banner user", Password: password, Database: "banners"}
+
+			parsed, err := pgx.ParseConfig(p.DSN())
+			if err != nil {
+				t.Fatalf("ParseConfig(%q) error = %v", p.DSN(), err)
+			}
+			if parsed.Password != password || parsed.User != p.User || parsed.Host != p.Host || parsed.Port != 6432 || parsed.Database != p.Database {
+				t.Errorf("ParseConfig(%q) = %s:%q@%s:%d/%s", p.DSN(), parsed.User, parsed.Password, parsed.Host, parsed.Port, parsed.Database)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package etag
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Make builds a strong entity tag from a resource ID and its revision.
+func Make(id int, revision int64) string {
+	return `"` + strconv.Itoa(id) + "-" + strconv.FormatInt(revision, 36) + `"`
+}
+
+// WithVariant returns the entity tag of one representation of the resource
+// with tag, such as one of its languages. Parse does not accept it.
+func WithVariant(tag, variant string) string {
+	if variant == "" || len(tag) < 2 {
+		return tag
+	}
+
+	return tag[:len(tag)-1] + ";" + variant + `"`
+}
+
+// NoneMatch reports whether the request's If-None-Match header matches tag,
+// i.e. whether the client already has this representation. As RFC 9110
+// requires for If-None-Match, the weak comparison is used.
+func NoneMatch(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse extracts the ID and revision from a strong entity tag built by Make.
+func Parse(tag string) (id int, revision int64, ok bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, 0, false
+	}
+
+	idStr, revStr, found := strings.Cut(tag[1:len(tag)-1], "-")
+	if !found {
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	revision, err = strconv.ParseInt(revStr, 36, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return id, revision, true
+}
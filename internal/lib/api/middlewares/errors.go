@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// NotFound answers requests for unknown routes with a problem response.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	response.NotFound(w, r, "Route not found")
+}
+
+// MethodNotAllowed answers requests with an unsupported method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	response.Error(w, r, http.StatusMethodNotAllowed, response.CodeMethodNotAllowed, "Method not allowed")
+}
+
+// Recoverer turns panics into a 500 problem response.
+func Recoverer(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil || rec == http.ErrAbortHandler {
+					if rec != nil {
+						panic(rec)
+					}
+					return
+				}
+
+				log.Error("Panic while serving request",
+					logerr.Err(fmt.Errorf("%v", rec)),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+					slog.String("stack", string(debug.Stack())))
+				response.Internal(w, r, "Internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
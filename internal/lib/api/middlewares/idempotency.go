@@ -0,0 +1,159 @@
+package middlewares
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from the store.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+type IdempotencyKeys interface {
+	// ReserveIdempotencyKey stores key as in progress unless a record for the
+	// same owner, key, method and path exists. Records created before
+	// expiredBefore, and ones still in progress since abandonedBefore, are
+	// replaced. It returns nil if key was reserved and the existing record
+	// otherwise.
+	ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyKey, error)
+	SaveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+}
+
+// Idempotency makes create requests with an Idempotency-Key header safe to
+// retry. The first response is stored for ttl and replayed for repeats with
+// the same key and body. Reusing a key with a different body gets 422, and a
+// repeat while the first request is still running gets 409. Server errors
+// are not stored, so the request can be retried with the same key. Keys are
+// scoped to the caller, and bodies larger than maxBody get 413.
+func Idempotency(store IdempotencyKeys, log *slog.Logger, ttl, lockTimeout time.Duration, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyHeader := r.Header.Get(HeaderIdempotencyKey)
+			if keyHeader == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(keyHeader) > maxIdempotencyKeyLen {
+				response.BadRequest(w, r, "Idempotency-Key must not be longer than 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.Error(w, r, http.StatusRequestEntityTooLarge, response.CodeTooLarge,
+					fmt.Sprintf("Request body must not be larger than %d bytes", maxBody))
+				return
+			}
+			if err != nil {
+				response.BadRequest(w, r, "Failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.Sum256(body)
+			key := &models.IdempotencyKey{
+				Owner:       idempotencyOwner(r),
+				Key:         keyHeader,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Fingerprint: hex.EncodeToString(sum[:]),
+				CreatedAt:   time.Now(),
+			}
+
+			// The outcome must be recorded even if the client goes away.
+			ctx := context.WithoutCancel(r.Context())
+			existing, err := store.ReserveIdempotencyKey(ctx, key, key.CreatedAt.Add(-ttl), key.CreatedAt.Add(-lockTimeout))
+			if err != nil {
+				log.Error("Failed to reserve idempotency key", logerr.Err(err))
+				response.Internal(w, r, "Failed to check Idempotency-Key")
+				return
+			}
+
+			if existing != nil {
+				replay(w, r, existing, key, lockTimeout)
+				return
+			}
+
+			var captured bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&captured)
+
+			defer func() {
+				if ww.Status() >= http.StatusInternalServerError || ww.Status() == 0 {
+					if err := store.DeleteIdempotencyKey(ctx, key); err != nil {
+						log.Error("Failed to release idempotency key", logerr.Err(err))
+					}
+					return
+				}
+
+				key.Status = ww.Status()
+				key.Header = w.Header().Clone()
+				key.Body = captured.Bytes()
+				if err := store.SaveIdempotencyKey(ctx, key); err != nil {
+					log.Error("Failed to save idempotent response", logerr.Err(err))
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// idempotencyOwner returns the caller a key belongs to: the authenticated
+// user, or the client address for anonymous requests.
+func idempotencyOwner(r *http.Request) string {
+	if name := Username(r.Context()); name != "" {
+		return "user:" + name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// replay answers a repeated request from the stored record.
+func replay(w http.ResponseWriter, r *http.Request, existing, key *models.IdempotencyKey, lockTimeout time.Duration) {
+	if existing.Fingerprint != key.Fingerprint {
+		response.Error(w, r, http.StatusUnprocessableEntity, response.CodeIdempotencyKeyReused,
+			"Idempotency-Key was already used with a different request body")
+		return
+	}
+
+	if existing.Status == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockTimeout.Seconds())))
+		response.Error(w, r, http.StatusConflict, response.CodeConflict,
+			"A request with this Idempotency-Key is still in progress")
+		return
+	}
+
+	for name, values := range existing.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(existing.Status)
+	w.Write(existing.Body)
+}
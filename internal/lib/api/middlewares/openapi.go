@@ -0,0 +1,142 @@
+package middlewares
+
+import (
+	response "banner/internal/lib/api/responses"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.RegisteredBodyDecoder("application/json"))
+	// Imports are parsed row by row by the handler, which reports bad rows
+	// instead of rejecting the whole body.
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.RegisteredBodyDecoder("text/plain"))
+	openapi3filter.RegisterBodyDecoder("text/csv", openapi3filter.RegisteredBodyDecoder("text/plain"))
+}
+
+// OpenAPIValidator rejects requests whose parameters or body do not match
+// the OpenAPI spec with a 400 problem listing every violation, or with 415 if
+// the body has a media type the operation does not accept. Requests to
+// routes the spec does not describe are passed through. Authentication is
+// left to the token middlewares.
+func OpenAPIValidator(spec *openapi3.T) (func(http.Handler) http.Handler, error) {
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if body := route.Operation.RequestBody; body != nil && body.Value != nil && r.ContentLength != 0 {
+				if body.Value.Content.Get(r.Header.Get("Content-Type")) == nil {
+					unsupportedMediaType(w, r, body.Value.Content)
+					return
+				}
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				response.WriteProblem(w, r, requestProblem(err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// unsupportedMediaType writes 415 and lists the accepted media types in
+// Accept, or Accept-Patch for PATCH (RFC 5789).
+func unsupportedMediaType(w http.ResponseWriter, r *http.Request, content openapi3.Content) {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+
+	header := "Accept"
+	if r.Method == http.MethodPatch {
+		header = "Accept-Patch"
+	}
+	w.Header().Set(header, strings.Join(types, ", "))
+
+	response.Error(w, r, http.StatusUnsupportedMediaType, response.CodeUnsupportedType,
+		fmt.Sprintf("Content-Type must be one of: %s", strings.Join(types, ", ")))
+}
+
+func requestProblem(err error) *response.Problem {
+	p := response.NewProblem(http.StatusBadRequest, response.CodeValidationFailed, "Request does not match the API contract")
+	p.Errors = fieldErrors(err, "")
+
+	return p
+}
+
+// fieldErrors flattens kin-openapi errors into field-level details. Body
+// fields are reported as JSON pointers, parameters by name.
+func fieldErrors(err error, field string) []response.FieldError {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var out []response.FieldError
+		for _, e := range multi {
+			out = append(out, fieldErrors(e, field)...)
+		}
+		return out
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.Parameter != nil:
+			field = reqErr.Parameter.Name
+		case reqErr.RequestBody != nil:
+			field = "body"
+		}
+
+		if reqErr.Err != nil {
+			var schemaErr *openapi3.SchemaError
+			var nested openapi3.MultiError
+			if errors.As(reqErr.Err, &schemaErr) || errors.As(reqErr.Err, &nested) {
+				return fieldErrors(reqErr.Err, field)
+			}
+		}
+
+		return []response.FieldError{{Field: field, Code: "invalid", Message: reqErr.Error()}}
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			if field == "body" {
+				field = ""
+			}
+			field += "/" + strings.Join(pointer, "/")
+		}
+
+		return []response.FieldError{{Field: field, Code: schemaErr.SchemaField, Message: schemaErr.Reason}}
+	}
+
+	return []response.FieldError{{Field: field, Code: "invalid", Message: err.Error()}}
+}
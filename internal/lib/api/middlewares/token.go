@@ -3,62 +3,78 @@ package middlewares
 import (
 	response "banner/internal/lib/api/responses"
 	jwt "banner/internal/lib/auth/jwt"
+	"context"
 	"net/http"
 	"strings"
-
-	"github.com/go-chi/render"
 )
 
-func TokenAuthMiddleware(jwtManager *jwt.JWTSecret, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			render.JSON(w, r, response.Error("Unauthorized"))
-			return
-		}
+type usernameKey struct{}
 
-		token := strings.Fields(tokenString)
-		if len(token) != 2 || token[0] != "Bearer" {
-			render.JSON(w, r, response.Error("Unauthorized"))
-			return
-		}
+// Username returns the name of the user the request was authenticated as,
+// or "" if it was not.
+func Username(ctx context.Context) string {
+	name, _ := ctx.Value(usernameKey{}).(string)
+	return name
+}
 
-		_, err := jwtManager.VerifyToken(token[1])
-		if err != nil {
-			render.JSON(w, r, response.Error("Unauthorized"))
+func TokenAuthMiddleware(jwtManager *jwt.JWTSecret, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := verifyToken(w, r, jwtManager)
+		if !ok {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withUsername(r, claims))
 	})
 }
 
 func TokenAuthAndRoleMiddleware(jwtManager *jwt.JWTSecret, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			render.JSON(w, r, response.Error("Unauthorized"))
-			return
-		}
-
-		token := strings.Fields(tokenString)
-		if len(token) != 2 || token[0] != "Bearer" {
-			render.JSON(w, r, response.Error("Unauthorized"))
-			return
-		}
-
-		claims, err := jwtManager.VerifyToken(token[1])
-		if err != nil {
-			render.JSON(w, r, response.Error("Unauthorized"))
+		claims, ok := verifyToken(w, r, jwtManager)
+		if !ok {
 			return
 		}
 
 		role, ok := claims["role"].(string)
 		if !ok || role != "admin" {
-			render.JSON(w, r, response.Error("Forbidden"))
+			response.Error(w, r, http.StatusForbidden, response.CodeForbidden, "Admin role required")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withUsername(r, claims))
 	})
 }
+
+// verifyToken checks the bearer token and writes 401 if it is missing or
+// invalid.
+func verifyToken(w http.ResponseWriter, r *http.Request, jwtManager *jwt.JWTSecret) (map[string]interface{}, bool) {
+	unauthorized := func(detail string) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="banner"`)
+		response.Error(w, r, http.StatusUnauthorized, response.CodeUnauthorized, detail)
+	}
+
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		unauthorized("Authorization header is missing")
+		return nil, false
+	}
+
+	token := strings.Fields(tokenString)
+	if len(token) != 2 || token[0] != "Bearer" {
+		unauthorized("Authorization header must be a Bearer token")
+		return nil, false
+	}
+
+	claims, err := jwtManager.VerifyToken(token[1])
+	if err != nil {
+		unauthorized("Invalid or expired token")
+		return nil, false
+	}
+
+	return claims, true
+}
+
+func withUsername(r *http.Request, claims map[string]interface{}) *http.Request {
+	name, _ := claims["username"].(string)
+	return r.WithContext(context.WithValue(r.Context(), usernameKey{}, name))
+}
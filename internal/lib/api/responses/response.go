@@ -1,20 +1,43 @@
 package responses
 
 import (
+	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-playground/validator/v10"
 )
 
 const (
-	StatusOK    = "OK"
-	StatusError = "Error"
+	StatusOK = "OK"
+
+	// ContentTypeProblem is the media type of error responses (RFC 7807).
+	ContentTypeProblem = "application/problem+json"
+)
+
+// Stable machine-readable error codes. Clients should branch on these rather
+// than on messages.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeVersionMismatch      = "version_mismatch"
+	CodePreconditionRequired = "precondition_required"
+	CodeUnsupportedType      = "unsupported_media_type"
+	CodeTooLarge             = "request_too_large"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeApprovalRequired     = "approval_required"
+	CodeMissingVariables     = "missing_variables"
+	CodeInternal             = "internal_error"
 )
 
 type Response struct {
 	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
 }
 
 func OK() Response {
@@ -23,29 +46,80 @@ func OK() Response {
 	}
 }
 
-func Error(message string) Response {
-	return Response{
-		Status: StatusError,
-		Error:  message,
+// Problem is an RFC 7807 problem details object extended with a stable
+// error code, field-level details and the request ID. CurrentVersion is set
+// on version mismatches so clients can refetch and retry.
+type Problem struct {
+	Type           string       `json:"type"`
+	Title          string       `json:"title"`
+	Status         int          `json:"status"`
+	Code           string       `json:"code"`
+	Detail         string       `json:"detail,omitempty"`
+	Instance       string       `json:"instance,omitempty"`
+	RequestID      string       `json:"request_id,omitempty"`
+	Errors         []FieldError `json:"errors,omitempty"`
+	CurrentVersion *int64       `json:"current_version,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
 	}
 }
 
-func ValidationError(errs validator.ValidationErrors) Response {
-	var errMessages []string
+// WriteProblem writes p as application/problem+json, filling in the request
+// path and ID.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, NewProblem(status, code, detail))
+}
+
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	Error(w, r, http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	Error(w, r, http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Internal(w http.ResponseWriter, r *http.Request, detail string) {
+	Error(w, r, http.StatusInternalServerError, CodeInternal, detail)
+}
+
+func ValidationError(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	p := NewProblem(http.StatusBadRequest, CodeValidationFailed, "Request validation failed")
 
 	for _, err := range errs {
+		fieldErr := FieldError{Field: err.Field(), Code: err.ActualTag()}
 		switch err.ActualTag() {
 		case "required":
-			errMessages = append(errMessages, fmt.Sprintf("field %s is a required field", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is a required field", err.Field())
 		case "url":
-			errMessages = append(errMessages, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is not a valid URL", err.Field())
 		default:
-			errMessages = append(errMessages, fmt.Sprintf("field %s is not valid", err.Field()))
+			fieldErr.Message = fmt.Sprintf("field %s is not valid", err.Field())
 		}
+		p.Errors = append(p.Errors, fieldErr)
 	}
 
-	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errMessages, ", "),
-	}
+	WriteProblem(w, r, p)
 }
@@ -36,7 +36,7 @@ func (secret *JWTSecret) GenerateToken(username string, role string, expiration
 	signedToken, err := token.SignedString(secret.secret)
 	if err != nil {
 		secret.log.Error("Failed to sign token")
-		return "", fmt.Errorf("failed to sign token", logerr.Err(err))
+		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
 
 	return signedToken, nil
@@ -53,7 +53,7 @@ func (secret *JWTSecret) VerifyToken(tokenString string) (jwt.MapClaims, error)
 	})
 	if err != nil {
 		secret.log.Error("Failed to parse token", logerr.Err(err))
-		return nil, fmt.Errorf("failed to parse token", logerr.Err(err))
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
@@ -95,7 +95,7 @@ func (secret *JWTSecret) ExtractRoleAndUsernameFromToken(tokenString string) (st
 
 	if err != nil {
 		secret.log.Error("Failed to parse token", logerr.Err(err))
-		return "", "", fmt.Errorf("failed to parse token", logerr.Err(err))
+		return "", "", fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if !token.Valid {
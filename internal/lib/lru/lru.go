@@ -0,0 +1,68 @@
+// Package lru is a bounded map that drops the least recently used entry
+// when it is full, for caches of values compiled from banner fields.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache holds at most max entries and is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	max int
+
+	mu    sync.Mutex
+	items map[K]*list.Element
+	order *list.List
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func New[K comparable, V any](max int) *Cache[K, V] {
+	return &Cache[K, V]{max: max, items: make(map[K]*list.Element), order: list.New()}
+}
+
+// Get returns the value of key and marks it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.items[key]
+	if !found {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+
+	return el.Value.(*entry[K, V]).value, true
+}
+
+// Add stores value under key, dropping the least recently used entry if the
+// cache is full.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.items[key]; found {
+		el.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	if c.order.Len() >= c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key, value})
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,27 @@
+package lru
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+
+	// b is the least recently used now.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was kept over the limit")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v, want 1, true", v, ok)
+	}
+
+	c.Add("c", 4)
+	if v, _ := c.Get("c"); v != 4 || c.Len() != 2 {
+		t.Errorf("Get(c) = %d, Len() = %d after update, want 4 and 2", v, c.Len())
+	}
+}
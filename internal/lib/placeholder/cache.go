@@ -0,0 +1,58 @@
+package placeholder
+
+import (
+	"banner/internal/lib/lru"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// Cache keeps compiled templates by a hash of their content and options, so
+// content is parsed once rather than on every request. The hash rather than
+// a banner revision is the key, since revisions are not unique: a restored
+// snapshot or a new database reuses banner IDs and versions. When it holds
+// max templates it drops the least recently used.
+type Cache struct {
+	templates *lru.Cache[string, *Template]
+}
+
+func NewCache(max int) *Cache {
+	return &Cache{templates: lru.New[string, *Template](max)}
+}
+
+// Compile returns the template of content and opts from the cache or
+// compiles it. Templates that do not compile are not kept.
+func (c *Cache) Compile(content map[string]any, opts Options) (*Template, error) {
+	key, ok := cacheKey(content, opts)
+	if !ok {
+		return Compile(content, opts)
+	}
+
+	if t, found := c.templates.Get(key); found {
+		return t, nil
+	}
+
+	t, err := Compile(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.templates.Add(key, t)
+
+	return t, nil
+}
+
+// cacheKey hashes content, encoded as JSON with sorted keys, and opts. It
+// reports false for content that cannot be encoded.
+func cacheKey(content map[string]any, opts Options) (string, bool) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(content); err != nil {
+		return "", false
+	}
+	fmt.Fprintf(h, "%q %q %q", opts.Variables, opts.Escape, opts.OnMissing)
+
+	return string(h.Sum(nil)), true
+}
+
+func (c *Cache) Len() int {
+	return c.templates.Len()
+}
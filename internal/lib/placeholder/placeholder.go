@@ -0,0 +1,357 @@
+// Package placeholder fills placeholders in the string values of banner
+// content with values of the request, such as
+//
+//	Hi {{ name | 'friend' }}, your cashback is {{ amount }}
+//
+// A placeholder names a variable and may give a default, used when the
+// request has no value for it. \{{ stands for a literal {{.
+package placeholder
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Escapings of the values of variables. Defaults are written by the author
+// of the banner and are never escaped.
+const (
+	EscapeHTML = "html"
+	EscapeURL  = "url"
+	EscapeNone = "none"
+)
+
+// Policies for placeholders that have neither a value nor a default.
+const (
+	// MissingEmpty replaces the placeholder with nothing.
+	MissingEmpty = "empty"
+	// MissingKeep leaves the placeholder as written.
+	MissingKeep = "keep"
+	// MissingError makes Render fail with *MissingVariablesError.
+	MissingError = "error"
+)
+
+// MaxVariables bounds the variables of a template.
+const MaxVariables = 50
+
+// Options are the settings of a template.
+type Options struct {
+	// Variables are the names placeholders may use. Values of other
+	// request attributes are never substituted.
+	Variables []string
+	// Escape is one of the Escape constants, EscapeHTML if empty.
+	Escape string
+	// OnMissing is one of the Missing constants, MissingEmpty if empty.
+	OnMissing string
+}
+
+// Error is a mistake in a template.
+type Error struct {
+	// Path is the JSON pointer of the string in the content, empty for
+	// errors in Options.
+	Path string
+	// Column is where in the string the error is, starting at 1.
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: column %d: %s", e.Path, e.Column, e.Msg)
+}
+
+// MissingVariablesError tells which variables a template with MissingError
+// had no values for.
+type MissingVariablesError struct {
+	Names []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return "missing values for " + strings.Join(e.Names, ", ")
+}
+
+// Template is compiled content.
+type Template struct {
+	opts Options
+	// root is content with strings that have placeholders replaced by
+	// *text; nil if the content has none and is rendered as is.
+	root    any
+	content map[string]any
+}
+
+type text struct {
+	parts []part
+}
+
+// part is literal text or, if name is set, a placeholder.
+type part struct {
+	literal string
+	name    string
+	def     *string
+	source  string
+}
+
+// Compile checks the options and parses the placeholders of every string
+// in content.
+func Compile(content map[string]any, opts Options) (*Template, error) {
+	opts, err := normalize(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{opts: opts, content: content}
+	root, found, err := t.compile(content, "")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		t.root = root
+	}
+
+	return t, nil
+}
+
+func normalize(opts Options) (Options, error) {
+	if len(opts.Variables) > MaxVariables {
+		return opts, &Error{Msg: fmt.Sprintf("at most %d variables are allowed", MaxVariables)}
+	}
+	for _, name := range opts.Variables {
+		if !isName(name) {
+			return opts, &Error{Msg: fmt.Sprintf("variable %q must be letters, digits, _ and . and not start with a digit", name)}
+		}
+	}
+
+	switch opts.Escape {
+	case "":
+		opts.Escape = EscapeHTML
+	case EscapeHTML, EscapeURL, EscapeNone:
+	default:
+		return opts, &Error{Msg: fmt.Sprintf("escape %q is not one of html, url, none", opts.Escape)}
+	}
+	switch opts.OnMissing {
+	case "":
+		opts.OnMissing = MissingEmpty
+	case MissingEmpty, MissingKeep, MissingError:
+	default:
+		return opts, &Error{Msg: fmt.Sprintf("on_missing %q is not one of empty, keep, error", opts.OnMissing)}
+	}
+
+	return opts, nil
+}
+
+// compile returns v with strings compiled and whether any of them has a
+// placeholder.
+func (t *Template) compile(v any, path string) (any, bool, error) {
+	switch v := v.(type) {
+	case string:
+		parts, err := t.parse(v, path)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(parts) == 1 && parts[0].name == "" {
+			return parts[0].literal, parts[0].literal != v, nil
+		}
+		return &text{parts}, true, nil
+	case map[string]any:
+		compiled := make(map[string]any, len(v))
+		found := false
+		for key, value := range v {
+			c, f, err := t.compile(value, path+"/"+escapePointer(key))
+			if err != nil {
+				return nil, false, err
+			}
+			compiled[key], found = c, found || f
+		}
+		return compiled, found, nil
+	case []any:
+		compiled := make([]any, len(v))
+		found := false
+		for i, value := range v {
+			c, f, err := t.compile(value, path+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, false, err
+			}
+			compiled[i], found = c, found || f
+		}
+		return compiled, found, nil
+	}
+
+	return v, false, nil
+}
+
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// Render returns the content with the placeholders filled from values. The
+// content of a template without placeholders is returned as is and must not
+// be changed.
+func (t *Template) Render(values map[string]string) (map[string]any, error) {
+	if t.root == nil {
+		return t.content, nil
+	}
+
+	var missing []string
+	rendered := t.render(t.root, values, &missing)
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, &MissingVariablesError{Names: slices.Compact(missing)}
+	}
+
+	return rendered.(map[string]any), nil
+}
+
+func (t *Template) render(v any, values map[string]string, missing *[]string) any {
+	switch v := v.(type) {
+	case *text:
+		var b strings.Builder
+		for _, p := range v.parts {
+			if p.name == "" {
+				b.WriteString(p.literal)
+				continue
+			}
+			value, found := values[p.name]
+			switch {
+			case found:
+				b.WriteString(t.escape(value))
+			case p.def != nil:
+				b.WriteString(*p.def)
+			case t.opts.OnMissing == MissingKeep:
+				b.WriteString(p.source)
+			case t.opts.OnMissing == MissingError:
+				*missing = append(*missing, p.name)
+			}
+		}
+		return b.String()
+	case map[string]any:
+		rendered := make(map[string]any, len(v))
+		for key, value := range v {
+			rendered[key] = t.render(value, values, missing)
+		}
+		return rendered
+	case []any:
+		rendered := make([]any, len(v))
+		for i, value := range v {
+			rendered[i] = t.render(value, values, missing)
+		}
+		return rendered
+	}
+
+	return v
+}
+
+func (t *Template) escape(value string) string {
+	switch t.opts.Escape {
+	case EscapeHTML:
+		return html.EscapeString(value)
+	case EscapeURL:
+		return url.QueryEscape(value)
+	}
+	return value
+}
+
+// parse splits s into literal text and placeholders.
+func (t *Template) parse(s, path string) ([]part, error) {
+	var (
+		parts   []part
+		literal strings.Builder
+	)
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], `\{{`):
+			literal.WriteString("{{")
+			i += 3
+		case strings.HasPrefix(s[i:], "{{"):
+			end := strings.Index(s[i:], "}}")
+			if end < 0 {
+				return nil, errorAt(path, s, i, "placeholder is not closed with }}")
+			}
+			p, err := t.placeholder(s[i:i+end+2], path, s, i)
+			if err != nil {
+				return nil, err
+			}
+			if literal.Len() > 0 {
+				parts = append(parts, part{literal: literal.String()})
+				literal.Reset()
+			}
+			parts = append(parts, p)
+			i += end + 2
+		default:
+			literal.WriteByte(s[i])
+			i++
+		}
+	}
+	if literal.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, part{literal: literal.String()})
+	}
+
+	return parts, nil
+}
+
+// placeholder parses source, a whole {{ ... }} at offset of s.
+func (t *Template) placeholder(source, path, s string, offset int) (part, error) {
+	inner := source[2 : len(source)-2]
+	name, def, hasDefault := strings.Cut(inner, "|")
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return part{}, errorAt(path, s, offset, "placeholder has no variable name")
+	case !isName(name):
+		return part{}, errorAt(path, s, offset, fmt.Sprintf("%q is not a variable name", name))
+	case !slices.Contains(t.opts.Variables, name):
+		return part{}, errorAt(path, s, offset, fmt.Sprintf("%s is not one of the template variables", name))
+	}
+
+	p := part{name: name, source: source}
+	if hasDefault {
+		value, err := unquote(strings.TrimSpace(def))
+		if err != nil {
+			return part{}, errorAt(path, s, offset, "default of "+name+" "+err.Error())
+		}
+		p.def = &value
+	}
+
+	return p, nil
+}
+
+// unquote reads a default quoted with " or ', where \ escapes the next
+// character.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' && s[0] != '\'' || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("must be quoted, e.g. 'friend'")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		} else if s[i] == s[0] {
+			return "", fmt.Errorf("has an unescaped %c", s[0])
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String(), nil
+}
+
+func errorAt(path, s string, offset int, msg string) error {
+	return &Error{Path: path, Column: len([]rune(s[:offset])) + 1, Msg: msg}
+}
+
+func isName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
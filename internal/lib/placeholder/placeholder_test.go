@@ -0,0 +1,154 @@
+package placeholder
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	content := map[string]any{
+		"title": "Hi {{ name | 'friend' }}, your cashback is {{amount}}",
+		"url":   "https://example.com/?ref={{ name }}",
+		"items": []any{"{{amount}}%", 7.0, true},
+		"raw":   `\{{ not a placeholder }}`,
+		"plain": "no placeholders",
+	}
+	opts := Options{Variables: []string{"name", "amount"}}
+
+	tests := []struct {
+		opts   Options
+		values map[string]string
+		want   map[string]any
+	}{
+		{
+			opts:   opts,
+			values: map[string]string{"name": "<Ann>", "amount": "5"},
+			want: map[string]any{
+				"title": "Hi &lt;Ann&gt;, your cashback is 5",
+				"url":   "https://example.com/?ref=&lt;Ann&gt;",
+				"items": []any{"5%", 7.0, true},
+				"raw":   "{{ not a placeholder }}",
+				"plain": "no placeholders",
+			},
+		},
+		{
+			opts:   Options{Variables: opts.Variables, Escape: EscapeURL, OnMissing: MissingKeep},
+			values: map[string]string{"name": "Ann Lee"},
+			want: map[string]any{
+				"title": "Hi Ann+Lee, your cashback is {{amount}}",
+				"url":   "https://example.com/?ref=Ann+Lee",
+				"items": []any{"{{amount}}%", 7.0, true},
+				"raw":   "{{ not a placeholder }}",
+				"plain": "no placeholders",
+			},
+		},
+		{
+			opts:   Options{Variables: opts.Variables, Escape: EscapeNone},
+			values: map[string]string{"amount": "<b>5</b>"},
+			want: map[string]any{
+				"title": "Hi friend, your cashback is <b>5</b>",
+				"url":   "https://example.com/?ref=",
+				"items": []any{"<b>5</b>%", 7.0, true},
+				"raw":   "{{ not a placeholder }}",
+				"plain": "no placeholders",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := Compile(content, tt.opts)
+		if err != nil {
+			t.Fatalf("Compile(%+v) error = %v", tt.opts, err)
+		}
+		got, err := tmpl.Render(tt.values)
+		if err != nil {
+			t.Fatalf("Render(%v) error = %v", tt.values, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Render(%v) =\n%v, want\n%v", tt.values, got, tt.want)
+		}
+	}
+
+	if content["title"] != "Hi {{ name | 'friend' }}, your cashback is {{amount}}" {
+		t.Error("Render() changed the content")
+	}
+}
+
+func TestRenderMissing(t *testing.T) {
+	tmpl, err := Compile(map[string]any{"a": "{{ name }} {{amount}} {{name}} {{ city | 'Almaty' }}"},
+		Options{Variables: []string{"name", "amount", "city"}, OnMissing: MissingError})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tmpl.Render(map[string]string{"amount": "5"})
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"name"}) {
+		t.Fatalf("Render() error = %v, want name missing", err)
+	}
+}
+
+func TestRenderWithoutPlaceholders(t *testing.T) {
+	content := map[string]any{"title": "Sale"}
+	tmpl, err := Compile(content, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := tmpl.Render(nil)
+	if reflect.ValueOf(got).Pointer() != reflect.ValueOf(content).Pointer() {
+		t.Error("content without placeholders was copied")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	vars := []string{"name"}
+	tests := []struct {
+		content map[string]any
+		opts    Options
+		msg     string
+	}{
+		{map[string]any{"title": "Hi {{name"}, Options{Variables: vars}, "/title: column 4: placeholder is not closed"},
+		{map[string]any{"a": []any{"ok", "{{ }}"}}, Options{Variables: vars}, "/a/1: column 1: placeholder has no variable name"},
+		{map[string]any{"title": "{{ city }}"}, Options{Variables: vars}, "city is not one of the template variables"},
+		{map[string]any{"title": "{{ na-me }}"}, Options{Variables: vars}, `"na-me" is not a variable name`},
+		{map[string]any{"title": "{{ name | friend }}"}, Options{Variables: vars}, "default of name must be quoted"},
+		{map[string]any{"title": "{{ name | 'it's' }}"}, Options{Variables: vars}, "has an unescaped '"},
+		{map[string]any{}, Options{Variables: []string{"1st"}}, `variable "1st"`},
+		{map[string]any{}, Options{Escape: "js"}, `escape "js"`},
+		{map[string]any{}, Options{OnMissing: "skip"}, `on_missing "skip"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.content, tt.opts)
+		var tmplErr *Error
+		if !errors.As(err, &tmplErr) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Compile(%v) error = %v, want %q", tt.content, err, tt.msg)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	content := map[string]any{"title": "{{ name }}"}
+	opts := Options{Variables: []string{"name"}}
+
+	first, err := c.Compile(content, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.Compile(map[string]any{"title": "{{ name }}"}, opts); again != first {
+		t.Error("template was compiled twice")
+	}
+	if other, _ := c.Compile(content, Options{Variables: opts.Variables, Escape: EscapeURL}); other == first {
+		t.Error("template with other options came from the cache")
+	}
+	if _, err := c.Compile(map[string]any{"title": "{{"}, opts); err == nil || c.Len() != 2 {
+		t.Errorf("invalid template: error = %v, Len() = %d", err, c.Len())
+	}
+	c.Compile(map[string]any{"title": "Hi {{ name }}"}, opts)
+	if again, _ := c.Compile(content, opts); c.Len() != 2 || again == first {
+		t.Errorf("Len() = %d after overflow, want 2 without the oldest template", c.Len())
+	}
+}
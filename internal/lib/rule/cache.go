@@ -0,0 +1,34 @@
+package rule
+
+import "banner/internal/lib/lru"
+
+// Cache keeps compiled rules by their source, so a rule evaluated on every
+// request is parsed once. When it holds max rules it drops the least
+// recently used, such as rules of banners that have since changed.
+type Cache struct {
+	rules *lru.Cache[string, *Rule]
+}
+
+func NewCache(max int) *Cache {
+	return &Cache{rules: lru.New[string, *Rule](max)}
+}
+
+// Compile returns the compiled rule from the cache or compiles it. Rules
+// that do not compile are not kept.
+func (c *Cache) Compile(source string) (*Rule, error) {
+	if r, found := c.rules.Get(source); found {
+		return r, nil
+	}
+
+	r, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	c.rules.Add(source, r)
+
+	return r, nil
+}
+
+func (c *Cache) Len() int {
+	return c.rules.Len()
+}
@@ -0,0 +1,136 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenKeyword
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	// text is the token as written, except for strings, which are
+	// unquoted, and for && || !, which are the keywords they stand for.
+	text   string
+	column int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "in": true, "true": true, "false": true}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		column := utf8.RuneCountInString(source[:i]) + 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(source) && isIdentPart(source[j]) {
+				j++
+			}
+			word := source[i:j]
+			kind := tokenIdent
+			if keywords[word] {
+				kind = tokenKeyword
+			}
+			tokens = append(tokens, token{kind, word, column})
+			i = j
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			j := i + 1
+			for j < len(source) && (source[j] >= '0' && source[j] <= '9' || source[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, source[i:j], column})
+			i = j
+		case c == '"' || c == '\'':
+			text, n, err := lexString(source[i:], column)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, column})
+			i += n
+		default:
+			t, n := lexSymbol(source[i:])
+			if n == 0 {
+				r, _ := utf8.DecodeRuneInString(source[i:])
+				return nil, &Error{Column: column, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			t.column = column
+			tokens = append(tokens, t)
+			i += n
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, column: utf8.RuneCountInString(source) + 1}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '.'
+}
+
+// lexString reads a string quoted with " or ' at the start of s, where \
+// escapes the next character, and returns it with its length in s.
+func lexString(s string, column int) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, &Error{Column: column, Msg: "string is not closed"}
+}
+
+func lexSymbol(s string) (token, int) {
+	for _, op := range [...]string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(s, op) {
+			return token{kind: tokenOp, text: op}, len(op)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(s, "&&"):
+		return token{kind: tokenKeyword, text: "and"}, 2
+	case strings.HasPrefix(s, "||"):
+		return token{kind: tokenKeyword, text: "or"}, 2
+	case s[0] == '!':
+		return token{kind: tokenKeyword, text: "not"}, 1
+	case s[0] == '=':
+		return token{kind: tokenOp, text: "=="}, 1
+	case strings.IndexByte("()[],", s[0]) >= 0:
+		return token{kind: tokenPunct, text: s[:1]}, 1
+	}
+
+	return token{}, 0
+}
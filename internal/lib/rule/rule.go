@@ -0,0 +1,357 @@
+// Package rule implements the targeting expressions of banners: a small
+// language of comparisons of user attributes with constants, such as
+//
+//	country == "KZ" and cohort in ["a", "b"] and days_since_signup > 7
+//
+// Expressions have no loops, calls or side effects, and run in time linear
+// in their length.
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxLength is the longest expression Compile accepts.
+	MaxLength = 2000
+	// maxDepth bounds the nesting of parentheses and not.
+	maxDepth = 32
+)
+
+// Attributes are what is known about the user, by name.
+type Attributes map[string]string
+
+// Rule is a compiled expression.
+type Rule struct {
+	source string
+	root   node
+}
+
+// Error is a syntax or type error in an expression.
+type Error struct {
+	// Column is where the error is, starting at 1.
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// Compile parses the expression.
+func Compile(source string) (*Rule, error) {
+	if len(source) > MaxLength {
+		return nil, &Error{Column: MaxLength + 1, Msg: fmt.Sprintf("expression is longer than %d characters", MaxLength)}
+	}
+
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "and, or or the end")
+	}
+
+	return &Rule{source: source, root: root}, nil
+}
+
+func (r *Rule) String() string {
+	return r.source
+}
+
+// Match evaluates the rule. A comparison with an attribute that is not
+// given, or that is not a number where a number is expected, is false.
+func (r *Rule) Match(attrs Attributes) bool {
+	return r.root.eval(attrs)
+}
+
+type node interface {
+	eval(attrs Attributes) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(attrs Attributes) bool { return n.left.eval(attrs) && n.right.eval(attrs) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(attrs Attributes) bool { return n.left.eval(attrs) || n.right.eval(attrs) }
+
+type notNode struct{ x node }
+
+func (n notNode) eval(attrs Attributes) bool { return !n.x.eval(attrs) }
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+)
+
+func (k valueKind) String() string {
+	return [...]string{"a string", "a number", "a boolean"}[k]
+}
+
+type value struct {
+	kind valueKind
+	str  string
+	num  float64
+	bool bool
+}
+
+// compare compares the attribute with v as v's type and reports whether
+// the attribute is of that type at all.
+func (v value) compare(attr string) (int, bool) {
+	switch v.kind {
+	case kindNumber:
+		n, err := strconv.ParseFloat(attr, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case n < v.num:
+			return -1, true
+		case n > v.num:
+			return 1, true
+		}
+		return 0, true
+	case kindBool:
+		b, err := strconv.ParseBool(attr)
+		if err != nil {
+			return 0, false
+		}
+		if b == v.bool {
+			return 0, true
+		}
+		return 1, true
+	}
+
+	return strings.Compare(attr, v.str), true
+}
+
+type compareNode struct {
+	attr  string
+	op    string
+	value value
+}
+
+func (n compareNode) eval(attrs Attributes) bool {
+	attr, found := attrs[n.attr]
+	if !found {
+		return false
+	}
+	c, ok := n.value.compare(attr)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+type inNode struct {
+	attr   string
+	values []value
+	negate bool
+}
+
+func (n inNode) eval(attrs Attributes) bool {
+	attr, found := attrs[n.attr]
+	if !found {
+		return false
+	}
+	for _, v := range n.values {
+		if c, ok := v.compare(attr); ok && c == 0 {
+			return !n.negate
+		}
+	}
+
+	return n.negate
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token, expected string) error {
+	if t.kind == tokenEOF {
+		return &Error{Column: t.column, Msg: "unexpected end of expression, expected " + expected}
+	}
+	return &Error{Column: t.column, Msg: fmt.Sprintf("unexpected %q, expected %s", t.text, expected)}
+}
+
+func (p *parser) or(depth int) (node, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenKeyword, "or") {
+		p.next()
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and(depth int) (node, error) {
+	left, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenKeyword, "and") {
+		p.next()
+		right, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary(depth int) (node, error) {
+	t := p.peek()
+	if depth >= maxDepth {
+		return nil, &Error{Column: t.column, Msg: fmt.Sprintf("expression is nested deeper than %d levels", maxDepth)}
+	}
+
+	switch {
+	case t.is(tokenKeyword, "not"):
+		p.next()
+		x, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	case t.kind == tokenPunct && t.text == "(":
+		p.next()
+		x, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenPunct || t.text != ")" {
+			return nil, p.unexpected(t, `")"`)
+		}
+		return x, nil
+	case t.kind == tokenIdent:
+		return p.comparison()
+	}
+
+	return nil, p.unexpected(t, "an attribute name, not or (")
+}
+
+func (p *parser) comparison() (node, error) {
+	attr := p.next().text
+
+	t := p.next()
+	switch {
+	case t.kind == tokenOp:
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if v.kind == kindBool && t.text != "==" && t.text != "!=" {
+			return nil, &Error{Column: t.column, Msg: "booleans can only be compared with == and !="}
+		}
+		return compareNode{attr: attr, op: t.text, value: v}, nil
+	case t.is(tokenKeyword, "in"):
+		values, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{attr: attr, values: values}, nil
+	case t.is(tokenKeyword, "not") && p.peek().is(tokenKeyword, "in"):
+		p.next()
+		values, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{attr: attr, values: values, negate: true}, nil
+	}
+
+	return nil, p.unexpected(t, "a comparison such as == or in after "+attr)
+}
+
+func (p *parser) list() ([]value, error) {
+	if t := p.next(); t.kind != tokenPunct || t.text != "[" {
+		return nil, p.unexpected(t, `a list such as ["a", "b"]`)
+	}
+
+	var values []value
+	for {
+		start := p.peek()
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 && v.kind != values[0].kind {
+			return nil, &Error{Column: start.column, Msg: fmt.Sprintf("list mixes %s and %s", values[0].kind, v.kind)}
+		}
+		values = append(values, v)
+
+		t := p.next()
+		if t.kind == tokenPunct && t.text == "]" {
+			return values, nil
+		}
+		if t.kind != tokenPunct || t.text != "," {
+			return nil, p.unexpected(t, `"," or "]"`)
+		}
+	}
+}
+
+func (p *parser) value() (value, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenString:
+		return value{kind: kindString, str: t.text}, nil
+	case t.kind == tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return value{}, &Error{Column: t.column, Msg: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return value{kind: kindNumber, num: n}, nil
+	case t.is(tokenKeyword, "true"), t.is(tokenKeyword, "false"):
+		return value{kind: kindBool, bool: t.text == "true"}, nil
+	case t.kind == tokenIdent:
+		return value{}, &Error{Column: t.column, Msg: fmt.Sprintf("%s is an attribute, quote it to compare with the string %q", t.text, t.text)}
+	}
+
+	return value{}, p.unexpected(t, "a string, number, true or false")
+}
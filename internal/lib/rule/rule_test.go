@@ -0,0 +1,104 @@
+package rule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	attrs := Attributes{"country": "KZ", "cohort": "b", "days_since_signup": "10", "premium": "true", "app.build": "42"}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`country == "KZ" and cohort in ["a", "b"] and days_since_signup > 7`, true},
+		{`country = 'KZ'`, true},
+		{`country != "KZ"`, false},
+		{`days_since_signup >= 10 && days_since_signup < 10.5`, true},
+		{`days_since_signup > 9.99 and days_since_signup <= 9`, false},
+		{`cohort not in ["a", "c"]`, true},
+		{`not (cohort in ["b"]) or country == "RU"`, false},
+		{`!(country == "RU") || false_attr == true`, true},
+		{`premium == true and app.build > 40`, true},
+		{`country > "AA" and country < "LA"`, true},
+		// Missing attributes and attributes of the wrong type never match.
+		{`city == "Almaty"`, false},
+		{`city != "Almaty"`, false},
+		{`city not in ["Almaty"]`, false},
+		{`country > 5`, false},
+		{`days_since_signup == "10"`, true},
+		{`days_since_signup == 10.0`, true},
+		{`days_since_signup > -1`, true},
+	}
+
+	for _, tt := range tests {
+		r, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%s) error = %v", tt.expr, err)
+		}
+		if got := r.Match(attrs); got != tt.want {
+			t.Errorf("%s = %t, want %t", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		column int
+		msg    string
+	}{
+		{``, 1, "unexpected end of expression"},
+		{`country == `, 12, "unexpected end of expression, expected a string"},
+		{`country == KZ`, 12, `KZ is an attribute, quote it`},
+		{`country == "KZ`, 12, "string is not closed"},
+		{`country == "KZ" and`, 20, "expected an attribute name"},
+		{`country == "KZ" cohort == "a"`, 17, `unexpected "cohort", expected and, or or the end`},
+		{`(country == "KZ"`, 17, `expected ")"`},
+		{`cohort in ["a", 1]`, 17, "list mixes a string and a number"},
+		{`cohort in "a"`, 11, "expected a list"},
+		{`premium > true`, 9, "booleans can only be compared with == and !="},
+		{`version == 7.2.1`, 12, `invalid number "7.2.1"`},
+		{`country ~ "KZ"`, 9, `unexpected character '~'`},
+		{`country`, 8, "expected a comparison"},
+		{strings.Repeat("not ", 40) + `a == 1`, 129, "nested deeper than 32"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		var ruleErr *Error
+		if !errors.As(err, &ruleErr) {
+			t.Errorf("Compile(%s) error = %v, want *Error", tt.expr, err)
+			continue
+		}
+		if ruleErr.Column != tt.column || !strings.Contains(ruleErr.Msg, tt.msg) {
+			t.Errorf("Compile(%s) error = %v, want %q at column %d", tt.expr, err, tt.msg, tt.column)
+		}
+	}
+
+	if _, err := Compile(strings.Repeat(" ", MaxLength+1)); err == nil {
+		t.Error("Compile() accepted an expression over MaxLength")
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+
+	first, err := c.Compile(`a == 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.Compile(`a == 1`); again != first {
+		t.Error("rule was compiled twice")
+	}
+	if _, err := c.Compile(`a ==`); err == nil || c.Len() != 1 {
+		t.Errorf("invalid rule: error = %v, Len() = %d", err, c.Len())
+	}
+	c.Compile(`b == 1`)
+	c.Compile(`c == 1`)
+	if again, _ := c.Compile(`a == 1`); c.Len() != 2 || again == first {
+		t.Errorf("Len() = %d after overflow, want 2 without the oldest rule", c.Len())
+	}
+}
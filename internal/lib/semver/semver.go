@@ -0,0 +1,219 @@
+// Package semver parses semantic versions and version ranges for app
+// version targeting.
+package semver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidVersion = errors.New("invalid version")
+	ErrInvalidRange   = errors.New("invalid version range")
+)
+
+// Version is a semantic version. Missing minor and patch numbers are zero,
+// so "7.2" is 7.2.0; build metadata is ignored.
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release, e.g. "beta.1". A pre-release version is lower
+	// than the release.
+	Pre string
+}
+
+// Parse parses a version such as "7.2.1", "v7.2" or "8.0.0-beta.1".
+func Parse(s string) (Version, error) {
+	var v Version
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, found := strings.Cut(s, "-")
+	if found && pre == "" {
+		return Version{}, ErrInvalidVersion
+	}
+	v.Pre = pre
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, ErrInvalidVersion
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+			return Version{}, ErrInvalidVersion
+		}
+		*numbers[i] = n
+	}
+
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than w.
+func (v Version) Compare(w Version) int {
+	for _, d := range [...]int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	switch {
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	}
+
+	return comparePre(v.Pre, w.Pre)
+}
+
+// comparePre compares pre-releases by their dot-separated identifiers:
+// numeric ones numerically and lower than alphanumeric ones.
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return sign(len(as) - len(bs))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+
+	return 0
+}
+
+// Range is a set of versions: alternatives separated by "||", each a list of
+// comparisons that must all hold, e.g. ">=7.2 <8 || 9.1.0". Besides =, !=,
+// <, <=, > and >=, "^7.2" means >=7.2.0 <8.0.0 and "~7.2" means
+// >=7.2.0 <7.3.0.
+type Range struct {
+	alternatives [][]comparison
+}
+
+type comparison struct {
+	op      string
+	version Version
+}
+
+// ParseRange parses a version range.
+func ParseRange(s string) (Range, error) {
+	var r Range
+
+	for _, alternative := range strings.Split(s, "||") {
+		var comparisons []comparison
+		for _, field := range strings.FieldsFunc(alternative, func(c rune) bool { return c == ' ' || c == ',' }) {
+			parsed, err := parseComparison(field)
+			if err != nil {
+				return Range{}, err
+			}
+			comparisons = append(comparisons, parsed...)
+		}
+		if len(comparisons) == 0 {
+			return Range{}, ErrInvalidRange
+		}
+		r.alternatives = append(r.alternatives, comparisons)
+	}
+
+	return r, nil
+}
+
+func parseComparison(s string) ([]comparison, error) {
+	op := ""
+	for _, prefix := range [...]string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	v, err := Parse(s[len(op):])
+	if err != nil {
+		return nil, ErrInvalidRange
+	}
+
+	switch op {
+	case "^":
+		upper := Version{Major: v.Major + 1}
+		if v.Major == 0 {
+			upper = Version{Minor: v.Minor + 1}
+		}
+		return []comparison{{">=", v}, {"<", upper}}, nil
+	case "~":
+		return []comparison{{">=", v}, {"<", Version{Major: v.Major, Minor: v.Minor + 1}}}, nil
+	case "":
+		op = "="
+	}
+
+	return []comparison{{op, v}}, nil
+}
+
+// Contains reports whether v is in the range.
+func (r Range) Contains(v Version) bool {
+	for _, comparisons := range r.alternatives {
+		if all(comparisons, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func all(comparisons []comparison, v Version) bool {
+	for _, c := range comparisons {
+		cmp := v.Compare(c.version)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	// Each version is lower than the next.
+	versions := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.2", "v1.10.0", "7.2.0+build.5", "7.2.1"}
+	for i := 0; i+1 < len(versions); i++ {
+		a, err := Parse(versions[i])
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", versions[i], err)
+		}
+		b, err := Parse(versions[i+1])
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", versions[i+1], err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+			t.Errorf("%s and %s compare wrong", versions[i], versions[i+1])
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "7.", "7.2.1.0", "a.b", "7.-2", "7.+2", "7.2-"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		{">=7.2", "7.2.0", true},
+		{">=7.2", "7.1.9", false},
+		{">=7.2", "7.2.0-beta", false},
+		{">=7.2 <8", "7.9.3", true},
+		{">=7.2, <8", "8.0.0", false},
+		{"^7.2", "7.5.0", true},
+		{"^7.2", "8.0.0", false},
+		{"^0.3", "0.4.0", false},
+		{"~7.2", "7.2.9", true},
+		{"~7.2", "7.3.0", false},
+		{"7.2.1", "7.2.1", true},
+		{"!=7.2.1", "7.2.1", false},
+		{"<6 || >=7.2", "5.0.0", true},
+		{"<6 || >=7.2", "6.5.0", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Fatalf("ParseRange(%s) error = %v", tt.rng, err)
+		}
+		v, err := Parse(tt.version)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.version, err)
+		}
+		if got := r.Contains(v); got != tt.want {
+			t.Errorf("%s contains %s = %t, want %t", tt.rng, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseRangeInvalid(t *testing.T) {
+	for _, s := range []string{"", " ", ">=", ">=7.2 ||", "=>7.2", "7.x"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", s)
+		}
+	}
+}
@@ -8,6 +8,38 @@ type Banner struct {
 	FeatureID int                    `json:"feature_id"`
 	Content   map[string]interface{} `json:"content"`
 	IsActive  bool                   `json:"is_active"`
+	Version   int64                  `json:"version"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
+	// HasDraft tells whether the banner has unpublished changes.
+	HasDraft bool `json:"has_draft"`
+	// DeletedAt is when the banner was moved to the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// DefaultLocale is the language of Content, if known.
+	DefaultLocale string `json:"default_locale,omitempty"`
+	// Locales holds content variants by BCP 47 language tag. Users whose
+	// languages match none of them get Content.
+	Locales map[string]map[string]interface{} `json:"locales,omitempty"`
+	// Platforms and AppVersion, a semver range, restrict the banner to
+	// users of these platforms and app versions. Empty means everyone.
+	Platforms  []string `json:"platforms,omitempty"`
+	AppVersion string   `json:"app_version,omitempty"`
+	// Rule is a targeting expression over attributes of the user, such as
+	// `country == "KZ" and days_since_signup > 7`. Empty means everyone.
+	Rule string `json:"rule,omitempty"`
+	// Template turns on placeholders such as {{name}} in the string values
+	// of the content, filled from request attributes. Nil serves the
+	// content as is.
+	Template *Template `json:"template,omitempty"`
+}
+
+// Template are the placeholder settings of a banner.
+type Template struct {
+	// Variables are the request attributes placeholders may use.
+	Variables []string `json:"variables"`
+	// Escape is how values are escaped: html (the default), url or none.
+	Escape string `json:"escape,omitempty"`
+	// OnMissing is what a placeholder without a value or a default turns
+	// into: empty (the default), keep or error.
+	OnMissing string `json:"on_missing,omitempty"`
 }
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Change request statuses. A pending request is approved or rejected by a
+// reviewer, or canceled when its banner is deleted or restored from a
+// snapshot.
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+	ChangeRequestCanceled = "canceled"
+)
+
+// ChangeRequest is a banner draft submitted for approval. BaseVersion is the
+// banner version the draft was made at; the change can only be approved
+// while the banner is still at it.
+type ChangeRequest struct {
+	ID            int                    `json:"change_request_id"`
+	BannerID      int                    `json:"banner_id"`
+	BaseVersion   int64                  `json:"base_version"`
+	TagIDs        []int                  `json:"tag_ids"`
+	FeatureID     int                    `json:"feature_id"`
+	Content       map[string]interface{} `json:"content"`
+	IsActive      bool                   `json:"is_active"`
+	Status        string                 `json:"status"`
+	Author        string                 `json:"author"`
+	Comment       string                 `json:"comment"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Reviewer      string                 `json:"reviewer,omitempty"`
+	ReviewComment string                 `json:"review_comment,omitempty"`
+	ReviewedAt    *time.Time             `json:"reviewed_at,omitempty"`
+	// DefaultLocale and Locales are the localized content of the draft,
+	// Platforms, AppVersion and Rule its targeting, and Template its
+	// placeholder settings, as in Banner.
+	DefaultLocale string                            `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]interface{} `json:"locales,omitempty"`
+	Platforms     []string                          `json:"platforms,omitempty"`
+	AppVersion    string                            `json:"app_version,omitempty"`
+	Rule          string                            `json:"rule,omitempty"`
+	Template      *Template                         `json:"template,omitempty"`
+}
@@ -1,6 +1,22 @@
 package models
 
+import "time"
+
 type Feature struct {
 	ID   int    `json:"feature_id"`
 	Name string `json:"name"`
+	// RequiresApproval means drafts of the feature's banners are published
+	// through approved change requests only.
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+// FeatureApprovalChange records who turned RequiresApproval of a feature on
+// or off, when and why.
+type FeatureApprovalChange struct {
+	ID               int       `json:"approval_change_id"`
+	FeatureID        int       `json:"feature_id"`
+	RequiresApproval bool      `json:"requires_approval"`
+	ChangedBy        string    `json:"changed_by"`
+	Comment          string    `json:"comment"`
+	ChangedAt        time.Time `json:"changed_at"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyKey is a create request identified by its caller, its
+// Idempotency-Key header, method and path, and the response it got. Status
+// is 0 while the request is in progress.
+type IdempotencyKey struct {
+	Owner       string      `json:"owner"`
+	Key         string      `json:"key"`
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
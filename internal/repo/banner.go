@@ -3,13 +3,18 @@ package repo
 import (
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"banner/internal/server/handlers/banners"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,41 +27,95 @@ func NewBannerRepo(db *pgxpool.Pool, log *slog.Logger) *BannerRepo {
 	return &BannerRepo{db, log}
 }
 
-func (b *BannerRepo) CreateBanner(ctx context.Context, banner *models.Banner) error {
-	err := b.db.QueryRow(ctx,
-		`INSERT INTO banners (feature_id, content, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5) RETURNING id`,
-		banner.FeatureID, banner.Content, banner.IsActive, banner.CreatedAt, banner.UpdatedAt).Scan(&banner.ID)
+// CreateBanner creates the banner unless a banner of its feature with the
+// same targeting already has one of its tags; then it fails with
+// repository.ErrExists and returns the ID of that banner.
+func (b *BannerRepo) CreateBanner(ctx context.Context, banner *models.Banner) (int, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	conflictID, err := b.findConflict(ctx, tx, *banner)
+	if err != nil {
+		return conflictID, err
+	}
 
+	err = tx.QueryRow(ctx,
+		`INSERT INTO banners (feature_id, content, default_locale, locales, platforms, app_version, rule, template, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id, version`,
+		banner.FeatureID, banner.Content, banner.DefaultLocale, nonNilLocales(banner.Locales), nonNilPlatforms(banner.Platforms), banner.AppVersion, banner.Rule, banner.Template, banner.IsActive, banner.CreatedAt, banner.UpdatedAt).Scan(&banner.ID, &banner.Version)
 	if err != nil {
 		b.log.Error("Failed to create banner", logerr.Err(err))
-		return err
+		return 0, err
 	}
 
-	return nil
+	if err := b.insertTags(ctx, tx, banner); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return 0, err
+	}
+
+	return 0, nil
 }
 
-func (b *BannerRepo) FindBannerId(ctx context.Context, id int) (models.Banner, error) {
-	query, err := b.db.Query(ctx, `SELECT * FROM banners WHERE id = $1`, id)
-	if err != nil {
-		b.log.Error("Banner not found", logerr.Err(err))
-		return models.Banner{}, err
+// findConflict fails with repository.ErrExists and the ID of a live banner
+// other than banner that has its feature, its targeting and one of its
+// tags. Concurrent checks for a feature are serialized by an advisory lock
+// on the feature ID, held until tx ends.
+func (b *BannerRepo) findConflict(ctx context.Context, tx pgx.Tx, banner models.Banner) (int, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, banner.FeatureID); err != nil {
+		b.log.Error("Failed to lock feature", logerr.Err(err))
+		return 0, err
 	}
-	defer query.Close()
 
-	resultArray := models.Banner{}
-	for query.Next() {
-		err := query.Scan(&resultArray.ID, &resultArray.FeatureID, &resultArray.Content, &resultArray.IsActive, &resultArray.CreatedAt, &resultArray.UpdatedAt)
-		if err != nil {
-			b.log.Error("Banner not found", logerr.Err(err))
-			return models.Banner{}, err
+	var conflictID int
+	err := tx.QueryRow(ctx,
+		`SELECT b.id FROM banners b JOIN banner_tags bt ON bt.banner_id = b.id
+		 WHERE b.feature_id = $1 AND bt.tag_id = ANY($2) AND b.deleted_at IS NULL AND b.id <> $6
+			AND b.platforms = $3 AND b.app_version = $4 AND b.rule = $5
+		 ORDER BY b.id LIMIT 1`,
+		banner.FeatureID, banner.TagIDs, nonNilPlatforms(banner.Platforms), banner.AppVersion, banner.Rule, banner.ID).Scan(&conflictID)
+	if err == nil {
+		return conflictID, repository.ErrExists
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		b.log.Error("Failed to find conflicting banner", logerr.Err(err))
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+func (b *BannerRepo) FindBannerId(ctx context.Context, id int) (models.Banner, error) {
+	query := `SELECT b.id, b.feature_id, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at,
+			  COALESCE(array_agg(bt.tag_id) FILTER (WHERE bt.tag_id IS NOT NULL), '{}') AS tag_ids,
+			  EXISTS (SELECT 1 FROM banner_drafts d WHERE d.banner_id = b.id) AS has_draft
+			  FROM banners b
+			  LEFT JOIN banner_tags bt ON b.id = bt.banner_id
+			  WHERE b.id = $1 AND b.deleted_at IS NULL
+			  GROUP BY b.id`
+
+	var banner models.Banner
+	err := b.db.QueryRow(ctx, query, id).Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt, &banner.TagIDs, &banner.HasDraft)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Banner{}, repository.ErrNotFound
 		}
+
+		b.log.Error("Failed to find banner", logerr.Err(err))
+		return models.Banner{}, err
 	}
 
-	return resultArray, nil
+	return banner, nil
 }
 
 func (b *BannerRepo) FindBannersFeatureID(ctx context.Context, feature_id int) ([]models.Banner, error) {
-	query, err := b.db.Query(ctx, `SELECT * FROM banners WHERE feature_id = $1`, feature_id)
+	query, err := b.db.Query(ctx, `SELECT id, feature_id, content, is_active, version, created_at, updated_at FROM banners WHERE feature_id = $1 AND deleted_at IS NULL`, feature_id)
 	if err != nil {
 		b.log.Error("Error querying banners", logerr.Err(err))
 		return nil, err
@@ -66,7 +125,7 @@ func (b *BannerRepo) FindBannersFeatureID(ctx context.Context, feature_id int) (
 	var resultSlice []models.Banner
 	for query.Next() {
 		var resultArray models.Banner
-		err := query.Scan(&resultArray.ID, &resultArray.FeatureID, &resultArray.Content, &resultArray.IsActive, &resultArray.CreatedAt, &resultArray.UpdatedAt)
+		err := query.Scan(&resultArray.ID, &resultArray.FeatureID, &resultArray.Content, &resultArray.IsActive, &resultArray.Version, &resultArray.CreatedAt, &resultArray.UpdatedAt)
 		if err != nil {
 			b.log.Error("Error scanning banners", logerr.Err(err))
 			return nil, err
@@ -75,7 +134,7 @@ func (b *BannerRepo) FindBannersFeatureID(ctx context.Context, feature_id int) (
 	}
 
 	if len(resultSlice) == 0 {
-		b.log.Info("No banners found for feature ID:", feature_id)
+		b.log.Info("No banners found for feature ID", slog.Int("feature_id", feature_id))
 		return []models.Banner{}, nil
 	}
 
@@ -102,91 +161,208 @@ func (b *BannerRepo) FindBannersTagID(ctx context.Context, tagId int) ([]models.
 	}
 
 	if len(resultSlice) == 0 {
-		b.log.Info("No banners found for tag ID:", tagId)
+		b.log.Info("No banners found for tag ID", slog.Int("tag_id", tagId))
 		return []models.Banner{}, nil
 	}
 
 	return resultSlice, nil
 }
 
-func (b *BannerRepo) FindBannerFeatureTag(ctx context.Context, featureID, tagID int) (*models.Banner, error) {
-	query := `SELECT b.id, b.feature_id, b.content, b.is_active, b.created_at, b.updated_at
+// FindBannersFeatureTag returns the live banners of the feature with the
+// tag, whose targeting decides which one a user sees.
+func (b *BannerRepo) FindBannersFeatureTag(ctx context.Context, featureID, tagID int) ([]models.Banner, error) {
+	query := `SELECT b.id, b.feature_id, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at
 			  FROM banners b
 			  INNER JOIN banner_tags bt ON b.id = bt.banner_id
-			  WHERE b.feature_id = $1 AND bt.tag_id = $2`
-
-	row := b.db.QueryRow(ctx, query, featureID, tagID)
+			  WHERE b.feature_id = $1 AND bt.tag_id = $2 AND b.deleted_at IS NULL
+			  ORDER BY b.id`
 
-	var banner models.Banner
-
-	err := row.Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt)
+	rows, err := b.db.Query(ctx, query, featureID, tagID)
 	if err != nil {
-		b.log.Error("Error with database", logerr.Err(err))
-		if errors.Is(err, pgx.ErrNoRows) {
+		b.log.Error("Failed to find banners", logerr.Err(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Banner
+	for rows.Next() {
+		var banner models.Banner
+		err := rows.Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt)
+		if err != nil {
+			b.log.Error("Failed to scan banner", logerr.Err(err))
 			return nil, err
 		}
-
-		b.log.Error("Failed to find banner", logerr.Err(err))
+		result = append(result, banner)
+	}
+	if err := rows.Err(); err != nil {
+		b.log.Error("Failed to find banners", logerr.Err(err))
 		return nil, err
 	}
+	if len(result) == 0 {
+		return nil, repository.ErrNotFound
+	}
 
-	return &banner, nil
+	return result, nil
 }
 
-func (b *BannerRepo) FindBannersParameters(ctx context.Context, params banners.RequestGetBanners) ([]models.Banner, error) {
-	query := "SELECT b.id, b.feature_id, b.content, b.is_active, b.created_at, b.updated_at, array_agg(bt.tag_id) AS tag_ids FROM banners b LEFT JOIN banner_tags bt ON b.id = bt.banner_id WHERE 1=1"
-	args := []interface{}{}
+// bannerFilter accumulates WHERE conditions and their positional arguments.
+type bannerFilter struct {
+	conds []string
+	args  []interface{}
+}
 
-	if params.FeatureID != nil {
-		query += " AND b.feature_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, *params.FeatureID)
+// arg adds a query argument and returns its placeholder.
+func (f *bannerFilter) arg(v interface{}) string {
+	f.args = append(f.args, v)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+func (f *bannerFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
 	}
 
-	if params.TagID != nil {
-		query += " AND b.id IN (SELECT banner_id FROM banner_tags WHERE tag_id = $" + strconv.Itoa(len(args)+1) + ")"
-		args = append(args, *params.TagID)
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+func newBannerFilter(params banners.RequestGetBanners) (*bannerFilter, error) {
+	f := &bannerFilter{conds: []string{"b.deleted_at IS NULL"}}
+
+	if len(params.FeatureIDs) > 0 {
+		f.conds = append(f.conds, "b.feature_id = ANY("+f.arg(params.FeatureIDs)+")")
+	}
+	if len(params.TagIDs) > 0 {
+		f.conds = append(f.conds, "b.id IN (SELECT banner_id FROM banner_tags WHERE tag_id = ANY("+f.arg(params.TagIDs)+"))")
+	}
+	if params.IsActive != nil {
+		f.conds = append(f.conds, "b.is_active = "+f.arg(*params.IsActive))
+	}
+	if params.CreatedAfter != nil {
+		f.conds = append(f.conds, "b.created_at >= "+f.arg(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		f.conds = append(f.conds, "b.created_at < "+f.arg(*params.CreatedBefore))
+	}
+	if params.UpdatedAfter != nil {
+		f.conds = append(f.conds, "b.updated_at >= "+f.arg(*params.UpdatedAfter))
+	}
+	if params.UpdatedBefore != nil {
+		f.conds = append(f.conds, "b.updated_at < "+f.arg(*params.UpdatedBefore))
+	}
+	// Both search conditions are served by GIN indexes created with the
+	// tables; the full-text one must match the indexed expression exactly.
+	if params.Text != "" {
+		f.conds = append(f.conds, `jsonb_to_tsvector('simple', b.content, '["string"]') @@ websearch_to_tsquery('simple', `+f.arg(params.Text)+")")
+	}
+	if params.Path != "" {
+		path, err := translateLike(params.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.conds = append(f.conds, "b.content @@ "+f.arg(path)+"::jsonpath")
 	}
 
-	query += " GROUP BY b.id"
+	return f, nil
+}
 
-	if params.Limit != nil {
-		query += " LIMIT $" + strconv.Itoa(len(args)+1)
-		args = append(args, *params.Limit)
+// FindBannersParameters returns one page of banners in a stable order. The
+// page starts after params.After, so deep pages cost as much as the first one
+// given the (sort column, id) indexes.
+func (b *BannerRepo) FindBannersParameters(ctx context.Context, params banners.RequestGetBanners) ([]models.Banner, error) {
+	f, err := newBannerFilter(params)
+	if err != nil {
+		return nil, err
 	}
 
-	if params.Offset != nil {
-		query += " OFFSET $" + strconv.Itoa(len(args)+1)
-		args = append(args, *params.Offset)
+	// Sort and Order are validated by the handler, so they are safe to
+	// interpolate.
+	column := "b." + params.Sort
+	op, dir := ">", "ASC"
+	if params.Order == banners.OrderDesc {
+		op, dir = "<", "DESC"
 	}
 
-	rows, err := b.db.Query(ctx, query, args...)
+	if c := params.After; c != nil {
+		if params.Sort == banners.SortID {
+			f.conds = append(f.conds, "b.id "+op+" "+f.arg(c.ID))
+		} else {
+			f.conds = append(f.conds, "("+column+", b.id) "+op+" ("+f.arg(c.Time)+", "+f.arg(c.ID)+")")
+		}
+	}
+
+	query := `SELECT b.id, b.feature_id, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at,
+			COALESCE(array_agg(bt.tag_id) FILTER (WHERE bt.tag_id IS NOT NULL), '{}'),
+			EXISTS (SELECT 1 FROM banner_drafts d WHERE d.banner_id = b.id)
+		FROM banners b LEFT JOIN banner_tags bt ON b.id = bt.banner_id` + f.where() + `
+		GROUP BY b.id`
+	if params.Sort == banners.SortID {
+		query += " ORDER BY b.id " + dir
+	} else {
+		query += " ORDER BY " + column + " " + dir + ", b.id " + dir
+	}
+	query += " LIMIT " + f.arg(params.Limit)
+
+	rows, err := b.db.Query(ctx, query, f.args...)
 	if err != nil {
 		b.log.Error("Failed to query banners", logerr.Err(err))
-		return nil, err
+		return nil, searchError(err)
 	}
 	defer rows.Close()
 
 	var banners []models.Banner
 	for rows.Next() {
 		var banner models.Banner
-		var tagIDs []int
-		if err := rows.Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt, &tagIDs); err != nil {
+		if err := rows.Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt, &banner.TagIDs, &banner.HasDraft); err != nil {
 			b.log.Error("Failed to scan banner row", logerr.Err(err))
 			return nil, err
 		}
-		banner.TagIDs = tagIDs
 		banners = append(banners, banner)
 	}
 
 	if err := rows.Err(); err != nil {
 		b.log.Error("Error occurred while iterating banner rows", logerr.Err(err))
-		return nil, err
+		return nil, searchError(err)
 	}
 
 	return banners, nil
 }
 
-func (b *BannerRepo) UpdateBanner(ctx context.Context, banner *models.Banner) error {
+func (b *BannerRepo) CountBanners(ctx context.Context, params banners.RequestGetBanners) (int, error) {
+	f, err := newBannerFilter(params)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = b.db.QueryRow(ctx, `SELECT count(*) FROM banners b`+f.where(), f.args...).Scan(&total)
+	if err != nil {
+		b.log.Error("Failed to count banners", logerr.Err(err))
+		return 0, searchError(err)
+	}
+
+	return total, nil
+}
+
+func (b *BannerRepo) FindBannerDraft(ctx context.Context, id int) (models.Banner, error) {
+	query := `SELECT b.id, d.feature_id, d.content, d.default_locale, d.locales, d.platforms, d.app_version, d.rule, d.template, d.is_active, b.version, b.created_at, d.updated_at, d.tag_ids
+			  FROM banners b
+			  JOIN banner_drafts d ON d.banner_id = b.id
+			  WHERE b.id = $1 AND b.deleted_at IS NULL`
+
+	draft := models.Banner{HasDraft: true}
+	err := b.db.QueryRow(ctx, query, id).Scan(&draft.ID, &draft.FeatureID, &draft.Content, &draft.DefaultLocale, &draft.Locales, &draft.Platforms, &draft.AppVersion, &draft.Rule, &draft.Template, &draft.IsActive, &draft.Version, &draft.CreatedAt, &draft.UpdatedAt, &draft.TagIDs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Banner{}, b.draftError(ctx, id, nil)
+	}
+	if err != nil {
+		b.log.Error("Failed to find banner draft", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	return draft, nil
+}
+
+func (b *BannerRepo) SaveBannerDraft(ctx context.Context, draft *models.Banner) error {
 	tx, err := b.db.Begin(ctx)
 	if err != nil {
 		b.log.Error("Failed to begin transaction", logerr.Err(err))
@@ -194,25 +370,388 @@ func (b *BannerRepo) UpdateBanner(ctx context.Context, banner *models.Banner) er
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, `DELETE FROM banner_tags WHERE banner_id = $1`, banner.ID)
+	// The version check and the row lock come first, so concurrent edits
+	// of the banner queue up here and all but the first fail.
+	err = tx.QueryRow(ctx,
+		`UPDATE banners SET version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING version`,
+		draft.ID, draft.Version).Scan(&draft.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return b.versionError(ctx, draft.ID)
+	}
+	if err != nil {
+		b.log.Error("Failed to update banner version", logerr.Err(err))
+		return err
+	}
+
+	if err := b.upsertDraft(ctx, tx, draft); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return err
+	}
+	draft.HasDraft = true
+
+	return nil
+}
+
+// upsertDraft stores draft as the draft of banner draft.ID, replacing the
+// one it has.
+func (b *BannerRepo) upsertDraft(ctx context.Context, tx pgx.Tx, draft *models.Banner) error {
+	tagIDs := draft.TagIDs
+	if tagIDs == nil {
+		tagIDs = []int{}
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO banner_drafts (banner_id, feature_id, tag_ids, content, default_locale, locales, platforms, app_version, rule, template, is_active, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		 ON CONFLICT (banner_id) DO UPDATE SET feature_id = EXCLUDED.feature_id, tag_ids = EXCLUDED.tag_ids,
+			content = EXCLUDED.content, default_locale = EXCLUDED.default_locale, locales = EXCLUDED.locales,
+			platforms = EXCLUDED.platforms, app_version = EXCLUDED.app_version, rule = EXCLUDED.rule, template = EXCLUDED.template,
+			is_active = EXCLUDED.is_active, updated_at = EXCLUDED.updated_at`,
+		draft.ID, draft.FeatureID, tagIDs, draft.Content, draft.DefaultLocale, nonNilLocales(draft.Locales), nonNilPlatforms(draft.Platforms), draft.AppVersion, draft.Rule, draft.Template, draft.IsActive, draft.UpdatedAt)
+	if err != nil {
+		b.log.Error("Failed to save banner draft", logerr.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// PublishBannerDraft copies the draft over the banner and deletes it in one
+// transaction, so users see either the old banner or the whole draft. It
+// fails with repository.ErrExists, wrapped with the ID of the banner, if
+// another live banner has the feature, targeting and one of the tags of the
+// draft.
+func (b *BannerRepo) PublishBannerDraft(ctx context.Context, id int, version int64) (models.Banner, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return models.Banner{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var featureID int
+	draft := models.Banner{ID: id}
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(b.feature_id, 0), d.feature_id, d.tag_ids, d.platforms, d.app_version, d.rule
+		 FROM banners b JOIN banner_drafts d ON d.banner_id = b.id
+		 WHERE b.id = $1 AND b.deleted_at IS NULL`,
+		id).Scan(&featureID, &draft.FeatureID, &draft.TagIDs, &draft.Platforms, &draft.AppVersion, &draft.Rule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Banner{}, b.draftError(ctx, id, &version)
+	}
+	if err != nil {
+		b.log.Error("Failed to find banner draft", logerr.Err(err))
+		return models.Banner{}, err
+	}
+	needsApproval, err := b.lockFeatures(ctx, tx, featureID, draft.FeatureID)
+	if err != nil {
+		return models.Banner{}, err
+	}
+	if needsApproval {
+		return models.Banner{}, repository.ErrApprovalRequired
+	}
+	conflictID, err := b.findConflict(ctx, tx, draft)
+	if errors.Is(err, repository.ErrExists) {
+		return models.Banner{}, fmt.Errorf("banner %d: %w", conflictID, err)
+	}
+	if err != nil {
+		return models.Banner{}, err
+	}
+
+	var banner models.Banner
+	err = tx.QueryRow(ctx,
+		`UPDATE banners b SET feature_id = d.feature_id, content = d.content, default_locale = d.default_locale,
+			locales = d.locales, platforms = d.platforms, app_version = d.app_version, rule = d.rule, template = d.template, is_active = d.is_active,
+			updated_at = CURRENT_TIMESTAMP, version = b.version + 1
+		 FROM banner_drafts d
+		 WHERE b.id = $1 AND b.version = $2 AND b.deleted_at IS NULL AND d.banner_id = b.id
+		 RETURNING b.id, b.feature_id, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at, d.tag_ids`,
+		id, version).Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt, &banner.TagIDs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Banner{}, b.draftError(ctx, id, &version)
+	}
+	if err != nil {
+		b.log.Error("Failed to publish banner draft", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM banner_tags WHERE banner_id = $1`, id)
 	if err != nil {
 		b.log.Error("Failed to delete old tags for banner", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	if err := b.insertTags(ctx, tx, &banner); err != nil {
+		return models.Banner{}, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM banner_drafts WHERE banner_id = $1`, id)
+	if err != nil {
+		b.log.Error("Failed to delete banner draft", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	return banner, nil
+}
+
+// lockFeatures reports whether any of the features requires approval, and
+// keeps them from changing until tx ends, so requires_approval cannot be
+// turned on between the check and the commit.
+func (b *BannerRepo) lockFeatures(ctx context.Context, tx pgx.Tx, ids ...int) (bool, error) {
+	rows, _ := tx.Query(ctx, `SELECT requires_approval FROM features WHERE id = ANY($1) ORDER BY id FOR SHARE`, ids)
+	flags, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		b.log.Error("Failed to check banner features", logerr.Err(err))
+		return false, err
+	}
+
+	return slices.Contains(flags, true), nil
+}
+
+func (b *BannerRepo) DiscardBannerDraft(ctx context.Context, id int, version int64) error {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx,
+		`UPDATE banners SET version = version + 1
+		 WHERE id = $1 AND version = $2 AND deleted_at IS NULL AND EXISTS (SELECT 1 FROM banner_drafts WHERE banner_id = $1)`,
+		id, version)
+	if err != nil {
+		b.log.Error("Failed to update banner version", logerr.Err(err))
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return b.draftError(ctx, id, &version)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM banner_drafts WHERE banner_id = $1`, id)
+	if err != nil {
+		b.log.Error("Failed to delete banner draft", logerr.Err(err))
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
 		return err
 	}
 
+	return nil
+}
+
+// SaveBanners creates the banners with a zero ID and saves the others as
+// drafts, as SaveBannerDraft does, in one transaction: each must still be
+// at its version. Published banners do not change. A draft is submitted as
+// a change request of author if the banner's current or new feature
+// requires approval; the requests are returned. A new banner that would
+// conflict with a live one, as in CreateBanner, fails the whole list with
+// *repository.ConflictError.
+func (b *BannerRepo) SaveBanners(ctx context.Context, list []*models.Banner, author, comment string) ([]models.ChangeRequest, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var changes []models.ChangeRequest
+	created := make(map[int]bool)
+
+	for i, banner := range list {
+		if banner.ID != 0 {
+			var featureID int
+			err = tx.QueryRow(ctx,
+				`UPDATE banners SET version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL RETURNING version, COALESCE(feature_id, 0)`,
+				banner.ID, banner.Version).Scan(&banner.Version, &featureID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("banner %d: %w", banner.ID, b.versionError(ctx, banner.ID))
+			}
+			if err != nil {
+				b.log.Error("Failed to update banner version", logerr.Err(err))
+				return nil, err
+			}
+			if err := b.upsertDraft(ctx, tx, banner); err != nil {
+				return nil, err
+			}
+			banner.HasDraft = true
+
+			needsApproval, err := b.lockFeatures(ctx, tx, featureID, banner.FeatureID)
+			if err != nil {
+				return nil, err
+			}
+			if !needsApproval {
+				continue
+			}
+			change := models.ChangeRequest{BannerID: banner.ID, BaseVersion: banner.Version, Author: author, Comment: comment}
+			err = insertChangeRequest(ctx, tx, &change)
+			if errors.Is(err, repository.ErrExists) {
+				return nil, fmt.Errorf("banner %d has a pending change request: %w", banner.ID, err)
+			}
+			if err != nil {
+				b.log.Error("Failed to create change request", logerr.Err(err))
+				return nil, err
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		conflictID, err := b.findConflict(ctx, tx, *banner)
+		if errors.Is(err, repository.ErrExists) {
+			if created[conflictID] {
+				// The transaction is rolled back, so the banner will not exist.
+				conflictID = 0
+			}
+			return nil, &repository.ConflictError{Index: i, BannerID: conflictID}
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO banners (feature_id, content, default_locale, locales, platforms, app_version, rule, template, is_active, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id, version`,
+			banner.FeatureID, banner.Content, banner.DefaultLocale, nonNilLocales(banner.Locales), nonNilPlatforms(banner.Platforms), banner.AppVersion, banner.Rule, banner.Template, banner.IsActive, banner.CreatedAt, banner.UpdatedAt).Scan(&banner.ID, &banner.Version)
+		if err != nil {
+			b.log.Error("Failed to save banner", logerr.Err(err))
+			return nil, err
+		}
+		if err := b.insertTags(ctx, tx, banner); err != nil {
+			return nil, err
+		}
+		created[banner.ID] = true
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// exportPageSize is how many banners ExportBanners reads at a time.
+const exportPageSize = 1000
+
+// ExportBanners reads banners page by page, so a slow client does not hold a
+// connection for the whole export.
+func (b *BannerRepo) ExportBanners(ctx context.Context, fn func(banners.ExportedBanner) error) error {
+	query := `SELECT b.id, b.feature_id, f.name, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at,
+			COALESCE(array_agg(bt.tag_id ORDER BY bt.tag_id) FILTER (WHERE bt.tag_id IS NOT NULL), '{}'),
+			COALESCE(array_agg(COALESCE(t.name, '') ORDER BY bt.tag_id) FILTER (WHERE bt.tag_id IS NOT NULL), '{}'),
+			EXISTS (SELECT 1 FROM banner_drafts d WHERE d.banner_id = b.id)
+		FROM banners b
+		LEFT JOIN features f ON f.id = b.feature_id
+		LEFT JOIN banner_tags bt ON bt.banner_id = b.id
+		LEFT JOIN tags t ON t.id = bt.tag_id
+		WHERE b.id > $1 AND b.deleted_at IS NULL
+		GROUP BY b.id, f.name
+		ORDER BY b.id
+		LIMIT $2`
+
+	lastID := 0
+	for {
+		rows, err := b.db.Query(ctx, query, lastID, exportPageSize)
+		if err != nil {
+			b.log.Error("Failed to query banners", logerr.Err(err))
+			return err
+		}
+
+		page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (banners.ExportedBanner, error) {
+			var e banners.ExportedBanner
+			err := row.Scan(&e.ID, &e.FeatureID, &e.FeatureName, &e.Content, &e.DefaultLocale, &e.Locales, &e.Platforms, &e.AppVersion, &e.Rule, &e.Template, &e.IsActive, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.TagIDs, &e.TagNames, &e.HasDraft)
+			return e, err
+		})
+		if err != nil {
+			b.log.Error("Failed to scan banner rows", logerr.Err(err))
+			return err
+		}
+
+		for _, banner := range page {
+			if err := fn(banner); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		lastID = page[len(page)-1].ID
+	}
+}
+
+// insertTags links the banner to its tags. A missing tag is
+// repository.ErrInvalidReference.
+func (b *BannerRepo) insertTags(ctx context.Context, tx pgx.Tx, banner *models.Banner) error {
 	for _, tagID := range banner.TagIDs {
-		_, err = tx.Exec(ctx, `INSERT INTO banner_tags (banner_id, tag_id) VALUES ($1, $2)`, banner.ID, tagID)
+		_, err := tx.Exec(ctx, `INSERT INTO banner_tags (banner_id, tag_id) VALUES ($1, $2)`, banner.ID, tagID)
+		// 23503 is a foreign key violation.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("tag %d: %w", tagID, repository.ErrInvalidReference)
+		}
 		if err != nil {
 			b.log.Error("Failed to insert tag for banner", logerr.Err(err))
 			return err
 		}
 	}
 
+	return nil
+}
+
+// nonNilLocales makes banners without content variants store {} rather
+// than NULL.
+func nonNilLocales(locales map[string]map[string]interface{}) map[string]map[string]interface{} {
+	if locales == nil {
+		return map[string]map[string]interface{}{}
+	}
+
+	return locales
+}
+
+// nonNilPlatforms makes banners for all platforms store {} rather than NULL.
+func nonNilPlatforms(platforms []string) []string {
+	if platforms == nil {
+		return []string{}
+	}
+
+	return platforms
+}
+
+// DeleteBannerID moves the banner to the trash and cancels its pending
+// change request. Its tags and draft are kept for a restore.
+func (b *BannerRepo) DeleteBannerID(ctx context.Context, id int, version int64) error {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE banners SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+		 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`,
+		id, version)
+	if err != nil {
+		b.log.Error("Failed to delete banner by ID", logerr.Err(err))
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return b.versionError(ctx, id)
+	}
+
 	_, err = tx.Exec(ctx,
-		`UPDATE banners SET feature_id = $1, content = $2, is_active = $3, updated_at = $4 WHERE id = $5`,
-		banner.FeatureID, banner.Content, banner.IsActive, banner.UpdatedAt, banner.ID)
+		`UPDATE change_requests SET status = $1, reviewed_at = CURRENT_TIMESTAMP WHERE banner_id = $2 AND status = $3`,
+		models.ChangeRequestCanceled, id, models.ChangeRequestPending)
 	if err != nil {
-		b.log.Error("Failed to update banner", logerr.Err(err))
+		b.log.Error("Failed to cancel change requests", logerr.Err(err))
 		return err
 	}
 
@@ -224,12 +763,47 @@ func (b *BannerRepo) UpdateBanner(ctx context.Context, banner *models.Banner) er
 	return nil
 }
 
-func (b *BannerRepo) DeleteBannerID(ctx context.Context, id int) error {
-	_, err := b.db.Exec(ctx, `DELETE FROM banners WHERE id = $1`, id)
+// versionError explains why a versioned write matched no rows: the banner is
+// gone, in the trash or at another version.
+func (b *BannerRepo) versionError(ctx context.Context, id int) error {
+	var exists bool
+	if err := b.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM banners WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists); err != nil {
+		b.log.Error("Failed to check banner", logerr.Err(err))
+		return err
+	}
+
+	if !exists {
+		return repository.ErrNotFound
+	}
+
+	return repository.ErrVersionMismatch
+}
+
+// draftError explains why a draft query matched no rows: the banner is gone,
+// is at another version than the expected one, if given, or has no draft.
+func (b *BannerRepo) draftError(ctx context.Context, id int, version *int64) error {
+	var (
+		current  int64
+		hasDraft bool
+	)
+	err := b.db.QueryRow(ctx,
+		`SELECT version, EXISTS (SELECT 1 FROM banner_drafts WHERE banner_id = $1) FROM banners WHERE id = $1 AND deleted_at IS NULL`,
+		id).Scan(&current, &hasDraft)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.ErrNotFound
+	}
 	if err != nil {
-		b.log.Error("Failed to delete banner by ID", logerr.Err(err))
+		b.log.Error("Failed to check banner", logerr.Err(err))
 		return err
 	}
 
-	return nil
+	if version != nil && *version != current {
+		return repository.ErrVersionMismatch
+	}
+	if !hasDraft {
+		return repository.ErrNoDraft
+	}
+
+	// The draft was published or discarded between the two queries.
+	return repository.ErrVersionMismatch
 }
@@ -0,0 +1,246 @@
+package repo
+
+import (
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/server/handlers/banners"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const changeRequestColumns = `id, banner_id, base_version, COALESCE(feature_id, 0), tag_ids, content, default_locale, locales, platforms, app_version, rule, template,
+	COALESCE(is_active, false), status, author, comment, created_at, COALESCE(reviewer, ''), COALESCE(review_comment, ''), reviewed_at`
+
+func scanChangeRequest(row pgx.Row) (models.ChangeRequest, error) {
+	var req models.ChangeRequest
+	err := row.Scan(&req.ID, &req.BannerID, &req.BaseVersion, &req.FeatureID, &req.TagIDs, &req.Content, &req.DefaultLocale, &req.Locales, &req.Platforms, &req.AppVersion, &req.Rule, &req.Template, &req.IsActive,
+		&req.Status, &req.Author, &req.Comment, &req.CreatedAt, &req.Reviewer, &req.ReviewComment, &req.ReviewedAt)
+
+	return req, err
+}
+
+// CreateChangeRequest copies the banner draft into a pending change request
+// in one statement, so the request holds exactly the draft at BaseVersion.
+func (b *BannerRepo) CreateChangeRequest(ctx context.Context, req *models.ChangeRequest) error {
+	err := insertChangeRequest(ctx, b.db, req)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return b.draftError(ctx, req.BannerID, &req.BaseVersion)
+	}
+	if err != nil && !errors.Is(err, repository.ErrExists) {
+		b.log.Error("Failed to create change request", logerr.Err(err))
+	}
+
+	return err
+}
+
+// queryRower is a transaction or the pool.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// insertChangeRequest copies the draft of banner req.BannerID into a pending
+// request if the banner is at req.BaseVersion. It fails with pgx.ErrNoRows
+// otherwise and with repository.ErrExists if a request is pending.
+func insertChangeRequest(ctx context.Context, q queryRower, req *models.ChangeRequest) error {
+	row := q.QueryRow(ctx,
+		`INSERT INTO change_requests (banner_id, base_version, feature_id, tag_ids, content, default_locale, locales, platforms, app_version, rule, template, is_active, author, comment)
+		 SELECT b.id, b.version, d.feature_id, d.tag_ids, d.content, d.default_locale, d.locales, d.platforms, d.app_version, d.rule, d.template, d.is_active, $3, $4
+		 FROM banners b JOIN banner_drafts d ON d.banner_id = b.id
+		 WHERE b.id = $1 AND b.version = $2 AND b.deleted_at IS NULL
+		 RETURNING `+changeRequestColumns,
+		req.BannerID, req.BaseVersion, req.Author, req.Comment)
+	created, err := scanChangeRequest(row)
+	// 23505 is a unique violation of the one pending request per banner.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return repository.ErrExists
+	}
+	if err != nil {
+		return err
+	}
+	*req = created
+
+	return nil
+}
+
+func (b *BannerRepo) FindChangeRequests(ctx context.Context, filter banners.ChangeRequestFilter) ([]models.ChangeRequest, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, "status = $"+strconv.Itoa(len(args)))
+	}
+	if filter.BannerID != 0 {
+		args = append(args, filter.BannerID)
+		conditions = append(conditions, "banner_id = $"+strconv.Itoa(len(args)))
+	}
+
+	query := `SELECT ` + changeRequestColumns + ` FROM change_requests`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(filter.Limit)
+	}
+
+	rows, _ := b.db.Query(ctx, query, args...)
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ChangeRequest, error) {
+		return scanChangeRequest(row)
+	})
+	if err != nil {
+		b.log.Error("Failed to find change requests", logerr.Err(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *BannerRepo) FindChangeRequest(ctx context.Context, id int) (models.ChangeRequest, error) {
+	req, err := scanChangeRequest(b.db.QueryRow(ctx, `SELECT `+changeRequestColumns+` FROM change_requests WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ChangeRequest{}, repository.ErrNotFound
+	}
+	if err != nil {
+		b.log.Error("Failed to find change request", logerr.Err(err))
+		return models.ChangeRequest{}, err
+	}
+
+	return req, nil
+}
+
+// ApproveChangeRequest publishes the request and records the decision in one
+// transaction: the banner and its tags are replaced with the requested ones
+// and the draft the request was made from is deleted. Like
+// PublishBannerDraft, it fails with repository.ErrExists if another live
+// banner would conflict with the requested one.
+func (b *BannerRepo) ApproveChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, models.Banner, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	req, err := scanChangeRequest(tx.QueryRow(ctx,
+		`SELECT `+changeRequestColumns+` FROM change_requests WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ChangeRequest{}, models.Banner{}, repository.ErrNotFound
+	}
+	if err != nil {
+		b.log.Error("Failed to find change request", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+	if req.Status != models.ChangeRequestPending {
+		return models.ChangeRequest{}, models.Banner{}, repository.ErrDecided
+	}
+
+	conflictID, err := b.findConflict(ctx, tx, models.Banner{
+		ID: req.BannerID, FeatureID: req.FeatureID, TagIDs: req.TagIDs, Platforms: req.Platforms, AppVersion: req.AppVersion, Rule: req.Rule,
+	})
+	if errors.Is(err, repository.ErrExists) {
+		return models.ChangeRequest{}, models.Banner{}, fmt.Errorf("banner %d: %w", conflictID, err)
+	}
+	if err != nil {
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	banner := models.Banner{ID: req.BannerID, TagIDs: req.TagIDs}
+	err = tx.QueryRow(ctx,
+		`UPDATE banners SET feature_id = $1, content = $2, default_locale = $3, locales = $4, platforms = $5, app_version = $6,
+			rule = $7, template = $8, is_active = $9, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		 WHERE id = $10 AND version = $11 AND deleted_at IS NULL
+		 RETURNING feature_id, content, default_locale, locales, platforms, app_version, rule, template, is_active, version, created_at, updated_at`,
+		req.FeatureID, req.Content, req.DefaultLocale, nonNilLocales(req.Locales), nonNilPlatforms(req.Platforms), req.AppVersion, req.Rule, req.Template, req.IsActive, req.BannerID, req.BaseVersion).
+		Scan(&banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The banner was edited, published or deleted after the request.
+		return models.ChangeRequest{}, models.Banner{}, fmt.Errorf("banner %d: %w", req.BannerID, repository.ErrVersionMismatch)
+	}
+	if err != nil {
+		b.log.Error("Failed to apply change request", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM banner_tags WHERE banner_id = $1`, banner.ID)
+	if err != nil {
+		b.log.Error("Failed to delete old tags for banner", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	if err := b.insertTags(ctx, tx, &banner); err != nil {
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM banner_drafts WHERE banner_id = $1`, banner.ID)
+	if err != nil {
+		b.log.Error("Failed to delete banner draft", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	req, err = b.decideChangeRequest(ctx, tx, id, models.ChangeRequestApproved, reviewer, comment)
+	if err != nil {
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	return req, banner, nil
+}
+
+func (b *BannerRepo) RejectChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return models.ChangeRequest{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	req, err := b.decideChangeRequest(ctx, tx, id, models.ChangeRequestRejected, reviewer, comment)
+	if errors.Is(err, repository.ErrDecided) {
+		if _, err := b.FindChangeRequest(ctx, id); err != nil {
+			return models.ChangeRequest{}, err
+		}
+		return models.ChangeRequest{}, repository.ErrDecided
+	}
+	if err != nil {
+		return models.ChangeRequest{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return models.ChangeRequest{}, err
+	}
+
+	return req, nil
+}
+
+// decideChangeRequest records the decision on a pending request.
+func (b *BannerRepo) decideChangeRequest(ctx context.Context, tx pgx.Tx, id int, status, reviewer, comment string) (models.ChangeRequest, error) {
+	req, err := scanChangeRequest(tx.QueryRow(ctx,
+		`UPDATE change_requests SET status = $1, reviewer = $2, review_comment = $3, reviewed_at = CURRENT_TIMESTAMP
+		 WHERE id = $4 AND status = $5
+		 RETURNING `+changeRequestColumns,
+		status, reviewer, comment, id, models.ChangeRequestPending))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ChangeRequest{}, repository.ErrDecided
+	}
+	if err != nil {
+		b.log.Error("Failed to record change request decision", logerr.Err(err))
+		return models.ChangeRequest{}, err
+	}
+
+	return req, nil
+}
@@ -3,10 +3,13 @@ package repo
 import (
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,7 +23,8 @@ func NewFeatureRepo(db *pgxpool.Pool, log *slog.Logger) *FeatureRepo {
 }
 
 func (f *FeatureRepo) CreateFeature(ctx context.Context, feature *models.Feature) error {
-	err := f.db.QueryRow(ctx, `INSERT INTO features (name) VALUES ($1) RETURNING id`, feature.Name).Scan(&feature.ID)
+	err := f.db.QueryRow(ctx, `INSERT INTO features (name, requires_approval) VALUES ($1, $2) RETURNING id`,
+		feature.Name, feature.RequiresApproval).Scan(&feature.ID)
 	if err != nil {
 		f.log.Error("Failed to create feature", logerr.Err(err))
 		return err
@@ -31,7 +35,11 @@ func (f *FeatureRepo) CreateFeature(ctx context.Context, feature *models.Feature
 
 func (f *FeatureRepo) FindFeatureId(ctx context.Context, id int) (models.Feature, error) {
 	var res models.Feature
-	err := f.db.QueryRow(ctx, `SELECT id, name FROM features WHERE id = $1`, id).Scan(&res.ID, &res.Name)
+	err := f.db.QueryRow(ctx, `SELECT id, COALESCE(name, ''), requires_approval FROM features WHERE id = $1`, id).
+		Scan(&res.ID, &res.Name, &res.RequiresApproval)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Feature{}, repository.ErrNotFound
+	}
 	if err != nil {
 		f.log.Error("Failed to find Feature by ID", logerr.Err(err))
 		return models.Feature{}, err
@@ -41,7 +49,7 @@ func (f *FeatureRepo) FindFeatureId(ctx context.Context, id int) (models.Feature
 }
 
 func (f *FeatureRepo) FindFeatureByName(ctx context.Context, name string) (models.Feature, error) {
-	query, err := f.db.Query(ctx, `SELECT * FROM features WHERE name = $1`, name)
+	query, err := f.db.Query(ctx, `SELECT id, name, requires_approval FROM features WHERE name = $1`, name)
 	if err != nil {
 		f.log.Error("Feature not found", logerr.Err(err))
 		return models.Feature{}, err
@@ -52,7 +60,7 @@ func (f *FeatureRepo) FindFeatureByName(ctx context.Context, name string) (model
 		f.log.Error("Feature not found")
 		return models.Feature{}, fmt.Errorf("Feature not found")
 	} else {
-		err := query.Scan(&res.ID, &res.Name)
+		err := query.Scan(&res.ID, &res.Name, &res.RequiresApproval)
 		if err != nil {
 			f.log.Error("Feature not found", logerr.Err(err))
 		}
@@ -60,3 +68,93 @@ func (f *FeatureRepo) FindFeatureByName(ctx context.Context, name string) (model
 
 	return res, nil
 }
+
+func (f *FeatureRepo) FindFeatures(ctx context.Context) ([]models.Feature, error) {
+	rows, _ := f.db.Query(ctx, `SELECT id, COALESCE(name, ''), requires_approval FROM features ORDER BY id`)
+	result, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Feature])
+	if err != nil {
+		f.log.Error("Failed to find features", logerr.Err(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpdateFeature saves the feature and, if its requires_approval changes,
+// records the change by changedBy in the same transaction. The update waits
+// for publishes and imports that checked the flag to commit.
+func (f *FeatureRepo) UpdateFeature(ctx context.Context, feature *models.Feature, changedBy, comment string) error {
+	tx, err := f.db.Begin(ctx)
+	if err != nil {
+		f.log.Error("Failed to begin transaction", logerr.Err(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var requiredApproval bool
+	err = tx.QueryRow(ctx, `SELECT requires_approval FROM features WHERE id = $1 FOR UPDATE`, feature.ID).Scan(&requiredApproval)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		f.log.Error("Failed to find feature", logerr.Err(err))
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE features SET name = $1, requires_approval = $2 WHERE id = $3`,
+		feature.Name, feature.RequiresApproval, feature.ID)
+	if err != nil {
+		f.log.Error("Failed to update feature", logerr.Err(err))
+		return err
+	}
+
+	if feature.RequiresApproval != requiredApproval {
+		_, err = tx.Exec(ctx, `INSERT INTO feature_approval_changes (feature_id, requires_approval, changed_by, comment) VALUES ($1, $2, $3, $4)`,
+			feature.ID, feature.RequiresApproval, changedBy, comment)
+		if err != nil {
+			f.log.Error("Failed to record feature approval change", logerr.Err(err))
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		f.log.Error("Failed to commit transaction", logerr.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// FindFeatureApprovalChanges returns the requires_approval changes of the
+// feature, newest first. They are kept after the feature is deleted.
+func (f *FeatureRepo) FindFeatureApprovalChanges(ctx context.Context, id int) ([]models.FeatureApprovalChange, error) {
+	rows, _ := f.db.Query(ctx,
+		`SELECT id, feature_id, requires_approval, changed_by, comment, changed_at
+		 FROM feature_approval_changes WHERE feature_id = $1 ORDER BY id DESC`, id)
+	result, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.FeatureApprovalChange])
+	if err != nil {
+		f.log.Error("Failed to find feature approval changes", logerr.Err(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (f *FeatureRepo) DeleteFeature(ctx context.Context, id int) error {
+	cmd, err := f.db.Exec(ctx, `DELETE FROM features WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM banners WHERE feature_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM banner_drafts WHERE feature_id = $1)`, id)
+	if err != nil {
+		f.log.Error("Failed to delete feature", logerr.Err(err))
+		return err
+	}
+	if cmd.RowsAffected() == 1 {
+		return nil
+	}
+
+	if _, err := f.FindFeatureId(ctx, id); err != nil {
+		return err
+	}
+
+	return repository.ErrInUse
+}
@@ -0,0 +1,100 @@
+package repo
+
+import (
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdempotencyRepo struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewIdempotencyRepo(db *pgxpool.Pool, log *slog.Logger) *IdempotencyRepo {
+	return &IdempotencyRepo{db, log}
+}
+
+// ReserveIdempotencyKey inserts the key as in progress, or takes over a
+// record that expired or whose request was abandoned. Otherwise it returns
+// the existing record.
+func (i *IdempotencyRepo) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyKey, error) {
+	// Postgres keeps microseconds; the record is later matched by created_at.
+	key.CreatedAt = key.CreatedAt.Truncate(time.Microsecond)
+
+	for {
+		tag, err := i.db.Exec(ctx,
+			`INSERT INTO idempotency_keys (owner, key, method, path, fingerprint, status, header, body, created_at)
+			 VALUES ($1, $2, $3, $4, $5, 0, NULL, NULL, $6)
+			 ON CONFLICT (owner, key, method, path) DO UPDATE
+			 SET fingerprint = EXCLUDED.fingerprint, status = 0, header = NULL, body = NULL, created_at = EXCLUDED.created_at
+			 WHERE idempotency_keys.created_at < $7
+			    OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < $8)`,
+			key.Owner, key.Key, key.Method, key.Path, key.Fingerprint, key.CreatedAt, expiredBefore, abandonedBefore)
+		if err != nil {
+			i.log.Error("Failed to reserve idempotency key", logerr.Err(err))
+			return nil, err
+		}
+		if tag.RowsAffected() == 1 {
+			return nil, nil
+		}
+
+		existing := models.IdempotencyKey{Owner: key.Owner, Key: key.Key, Method: key.Method, Path: key.Path}
+		err = i.db.QueryRow(ctx,
+			`SELECT fingerprint, status, header, body, created_at FROM idempotency_keys
+			 WHERE owner = $1 AND key = $2 AND method = $3 AND path = $4`,
+			key.Owner, key.Key, key.Method, key.Path).Scan(&existing.Fingerprint, &existing.Status, &existing.Header, &existing.Body, &existing.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The record was released in the meantime, try again.
+			continue
+		}
+		if err != nil {
+			i.log.Error("Failed to find idempotency key", logerr.Err(err))
+			return nil, err
+		}
+
+		return &existing, nil
+	}
+}
+
+func (i *IdempotencyRepo) SaveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	_, err := i.db.Exec(ctx,
+		`UPDATE idempotency_keys SET status = $1, header = $2, body = $3
+		 WHERE owner = $4 AND key = $5 AND method = $6 AND path = $7 AND fingerprint = $8 AND created_at = $9`,
+		key.Status, key.Header, key.Body, key.Owner, key.Key, key.Method, key.Path, key.Fingerprint, key.CreatedAt)
+	if err != nil {
+		i.log.Error("Failed to save idempotency key", logerr.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+func (i *IdempotencyRepo) DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	_, err := i.db.Exec(ctx,
+		`DELETE FROM idempotency_keys WHERE owner = $1 AND key = $2 AND method = $3 AND path = $4 AND created_at = $5`,
+		key.Owner, key.Key, key.Method, key.Path, key.CreatedAt)
+	if err != nil {
+		i.log.Error("Failed to delete idempotency key", logerr.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes records created before the given time.
+func (i *IdempotencyRepo) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := i.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		i.log.Error("Failed to delete expired idempotency keys", logerr.Err(err))
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"banner/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// translateLike rewrites SQL-style `like "pattern"` predicates, which
+// Postgres jsonpath lacks, into anchored `like_regex` ones. In patterns %
+// matches any string, _ any character and \ escapes the next character. The
+// rest of the expression is passed through unchanged.
+func translateLike(expr string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(expr); {
+		switch {
+		case expr[i] == '"':
+			end, err := stringEnd(expr, i)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(expr[i:end])
+			i = end
+		case isKeyword(expr, i, "like"):
+			j := i + len("like")
+			for j < len(expr) && expr[j] == ' ' {
+				j++
+			}
+			if j == len(expr) || expr[j] != '"' {
+				return "", fmt.Errorf("%w: like must be followed by a string", repository.ErrInvalidQuery)
+			}
+			end, err := stringEnd(expr, j)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(`like_regex "` + likeToRegex(unquote(expr[j+1:end-1])) + `" flag "s"`)
+			i = end
+		default:
+			out.WriteByte(expr[i])
+			i++
+		}
+	}
+
+	return out.String(), nil
+}
+
+// stringEnd returns the index just past the string literal starting at i.
+func stringEnd(expr string, i int) (int, error) {
+	for j := i + 1; j < len(expr); j++ {
+		switch expr[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: unterminated string", repository.ErrInvalidQuery)
+}
+
+func isKeyword(expr string, i int, word string) bool {
+	if !strings.HasPrefix(expr[i:], word) {
+		return false
+	}
+	if i > 0 && isIdent(expr[i-1]) {
+		return false
+	}
+	end := i + len(word)
+
+	return end == len(expr) || !isIdent(expr[end])
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func unquote(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		out.WriteByte(s[i])
+	}
+
+	return out.String()
+}
+
+// likeToRegex converts a LIKE pattern to an anchored regular expression,
+// quoted for a jsonpath string literal.
+func likeToRegex(pattern string) string {
+	var out strings.Builder
+	out.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '%':
+			out.WriteString(".*")
+		case c == '_':
+			out.WriteString(".")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			out.WriteString(regexLiteral(pattern[i]))
+		default:
+			out.WriteString(regexLiteral(c))
+		}
+	}
+	out.WriteString("$")
+
+	return out.String()
+}
+
+// regexLiteral matches c literally. Backslashes are doubled because the
+// regex is embedded in a jsonpath string.
+func regexLiteral(c byte) string {
+	switch {
+	case strings.IndexByte(`.^$*+?()[]{}|\`, c) >= 0:
+		return `\\` + string(c)
+	case c == '"':
+		return `\"`
+	default:
+		return string(c)
+	}
+}
+
+// searchError reports Postgres errors caused by a malformed search as
+// repository.ErrInvalidQuery.
+func searchError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	// 42601 is a jsonpath syntax error, 2201B a bad regular expression and
+	// class 2203x other SQL/JSON errors.
+	if pgErr.Code == "42601" || pgErr.Code == "2201B" || strings.HasPrefix(pgErr.Code, "2203") {
+		return fmt.Errorf("%w: %s", repository.ErrInvalidQuery, pgErr.Message)
+	}
+
+	return err
+}
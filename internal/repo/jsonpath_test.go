@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"banner/internal/repository"
+	"errors"
+	"testing"
+)
+
+func TestTranslateLike(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`$.title like "Sale%"`, `$.title like_regex "^Sale.*$" flag "s"`},
+		{`$.url like "%/promo/spring?_"`, `$.url like_regex "^.*/promo/spring\\?.$" flag "s"`},
+		{`$.text like "100\\%"`, `$.text like_regex "^100%$" flag "s"`},
+		{`$.title == "like \"x\"" && $.a like "b"`, `$.title == "like \"x\"" && $.a like_regex "^b$" flag "s"`},
+		{`$.title like_regex "^a"`, `$.title like_regex "^a"`},
+		{`$.likes > 10`, `$.likes > 10`},
+	}
+
+	for _, tt := range tests {
+		got, err := translateLike(tt.expr)
+		if err != nil || got != tt.want {
+			t.Errorf("translateLike(%s) = %s, %v; want %s", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestTranslateLikeInvalid(t *testing.T) {
+	for _, expr := range []string{`$.title like 10`, `$.title like "Sale`, `$.title == "x`} {
+		if _, err := translateLike(expr); !errors.Is(err, repository.ErrInvalidQuery) {
+			t.Errorf("translateLike(%s) error = %v, want ErrInvalidQuery", expr, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package repo
+
+import (
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/snapshot"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SnapshotRepo struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewSnapshotRepo(db *pgxpool.Pool, log *slog.Logger) *SnapshotRepo {
+	return &SnapshotRepo{db, log}
+}
+
+// Load reads the banner configuration tables in one repeatable read
+// transaction, so the snapshot is consistent while the service runs.
+func (s *SnapshotRepo) Load(ctx context.Context) (*snapshot.Snapshot, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		s.log.Error("Failed to begin transaction", logerr.Err(err))
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	snap := &snapshot.Snapshot{CreatedAt: time.Now().UTC()}
+
+	rows, _ := tx.Query(ctx, `SELECT id, COALESCE(name, ''), requires_approval FROM features ORDER BY id`)
+	snap.Features, err = pgx.CollectRows(rows, pgx.RowToStructByPos[models.Feature])
+	if err != nil {
+		return nil, s.loadError("features", err)
+	}
+
+	rows, _ = tx.Query(ctx, `SELECT id, COALESCE(name, '') FROM tags ORDER BY id`)
+	snap.Tags, err = pgx.CollectRows(rows, pgx.RowToStructByPos[models.Tag])
+	if err != nil {
+		return nil, s.loadError("tags", err)
+	}
+
+	rows, _ = tx.Query(ctx, `SELECT id, COALESCE(feature_id, 0), content, default_locale, locales, platforms, app_version, rule, template, COALESCE(is_active, false), version, created_at, updated_at, deleted_at
+		FROM banners ORDER BY id`)
+	snap.Banners, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (snapshot.Banner, error) {
+		var b snapshot.Banner
+		err := row.Scan(&b.ID, &b.FeatureID, &b.Content, &b.DefaultLocale, &b.Locales, &b.Platforms, &b.AppVersion, &b.Rule, &b.Template, &b.IsActive, &b.Version, &b.CreatedAt, &b.UpdatedAt, &b.DeletedAt)
+		b.CreatedAt, b.UpdatedAt = b.CreatedAt.UTC(), b.UpdatedAt.UTC()
+		if b.DeletedAt != nil {
+			deletedAt := b.DeletedAt.UTC()
+			b.DeletedAt = &deletedAt
+		}
+		return b, err
+	})
+	if err != nil {
+		return nil, s.loadError("banners", err)
+	}
+
+	rows, _ = tx.Query(ctx, `SELECT banner_id, tag_id FROM banner_tags ORDER BY banner_id, tag_id`)
+	snap.BannerTags, err = pgx.CollectRows(rows, pgx.RowToStructByPos[models.BannerTag])
+	if err != nil {
+		return nil, s.loadError("banner_tags", err)
+	}
+
+	rows, _ = tx.Query(ctx, `SELECT banner_id, COALESCE(feature_id, 0), tag_ids, content, default_locale, locales, platforms, app_version, rule, template, COALESCE(is_active, false), updated_at
+		FROM banner_drafts ORDER BY banner_id`)
+	snap.Drafts, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (snapshot.Draft, error) {
+		var d snapshot.Draft
+		err := row.Scan(&d.BannerID, &d.FeatureID, &d.TagIDs, &d.Content, &d.DefaultLocale, &d.Locales, &d.Platforms, &d.AppVersion, &d.Rule, &d.Template, &d.IsActive, &d.UpdatedAt)
+		d.UpdatedAt = d.UpdatedAt.UTC()
+		return d, err
+	})
+	if err != nil {
+		return nil, s.loadError("banner_drafts", err)
+	}
+
+	return snap, nil
+}
+
+func (s *SnapshotRepo) loadError(table string, err error) error {
+	s.log.Error("Failed to read "+table, logerr.Err(err))
+	return fmt.Errorf("failed to read %s: %w", table, err)
+}
+
+// Restore replaces the banner configuration tables with the snapshot in one
+// transaction, keeping its IDs. Stored idempotent responses are dropped, as
+// they may refer to rows that no longer exist, and so are banner drafts when
+// the snapshot has none. Pending change requests are canceled; decided ones
+// are kept as the record of approvals.
+func (s *SnapshotRepo) Restore(ctx context.Context, snap *snapshot.Snapshot) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.log.Error("Failed to begin transaction", logerr.Err(err))
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `TRUNCATE banner_tags, banner_drafts, banners, tags, features, idempotency_keys`)
+	if err != nil {
+		s.log.Error("Failed to clear tables", logerr.Err(err))
+		return fmt.Errorf("failed to clear tables: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE change_requests SET status = $1, reviewed_at = CURRENT_TIMESTAMP WHERE status = $2`,
+		models.ChangeRequestCanceled, models.ChangeRequestPending)
+	if err != nil {
+		s.log.Error("Failed to cancel change requests", logerr.Err(err))
+		return fmt.Errorf("failed to cancel change requests: %w", err)
+	}
+
+	features := make([][]any, len(snap.Features))
+	for i, f := range snap.Features {
+		features[i] = []any{f.ID, f.Name, f.RequiresApproval}
+	}
+	tags := make([][]any, len(snap.Tags))
+	for i, t := range snap.Tags {
+		tags[i] = []any{t.ID, t.Name}
+	}
+	banners := make([][]any, len(snap.Banners))
+	for i, b := range snap.Banners {
+		banners[i] = []any{b.ID, b.FeatureID, b.Content, b.DefaultLocale, nonNilLocales(b.Locales), nonNilPlatforms(b.Platforms), b.AppVersion, b.Rule, b.Template, b.IsActive, b.Version, b.CreatedAt, b.UpdatedAt, b.DeletedAt}
+	}
+	bannerTags := make([][]any, len(snap.BannerTags))
+	for i, bt := range snap.BannerTags {
+		bannerTags[i] = []any{bt.BannerID, bt.TagID}
+	}
+	drafts := make([][]any, len(snap.Drafts))
+	for i, d := range snap.Drafts {
+		tagIDs := d.TagIDs
+		if tagIDs == nil {
+			tagIDs = []int{}
+		}
+		drafts[i] = []any{d.BannerID, d.FeatureID, tagIDs, d.Content, d.DefaultLocale, nonNilLocales(d.Locales), nonNilPlatforms(d.Platforms), d.AppVersion, d.Rule, d.Template, d.IsActive, d.UpdatedAt}
+	}
+
+	// Referenced tables first, for the foreign keys of banner_tags and
+	// banner_drafts.
+	tables := []struct {
+		name    string
+		columns []string
+		rows    [][]any
+	}{
+		{"features", []string{"id", "name", "requires_approval"}, features},
+		{"tags", []string{"id", "name"}, tags},
+		{"banners", []string{"id", "feature_id", "content", "default_locale", "locales", "platforms", "app_version", "rule", "template", "is_active", "version", "created_at", "updated_at", "deleted_at"}, banners},
+		{"banner_tags", []string{"banner_id", "tag_id"}, bannerTags},
+		{"banner_drafts", []string{"banner_id", "feature_id", "tag_ids", "content", "default_locale", "locales", "platforms", "app_version", "rule", "template", "is_active", "updated_at"}, drafts},
+	}
+	for _, table := range tables {
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{table.name}, table.columns, pgx.CopyFromRows(table.rows))
+		if err != nil {
+			s.log.Error("Failed to restore "+table.name, logerr.Err(err))
+			return fmt.Errorf("failed to restore %s: %w", table.name, err)
+		}
+	}
+
+	// New rows must get IDs after the restored ones.
+	for _, table := range []string{"features", "tags", "banners"} {
+		_, err := tx.Exec(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s`, table))
+		if err != nil {
+			s.log.Error("Failed to reset "+table+" ID sequence", logerr.Err(err))
+			return fmt.Errorf("failed to reset %s ID sequence: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Failed to commit transaction", logerr.Err(err))
+		return err
+	}
+
+	return nil
+}
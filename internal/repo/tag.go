@@ -3,10 +3,13 @@ package repo
 import (
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -32,6 +35,9 @@ func (t *TagRepo) CreateTag(ctx context.Context, tag *models.Tag) error {
 func (t *TagRepo) FindTagId(ctx context.Context, id int) (models.Tag, error) {
 	var tag models.Tag
 	err := t.db.QueryRow(ctx, `SELECT id, name FROM tags WHERE id = $1`, id).Scan(&tag.ID, &tag.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Tag{}, repository.ErrNotFound
+	}
 	if err != nil {
 		t.log.Error("Failed to find Tag by ID", logerr.Err(err))
 		return models.Tag{}, err
@@ -61,3 +67,46 @@ func (t *TagRepo) FindTagName(ctx context.Context, name string) (models.Tag, err
 
 	return res, nil
 }
+
+func (t *TagRepo) FindTags(ctx context.Context) ([]models.Tag, error) {
+	rows, _ := t.db.Query(ctx, `SELECT id, COALESCE(name, '') FROM tags ORDER BY id`)
+	result, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Tag])
+	if err != nil {
+		t.log.Error("Failed to find tags", logerr.Err(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (t *TagRepo) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	cmd, err := t.db.Exec(ctx, `UPDATE tags SET name = $1 WHERE id = $2`, tag.Name, tag.ID)
+	if err != nil {
+		t.log.Error("Failed to update tag", logerr.Err(err))
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (t *TagRepo) DeleteTag(ctx context.Context, id int) error {
+	cmd, err := t.db.Exec(ctx, `DELETE FROM tags WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM banner_tags WHERE tag_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM banner_drafts WHERE $1 = ANY(tag_ids))`, id)
+	if err != nil {
+		t.log.Error("Failed to delete tag", logerr.Err(err))
+		return err
+	}
+	if cmd.RowsAffected() == 1 {
+		return nil
+	}
+
+	if _, err := t.FindTagId(ctx, id); err != nil {
+		return err
+	}
+
+	return repository.ErrInUse
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const trashedBannerQuery = `SELECT b.id, b.feature_id, b.content, b.default_locale, b.locales, b.platforms, b.app_version, b.rule, b.template, b.is_active, b.version, b.created_at, b.updated_at, b.deleted_at,
+		COALESCE(array_agg(bt.tag_id) FILTER (WHERE bt.tag_id IS NOT NULL), '{}'),
+		EXISTS (SELECT 1 FROM banner_drafts d WHERE d.banner_id = b.id)
+	FROM banners b LEFT JOIN banner_tags bt ON b.id = bt.banner_id`
+
+func scanTrashedBanner(row pgx.Row) (models.Banner, error) {
+	var banner models.Banner
+	err := row.Scan(&banner.ID, &banner.FeatureID, &banner.Content, &banner.DefaultLocale, &banner.Locales, &banner.Platforms, &banner.AppVersion, &banner.Rule, &banner.Template, &banner.IsActive, &banner.Version, &banner.CreatedAt, &banner.UpdatedAt, &banner.DeletedAt, &banner.TagIDs, &banner.HasDraft)
+
+	return banner, err
+}
+
+// FindTrashedBanners returns banners in the trash, most recently deleted
+// first.
+func (b *BannerRepo) FindTrashedBanners(ctx context.Context, limit int) ([]models.Banner, error) {
+	rows, _ := b.db.Query(ctx, trashedBannerQuery+`
+		WHERE b.deleted_at IS NOT NULL
+		GROUP BY b.id
+		ORDER BY b.deleted_at DESC, b.id DESC
+		LIMIT $1`, limit)
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Banner, error) {
+		return scanTrashedBanner(row)
+	})
+	if err != nil {
+		b.log.Error("Failed to find trashed banners", logerr.Err(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *BannerRepo) FindTrashedBanner(ctx context.Context, id int) (models.Banner, error) {
+	banner, err := scanTrashedBanner(b.db.QueryRow(ctx, trashedBannerQuery+`
+		WHERE b.id = $1 AND b.deleted_at IS NOT NULL
+		GROUP BY b.id`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Banner{}, repository.ErrNotFound
+	}
+	if err != nil {
+		b.log.Error("Failed to find trashed banner", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	return banner, nil
+}
+
+// RestoreBanner takes the banner out of the trash with its tags and draft,
+// unless a live banner of its feature with the same targeting has one of its
+// tags; then it fails with repository.ErrExists.
+func (b *BannerRepo) RestoreBanner(ctx context.Context, id int, version int64) (models.Banner, error) {
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		b.log.Error("Failed to begin transaction", logerr.Err(err))
+		return models.Banner{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	trashed, err := scanTrashedBanner(tx.QueryRow(ctx, trashedBannerQuery+`
+		WHERE b.id = $1 AND b.deleted_at IS NOT NULL
+		GROUP BY b.id`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Banner{}, repository.ErrNotFound
+	}
+	if err != nil {
+		b.log.Error("Failed to find trashed banner", logerr.Err(err))
+		return models.Banner{}, err
+	}
+	if trashed.Version != version {
+		return models.Banner{}, repository.ErrVersionMismatch
+	}
+
+	conflictID, err := b.findConflict(ctx, tx, trashed)
+	if errors.Is(err, repository.ErrExists) {
+		return models.Banner{}, fmt.Errorf("banner %d: %w", conflictID, err)
+	}
+	if err != nil {
+		return models.Banner{}, err
+	}
+
+	cmd, err := tx.Exec(ctx,
+		`UPDATE banners SET deleted_at = NULL, version = version + 1
+		 WHERE id = $1 AND version = $2 AND deleted_at IS NOT NULL`,
+		id, version)
+	if err != nil {
+		b.log.Error("Failed to restore banner", logerr.Err(err))
+		return models.Banner{}, err
+	}
+	if cmd.RowsAffected() == 0 {
+		// Restored or purged meanwhile.
+		if _, err := b.FindTrashedBanner(ctx, id); err != nil {
+			return models.Banner{}, err
+		}
+		return models.Banner{}, repository.ErrVersionMismatch
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		b.log.Error("Failed to commit transaction", logerr.Err(err))
+		return models.Banner{}, err
+	}
+
+	return b.FindBannerId(ctx, id)
+}
+
+// PurgeBanners deletes banners moved to the trash before the given time,
+// with their tags and drafts.
+func (b *BannerRepo) PurgeBanners(ctx context.Context, before time.Time) (int64, error) {
+	cmd, err := b.db.Exec(ctx, `DELETE FROM banners WHERE deleted_at < $1`, before)
+	if err != nil {
+		b.log.Error("Failed to purge trashed banners", logerr.Err(err))
+		return 0, err
+	}
+
+	return cmd.RowsAffected(), nil
+}
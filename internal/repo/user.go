@@ -3,10 +3,13 @@ package repo
 import (
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -24,6 +27,11 @@ func (u *UserRepo) CreateUser(ctx context.Context, user *models.User) error {
 		`INSERT INTO users (username, password, role)
 		VALUES ($1,$2,$3)
 		RETURNING id`, user.Username, user.Password, user.Role).Scan(&user.ID)
+	// 23505 is a unique violation of the username.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return repository.ErrExists
+	}
 	if err != nil {
 		u.log.Error("Failed to create user", logerr.Err(err))
 		return err
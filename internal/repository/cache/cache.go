@@ -2,58 +2,431 @@ package cache
 
 import (
 	"banner/internal/models"
+	"banner/internal/repository"
+	"container/list"
+	"errors"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Status describes how a banner was served.
+type Status string
+
+const (
+	StatusHit   Status = "HIT"
+	StatusMiss  Status = "MISS"
+	StatusStale Status = "STALE"
 )
 
+const (
+	defaultShards     = 16
+	defaultMaxEntries = 100_000
+)
+
+type Options struct {
+	// TTL is how long an entry is served without a refresh.
+	TTL time.Duration
+	// HardTTL is how long an entry may be served at all, e.g. while the
+	// database is unavailable.
+	HardTTL time.Duration
+	// NegativeTTL is how long a "not found" result is remembered. Zero
+	// disables negative caching.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the number of entries; the least recently used
+	// entries are evicted first.
+	MaxEntries int
+	Shards     int
+	// CleanupInterval is how often expired entries are removed. Zero
+	// disables the janitor.
+	CleanupInterval time.Duration
+}
+
+type Key struct {
+	FeatureID int
+	TagID     int
+}
+
+func (k Key) String() string {
+	return strconv.Itoa(k.FeatureID) + "-" + strconv.Itoa(k.TagID)
+}
+
+// Cache keeps user banners by feature and tag: all banners of the feature
+// with the tag, as their targeting picks the one a user sees. It is split into shards, each
+// with its own lock and LRU list, so lookups for different keys rarely
+// contend.
 type Cache struct {
-	Banner    models.Banner
-	UpdatedAt time.Time
+	shards      []*shard
+	ttl         time.Duration
+	hardTTL     time.Duration
+	negativeTTL time.Duration
+
+	// loads collapses concurrent misses for the same key into one fetch.
+	loads singleflight.Group
+	stats counters
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type shard struct {
+	sync.Mutex
+	items map[Key]*list.Element
+	lru   *list.List
+	max   int
+	// gens counts the invalidations of keys with a fetch in flight. A fetch
+	// whose key was invalidated while it ran may have read the old rows and
+	// drops its result.
+	gens map[Key]uint64
+}
+
+type entry struct {
+	key       Key
+	banners   []models.Banner
+	updatedAt time.Time
+	// notFound marks a negative entry: there is no banner for the key.
+	notFound bool
+}
+
+type counters struct {
+	hits, negativeHits, misses, stale, coalesced, evictions, expired atomic.Int64
 }
 
-type CacheBanner struct {
-	Banners map[string]Cache
-	sync.RWMutex
+type Stats struct {
+	Entries      int   `json:"entries"`
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	Stale        int64 `json:"stale"`
+	Coalesced    int64 `json:"coalesced"`
+	Evictions    int64 `json:"evictions"`
+	Expired      int64 `json:"expired"`
 }
 
-var cache CacheBanner
+func New(opts Options) *Cache {
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultMaxEntries
+	}
+	if opts.HardTTL < opts.TTL {
+		opts.HardTTL = opts.TTL
+	}
+
+	perShard := (opts.MaxEntries + opts.Shards - 1) / opts.Shards
+	c := &Cache{
+		shards:      make([]*shard, opts.Shards),
+		ttl:         opts.TTL,
+		hardTTL:     opts.HardTTL,
+		negativeTTL: opts.NegativeTTL,
+		stop:        make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			items: make(map[Key]*list.Element),
+			lru:   list.New(),
+			max:   perShard,
+			gens:  make(map[Key]uint64),
+		}
+	}
 
-func init() {
-	cache = CacheBanner{
-		Banners: make(map[string]Cache),
+	if opts.CleanupInterval > 0 {
+		go c.janitor(opts.CleanupInterval)
 	}
+
+	return c
+}
+
+// Close stops the janitor.
+func (c *Cache) Close() {
+	c.stopOnce.Do(func() { close(c.stop) })
 }
 
-func GenerateCacheKey(featureID, tagID int) string {
-	return strconv.Itoa(featureID) + "-" + strconv.Itoa(tagID)
+func (c *Cache) shard(key Key) *shard {
+	h := uint64(key.FeatureID)*0x9E3779B97F4A7C15 ^ uint64(key.TagID)*0xC2B2AE3D27D4EB4F
+	return c.shards[(h>>32)%uint64(len(c.shards))]
+}
+
+// expired reports whether the entry may no longer be served at all.
+func (c *Cache) expired(e *entry) bool {
+	if e.notFound {
+		return time.Since(e.updatedAt) > c.negativeTTL
+	}
+
+	return time.Since(e.updatedAt) > c.hardTTL
 }
 
-func GetBannerFromCache(featureID, tagID int) (*models.Banner, bool) {
-	cache.RLock()
-	defer cache.RUnlock()
+// lookup returns the entry if it has not expired and marks it as recently
+// used.
+func (c *Cache) lookup(key Key) (entry, bool) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
 
-	key := GenerateCacheKey(featureID, tagID)
-	cached, found := cache.Banners[key]
+	el, found := s.items[key]
 	if !found {
+		return entry{}, false
+	}
+
+	e := el.Value.(*entry)
+	if c.expired(e) {
+		return entry{}, false
+	}
+
+	s.lru.MoveToFront(el)
+	return *e, true
+}
+
+// Get returns the banners if they are younger than the soft TTL.
+func (c *Cache) Get(featureID, tagID int) ([]models.Banner, bool) {
+	e, found := c.lookup(Key{featureID, tagID})
+	if !found || e.notFound || time.Since(e.updatedAt) > c.ttl {
 		return nil, false
 	}
 
-	if time.Since(cached.UpdatedAt) > 5*time.Minute {
-		delete(cache.Banners, key)
+	return slices.Clone(e.banners), true
+}
+
+// GetStale returns the banners if they are younger than the hard TTL.
+func (c *Cache) GetStale(featureID, tagID int) ([]models.Banner, bool) {
+	e, found := c.lookup(Key{featureID, tagID})
+	if !found || e.notFound {
 		return nil, false
 	}
 
-	return &cached.Banner, true
+	return slices.Clone(e.banners), true
+}
+
+// FreshFor returns how long the entry for the feature and tag will be served
+// without a refresh, or zero if it is stale or missing.
+func (c *Cache) FreshFor(featureID, tagID int) time.Duration {
+	e, found := c.lookup(Key{featureID, tagID})
+	if !found || e.notFound {
+		return 0
+	}
+
+	return max(c.ttl-time.Since(e.updatedAt), 0)
+}
+
+func (c *Cache) Set(featureID, tagID int, banners []models.Banner) {
+	c.put(entry{key: Key{featureID, tagID}, banners: slices.Clone(banners), updatedAt: time.Now()})
+}
+
+// SetNotFound remembers that there are no banners for the feature and tag.
+func (c *Cache) SetNotFound(featureID, tagID int) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.put(entry{key: Key{featureID, tagID}, updatedAt: time.Now(), notFound: true})
 }
 
-func StorageBannerInCache(featureID, tagID int, banner models.Banner) {
-	cache.Lock()
-	defer cache.Unlock()
+func (c *Cache) put(e entry) {
+	s := c.shard(e.key)
+	s.Lock()
+	defer s.Unlock()
+
+	c.putLocked(s, e)
+}
+
+func (c *Cache) putLocked(s *shard, e entry) {
+	if el, found := s.items[e.key]; found {
+		*el.Value.(*entry) = e
+		s.lru.MoveToFront(el)
+		return
+	}
+
+	s.items[e.key] = s.lru.PushFront(&e)
+	for s.lru.Len() > s.max {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.items, oldest.Value.(*entry).key)
+		c.stats.evictions.Add(1)
+	}
+}
+
+// Delete removes the entry for the feature and tag, positive or negative,
+// and makes a fetch of the key that is in flight drop its result.
+func (c *Cache) Delete(featureID, tagID int) {
+	key := Key{featureID, tagID}
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+
+	if _, loading := s.gens[key]; loading {
+		s.gens[key]++
+	}
+	s.removeLocked(key)
+}
+
+func (s *shard) removeLocked(key Key) {
+	if el, found := s.items[key]; found {
+		s.lru.Remove(el)
+		delete(s.items, key)
+	}
+}
+
+func (c *Cache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.Lock()
+		n += len(s.items)
+		s.Unlock()
+	}
+
+	return n
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Entries:      c.Len(),
+		Hits:         c.stats.hits.Load(),
+		NegativeHits: c.stats.negativeHits.Load(),
+		Misses:       c.stats.misses.Load(),
+		Stale:        c.stats.stale.Load(),
+		Coalesced:    c.stats.coalesced.Load(),
+		Evictions:    c.stats.evictions.Load(),
+		Expired:      c.stats.expired.Load(),
+	}
+}
+
+// Load returns the cached banners for the feature and tag. A fresh entry is
+// returned as is, and a negative entry yields repository.ErrNotFound. An
+// entry past the soft TTL is returned immediately while a background refresh
+// runs. On a miss it calls load and stores the result; concurrent misses for
+// the same key wait for a single call to load and share its result.
+func (c *Cache) Load(featureID, tagID int, load func() ([]models.Banner, error)) ([]models.Banner, Status, error) {
+	key := Key{featureID, tagID}
+
+	if e, found := c.lookup(key); found {
+		if e.notFound {
+			c.stats.negativeHits.Add(1)
+			return nil, StatusHit, repository.ErrNotFound
+		}
+
+		if time.Since(e.updatedAt) <= c.ttl {
+			c.stats.hits.Add(1)
+			return slices.Clone(e.banners), StatusHit, nil
+		}
+
+		// DoChan does not wait, and joins a refresh that is already running.
+		c.stats.stale.Add(1)
+		c.loads.DoChan(key.String(), c.fetch(key, load, nil))
+		return slices.Clone(e.banners), StatusStale, nil
+	}
+
+	c.stats.misses.Add(1)
+	leader := false
+	v, err, _ := c.loads.Do(key.String(), c.fetch(key, load, &leader))
+	if !leader {
+		c.stats.coalesced.Add(1)
+	}
+	if err != nil {
+		return nil, StatusMiss, err
+	}
+
+	return slices.Clone(v.([]models.Banner)), StatusMiss, nil
+}
+
+// fetch loads the banners and updates the cache. A key without banners is
+// remembered as a negative entry; on any other error the old entry
+// is kept so it can be served until the hard TTL.
+func (c *Cache) fetch(key Key, load func() ([]models.Banner, error), leader *bool) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if leader != nil {
+			*leader = true
+
+			// A fetch that finished between the miss and this call already
+			// filled the cache.
+			if e, found := c.lookup(key); found {
+				if e.notFound {
+					return nil, repository.ErrNotFound
+				}
+				if time.Since(e.updatedAt) <= c.ttl {
+					return e.banners, nil
+				}
+			}
+		}
+
+		gen := c.beginFetch(key)
+		banners, err := load()
+		switch {
+		case err == nil:
+			c.endFetch(key, gen, &entry{key: key, banners: slices.Clone(banners), updatedAt: time.Now()})
+		case errors.Is(err, repository.ErrNotFound):
+			c.endFetch(key, gen, &entry{key: key, updatedAt: time.Now(), notFound: true})
+		default:
+			c.endFetch(key, gen, nil)
+		}
+
+		return banners, err
+	}
+}
+
+// beginFetch registers a fetch of the key and returns its generation.
+// Singleflight runs one fetch per key at a time.
+func (c *Cache) beginFetch(key Key) uint64 {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+
+	gen := s.gens[key]
+	s.gens[key] = gen
+	return gen
+}
+
+// endFetch stores the fetched entry, nil if the fetch failed, unless the key
+// was invalidated since beginFetch: the entry may then predate the change
+// and the next lookup loads it again.
+func (c *Cache) endFetch(key Key, gen uint64, e *entry) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+
+	current := s.gens[key]
+	delete(s.gens, key)
+	if e == nil || current != gen {
+		return
+	}
+	if e.notFound && c.negativeTTL <= 0 {
+		s.removeLocked(key)
+		return
+	}
+
+	c.putLocked(s, *e)
+}
+
+func (c *Cache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
 
-	key := GenerateCacheKey(featureID, tagID)
-	cache.Banners[key] = Cache{
-		Banner:    banner,
-		UpdatedAt: time.Now(),
+// removeExpired drops entries that may no longer be served. Entries are
+// ordered by use, not age, so every entry of a shard is checked.
+func (c *Cache) removeExpired() {
+	for _, s := range c.shards {
+		s.Lock()
+		for key, el := range s.items {
+			if c.expired(el.Value.(*entry)) {
+				s.lru.Remove(el)
+				delete(s.items, key)
+				c.stats.expired.Add(1)
+			}
+		}
+		s.Unlock()
 	}
 }
@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const concurrentRequests = 100
+
+func newTestCache() *Cache {
+	return New(Options{TTL: time.Minute, HardTTL: time.Hour, NegativeTTL: time.Second, MaxEntries: 1000, Shards: 4})
+}
+
+// slowLoader imitates a database query and counts how often it runs.
+func slowLoader(calls *atomic.Int64) func() ([]models.Banner, error) {
+	return func() ([]models.Banner, error) {
+		calls.Add(1)
+		time.Sleep(time.Millisecond)
+		return []models.Banner{{ID: 1, FeatureID: 1}}, nil
+	}
+}
+
+// missAll fires concurrentRequests simultaneous lookups for one key.
+func missAll(get func() ([]models.Banner, error)) {
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			get()
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+// setAged puts banners in the cache as if they had been fetched age ago.
+func setAged(c *Cache, featureID, tagID int, banners []models.Banner, age time.Duration) {
+	c.Set(featureID, tagID, banners)
+
+	key := Key{featureID, tagID}
+	s := c.shard(key)
+	s.Lock()
+	s.items[key].Value.(*entry).updatedAt = time.Now().Add(-age)
+	s.Unlock()
+}
+
+// firstID returns the ID of the first banner, or 0 if there is none.
+func firstID(banners []models.Banner) int {
+	if len(banners) == 0 {
+		return 0
+	}
+
+	return banners[0].ID
+}
+
+// eventually polls cond until it holds or a second passes.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadCoalescesConcurrentMisses(t *testing.T) {
+	c := newTestCache()
+	var calls atomic.Int64
+	load := slowLoader(&calls)
+
+	missAll(func() ([]models.Banner, error) {
+		banners, _, err := c.Load(1, 1, load)
+		if err != nil || firstID(banners) != 1 {
+			t.Errorf("Load() = %v, %v", banners, err)
+		}
+		return banners, err
+	})
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("load called %d times, want 1", got)
+	}
+	if _, found := c.Get(1, 1); !found {
+		t.Error("banner was not stored in cache")
+	}
+	if c.Stats().Coalesced == 0 {
+		t.Error("coalesced requests were not counted")
+	}
+}
+
+func TestLoadServesStaleAndRefreshes(t *testing.T) {
+	c := newTestCache()
+	setAged(c, 1, 1, []models.Banner{{ID: 1}}, c.ttl+time.Second)
+
+	banners, status, err := c.Load(1, 1, func() ([]models.Banner, error) {
+		return []models.Banner{{ID: 2}}, nil
+	})
+	if err != nil || status != StatusStale || firstID(banners) != 1 {
+		t.Fatalf("Load() = %v, %s, %v; want stale banner 1", banners, status, err)
+	}
+
+	eventually(t, func() bool {
+		banners, found := c.Get(1, 1)
+		return found && firstID(banners) == 2
+	}, "background refresh did not update the cache")
+}
+
+func TestLoadKeepsStaleOnFailure(t *testing.T) {
+	c := newTestCache()
+	setAged(c, 1, 1, []models.Banner{{ID: 1}}, c.ttl+time.Second)
+
+	failing := func() ([]models.Banner, error) { return nil, errors.New("connection refused") }
+	for i := 0; i < 3; i++ {
+		banners, status, err := c.Load(1, 1, failing)
+		if err != nil || status != StatusStale || firstID(banners) != 1 {
+			t.Fatalf("Load() = %v, %s, %v; want stale banner 1", banners, status, err)
+		}
+	}
+
+	setAged(c, 1, 1, []models.Banner{{ID: 1}}, c.hardTTL+time.Second)
+	if _, _, err := c.Load(1, 1, failing); err == nil {
+		t.Fatal("entry past the hard TTL was served")
+	}
+}
+
+func TestLoadCachesNotFound(t *testing.T) {
+	c := newTestCache()
+	var calls atomic.Int64
+	missing := func() ([]models.Banner, error) {
+		calls.Add(1)
+		return nil, repository.ErrNotFound
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Load(1, 1, missing); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Load() error = %v, want ErrNotFound", err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("load called %d times, want 1", got)
+	}
+	if got := c.Stats().NegativeHits; got != 2 {
+		t.Errorf("negative hits = %d, want 2", got)
+	}
+
+	c.Delete(1, 1)
+	banners, _, err := c.Load(1, 1, func() ([]models.Banner, error) { return []models.Banner{{ID: 1}}, nil })
+	if err != nil || firstID(banners) != 1 {
+		t.Fatalf("Load() after invalidation = %v, %v; want banner 1", banners, err)
+	}
+}
+
+func TestNegativeEntryExpires(t *testing.T) {
+	c := newTestCache()
+	c.SetNotFound(1, 1)
+
+	s := c.shard(Key{1, 1})
+	s.Lock()
+	s.items[Key{1, 1}].Value.(*entry).updatedAt = time.Now().Add(-2 * c.negativeTTL)
+	s.Unlock()
+
+	banners, status, err := c.Load(1, 1, func() ([]models.Banner, error) { return []models.Banner{{ID: 1}}, nil })
+	if err != nil || status != StatusMiss || firstID(banners) != 1 {
+		t.Fatalf("Load() = %v, %s, %v; want fresh banner 1", banners, status, err)
+	}
+}
+
+func TestLoadEvictsDeletedBanner(t *testing.T) {
+	c := newTestCache()
+	setAged(c, 1, 1, []models.Banner{{ID: 1}}, c.hardTTL-time.Second)
+
+	if _, _, err := c.Load(1, 1, func() ([]models.Banner, error) { return nil, repository.ErrNotFound }); err != nil {
+		t.Fatalf("stale lookup failed: %v", err)
+	}
+
+	eventually(t, func() bool {
+		_, found := c.GetStale(1, 1)
+		return !found
+	}, "deleted banner stayed in the cache")
+}
+
+func TestLoadDropsResultInvalidatedDuringFetch(t *testing.T) {
+	c := newTestCache()
+	started, release := make(chan struct{}), make(chan struct{})
+	go c.Load(1, 1, func() ([]models.Banner, error) {
+		close(started)
+		<-release
+		return nil, repository.ErrNotFound
+	})
+
+	// The banner is created after the fetch has read the table.
+	<-started
+	c.Delete(1, 1)
+	close(release)
+
+	eventually(t, func() bool {
+		s := c.shard(Key{1, 1})
+		s.Lock()
+		defer s.Unlock()
+		_, loading := s.gens[Key{1, 1}]
+		return !loading
+	}, "fetch did not finish")
+	banners, status, err := c.Load(1, 1, func() ([]models.Banner, error) { return []models.Banner{{ID: 1}}, nil })
+	if err != nil || status != StatusMiss || firstID(banners) != 1 {
+		t.Fatalf("Load() = %v, %s, %v; want banner 1 loaded again", banners, status, err)
+	}
+}
+
+func TestSetEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(Options{TTL: time.Minute, HardTTL: time.Hour, MaxEntries: 2, Shards: 1})
+
+	c.Set(1, 1, []models.Banner{{ID: 1}})
+	c.Set(1, 2, []models.Banner{{ID: 2}})
+	c.Get(1, 1)
+	c.Set(1, 3, []models.Banner{{ID: 3}})
+
+	if _, found := c.Get(1, 2); found {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, tagID := range []int{1, 3} {
+		if _, found := c.Get(1, tagID); !found {
+			t.Errorf("entry for tag %d was evicted", tagID)
+		}
+	}
+	if got := c.Stats().Evictions; got != 1 {
+		t.Errorf("evictions = %d, want 1", got)
+	}
+}
+
+func TestJanitorRemovesExpiredEntries(t *testing.T) {
+	c := New(Options{TTL: time.Minute, HardTTL: time.Hour, Shards: 2, CleanupInterval: time.Millisecond})
+	defer c.Close()
+
+	setAged(c, 1, 1, []models.Banner{{ID: 1}}, 2*time.Hour)
+	c.Set(1, 2, []models.Banner{{ID: 2}})
+
+	eventually(t, func() bool { return c.Len() == 1 }, "expired entry was not removed")
+	if _, found := c.Get(1, 2); !found {
+		t.Error("live entry was removed")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	c := New(Options{TTL: time.Millisecond, HardTTL: 2 * time.Millisecond, MaxEntries: 64, Shards: 4, CleanupInterval: time.Millisecond})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				featureID, tagID := rnd.Intn(10), rnd.Intn(10)
+				switch rnd.Intn(4) {
+				case 0:
+					c.Set(featureID, tagID, []models.Banner{{ID: i}})
+				case 1:
+					c.Delete(featureID, tagID)
+				case 2:
+					c.Get(featureID, tagID)
+				default:
+					c.Load(featureID, tagID, func() ([]models.Banner, error) {
+						return []models.Banner{{ID: i}}, nil
+					})
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	if n := c.Len(); n > 64 {
+		t.Errorf("Len() = %d, exceeds MaxEntries", n)
+	}
+}
+
+func BenchmarkConcurrentMisses(b *testing.B) {
+	b.Run("uncoalesced", func(b *testing.B) {
+		var calls atomic.Int64
+		load := slowLoader(&calls)
+		for i := 0; i < b.N; i++ {
+			c := newTestCache()
+			missAll(func() ([]models.Banner, error) {
+				if banners, found := c.Get(1, 1); found {
+					return banners, nil
+				}
+				banners, err := load()
+				if err == nil {
+					c.Set(1, 1, banners)
+				}
+				return banners, err
+			})
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "db-queries/op")
+	})
+
+	b.Run("coalesced", func(b *testing.B) {
+		var calls atomic.Int64
+		load := slowLoader(&calls)
+		for i := 0; i < b.N; i++ {
+			c := newTestCache()
+			missAll(func() ([]models.Banner, error) {
+				banners, _, err := c.Load(1, 1, load)
+				return banners, err
+			})
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "db-queries/op")
+	})
+}
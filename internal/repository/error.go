@@ -1,8 +1,47 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrNotFound = errors.New("not found")
-	ErrExists   = errors.New("already exists")
+	ErrNotFound     = errors.New("not found")
+	ErrExists       = errors.New("already exists")
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrVersionMismatch means the record was changed since the caller read
+	// the version it expects.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrInvalidReference means a record refers to one that does not exist,
+	// such as a banner to a missing tag.
+	ErrInvalidReference = errors.New("referenced record does not exist")
+	// ErrNoDraft means the banner has no unpublished changes.
+	ErrNoDraft = errors.New("no draft")
+	// ErrApprovalRequired means the change needs an approved change
+	// request.
+	ErrApprovalRequired = errors.New("approval required")
+	// ErrDecided means the change request is no longer pending.
+	ErrDecided = errors.New("change request already decided")
+	// ErrInUse means a record cannot be deleted while others refer to it.
+	ErrInUse = errors.New("in use")
 )
+
+// ConflictError means banner Index of a list cannot be created because live
+// banner BannerID has its feature, its targeting and one of its tags.
+// BannerID is 0 if that banner is one created earlier in the same list.
+// It wraps ErrExists.
+type ConflictError struct {
+	Index    int
+	BannerID int
+}
+
+func (e *ConflictError) Error() string {
+	if e.BannerID == 0 {
+		return "banner has the same feature, targeting and one of the tags as another new banner"
+	}
+	return fmt.Sprintf("banner %d has the same feature, targeting and one of the tags", e.BannerID)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrExists
+}
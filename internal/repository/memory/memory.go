@@ -0,0 +1,1026 @@
+// Package memory keeps banners, tags, features and users in process memory.
+// It implements the same interfaces as the Postgres repositories and is
+// meant for tests and local experiments.
+package memory
+
+import (
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/server/handlers/banners"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type Store struct {
+	mu       sync.RWMutex
+	banners  map[int]models.Banner
+	drafts   map[int]models.Banner
+	trash    map[int]models.Banner
+	tags     map[int]models.Tag
+	features map[int]models.Feature
+	users    map[int]models.User
+	changes  map[int]models.ChangeRequest
+	lastID   map[string]int
+
+	approvalChanges []models.FeatureApprovalChange
+	idempotencyKeys map[idempotencyScope]models.IdempotencyKey
+}
+
+type idempotencyScope struct {
+	owner, key, method, path string
+}
+
+func New() *Store {
+	return &Store{
+		banners:  make(map[int]models.Banner),
+		drafts:   make(map[int]models.Banner),
+		trash:    make(map[int]models.Banner),
+		tags:     make(map[int]models.Tag),
+		features: make(map[int]models.Feature),
+		users:    make(map[int]models.User),
+		changes:  make(map[int]models.ChangeRequest),
+		lastID:   make(map[string]int),
+
+		idempotencyKeys: make(map[idempotencyScope]models.IdempotencyKey),
+	}
+}
+
+func (s *Store) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// copyBanner returns a banner that shares no maps or slices with b, as if it
+// had been read from a database.
+func copyBanner(b models.Banner) models.Banner {
+	b.TagIDs = slices.Clone(b.TagIDs)
+	b.Platforms = slices.Clone(b.Platforms)
+	if b.Template != nil {
+		template := *b.Template
+		template.Variables = slices.Clone(template.Variables)
+		b.Template = &template
+	}
+	if b.Content != nil {
+		data, _ := json.Marshal(b.Content)
+		b.Content = nil
+		json.Unmarshal(data, &b.Content)
+	}
+	if b.Locales != nil {
+		data, _ := json.Marshal(b.Locales)
+		b.Locales = nil
+		json.Unmarshal(data, &b.Locales)
+	}
+
+	return b
+}
+
+func (s *Store) CreateFeature(ctx context.Context, feature *models.Feature) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feature.ID = s.nextID("features")
+	s.features[feature.ID] = *feature
+
+	return nil
+}
+
+func (s *Store) CreateTag(ctx context.Context, tag *models.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag.ID = s.nextID("tags")
+	s.tags[tag.ID] = *tag
+
+	return nil
+}
+
+func (s *Store) FindTags(ctx context.Context) ([]models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]models.Tag, 0, len(s.tags))
+	for _, tag := range s.tags {
+		result = append(result, tag)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+func (s *Store) FindTagId(ctx context.Context, id int) (models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tag, found := s.tags[id]
+	if !found {
+		return models.Tag{}, repository.ErrNotFound
+	}
+
+	return tag, nil
+}
+
+func (s *Store) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.tags[tag.ID]; !found {
+		return repository.ErrNotFound
+	}
+	s.tags[tag.ID] = *tag
+
+	return nil
+}
+
+func (s *Store) DeleteTag(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.tags[id]; !found {
+		return repository.ErrNotFound
+	}
+	for _, banner := range s.allBannersAndDrafts() {
+		if slices.Contains(banner.TagIDs, id) {
+			return repository.ErrInUse
+		}
+	}
+	delete(s.tags, id)
+
+	return nil
+}
+
+func (s *Store) FindFeatures(ctx context.Context) ([]models.Feature, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]models.Feature, 0, len(s.features))
+	for _, feature := range s.features {
+		result = append(result, feature)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+func (s *Store) FindFeatureId(ctx context.Context, id int) (models.Feature, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	feature, found := s.features[id]
+	if !found {
+		return models.Feature{}, repository.ErrNotFound
+	}
+
+	return feature, nil
+}
+
+func (s *Store) UpdateFeature(ctx context.Context, feature *models.Feature, changedBy, comment string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, found := s.features[feature.ID]
+	if !found {
+		return repository.ErrNotFound
+	}
+	s.features[feature.ID] = *feature
+
+	if old.RequiresApproval != feature.RequiresApproval {
+		s.approvalChanges = append(s.approvalChanges, models.FeatureApprovalChange{
+			ID:               s.nextID("feature_approval_changes"),
+			FeatureID:        feature.ID,
+			RequiresApproval: feature.RequiresApproval,
+			ChangedBy:        changedBy,
+			Comment:          comment,
+			ChangedAt:        time.Now(),
+		})
+	}
+
+	return nil
+}
+
+func (s *Store) FindFeatureApprovalChanges(ctx context.Context, id int) ([]models.FeatureApprovalChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.FeatureApprovalChange
+	for i := len(s.approvalChanges) - 1; i >= 0; i-- {
+		if s.approvalChanges[i].FeatureID == id {
+			result = append(result, s.approvalChanges[i])
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Store) DeleteFeature(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.features[id]; !found {
+		return repository.ErrNotFound
+	}
+	for _, banner := range s.allBannersAndDrafts() {
+		if banner.FeatureID == id {
+			return repository.ErrInUse
+		}
+	}
+	delete(s.features, id)
+
+	return nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return repository.ErrExists
+		}
+	}
+	user.ID = s.nextID("users")
+	s.users[user.ID] = *user
+
+	return nil
+}
+
+func (s *Store) FindUserUsername(ctx context.Context, username string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return models.User{}, fmt.Errorf("User not found")
+}
+
+func (s *Store) CreateBanner(ctx context.Context, banner *models.Banner) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conflictID := s.conflict(*banner); conflictID != 0 {
+		return conflictID, repository.ErrExists
+	}
+	for _, tagID := range banner.TagIDs {
+		if _, found := s.tags[tagID]; !found {
+			return 0, fmt.Errorf("tag %d: %w", tagID, repository.ErrInvalidReference)
+		}
+	}
+
+	banner.ID = s.nextID("banners")
+	banner.Version = 1
+	s.banners[banner.ID] = copyBanner(*banner)
+
+	return 0, nil
+}
+
+// conflict returns the ID of a live banner other than banner that has its
+// feature, its targeting and one of its tags, or 0.
+func (s *Store) conflict(banner models.Banner) int {
+	for _, existing := range s.sortedBanners() {
+		if existing.ID != banner.ID && conflicts(existing, banner) {
+			return existing.ID
+		}
+	}
+
+	return 0
+}
+
+// conflicts reports whether the banners have the same feature and
+// targeting and share a tag.
+func conflicts(a, b models.Banner) bool {
+	if a.FeatureID != b.FeatureID || !slices.Equal(a.Platforms, b.Platforms) || a.AppVersion != b.AppVersion || a.Rule != b.Rule {
+		return false
+	}
+	for _, tagID := range b.TagIDs {
+		if slices.Contains(a.TagIDs, tagID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Store) CreateBannerTag(ctx context.Context, bannerTag *models.BannerTag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banner, found := s.banners[bannerTag.BannerID]
+	if !found {
+		return repository.ErrNotFound
+	}
+	if slices.Contains(banner.TagIDs, bannerTag.TagID) {
+		return repository.ErrExists
+	}
+
+	banner.TagIDs = append(banner.TagIDs, bannerTag.TagID)
+	s.banners[banner.ID] = banner
+
+	return nil
+}
+
+func (s *Store) FindBannerId(ctx context.Context, id int) (models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	banner, found := s.banners[id]
+	if !found {
+		return models.Banner{}, repository.ErrNotFound
+	}
+
+	return s.withDraftFlag(banner), nil
+}
+
+func (s *Store) FindBannerDraft(ctx context.Context, id int) (models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	banner, found := s.banners[id]
+	if !found {
+		return models.Banner{}, repository.ErrNotFound
+	}
+	draft, found := s.drafts[id]
+	if !found {
+		return models.Banner{}, repository.ErrNoDraft
+	}
+
+	draft.Version = banner.Version
+	draft.CreatedAt = banner.CreatedAt
+	draft.HasDraft = true
+
+	return copyBanner(draft), nil
+}
+
+func (s *Store) SaveBannerDraft(ctx context.Context, draft *models.Banner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banner, err := s.checkVersion(draft.ID, draft.Version)
+	if err != nil {
+		return err
+	}
+
+	banner.Version++
+	s.banners[banner.ID] = banner
+	draft.Version = banner.Version
+	draft.HasDraft = true
+	s.drafts[draft.ID] = copyBanner(*draft)
+
+	return nil
+}
+
+func (s *Store) PublishBannerDraft(ctx context.Context, id int, version int64) (models.Banner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banner, err := s.checkVersion(id, version)
+	if err != nil {
+		return models.Banner{}, err
+	}
+	draft, found := s.drafts[id]
+	if !found {
+		return models.Banner{}, repository.ErrNoDraft
+	}
+	if s.features[banner.FeatureID].RequiresApproval || s.features[draft.FeatureID].RequiresApproval {
+		return models.Banner{}, repository.ErrApprovalRequired
+	}
+
+	return s.publish(banner, draft)
+}
+
+// publish replaces the banner with the draft and deletes the draft, unless
+// another live banner conflicts with the draft. The caller holds the lock.
+func (s *Store) publish(banner, draft models.Banner) (models.Banner, error) {
+	for _, tagID := range draft.TagIDs {
+		if _, found := s.tags[tagID]; !found {
+			return models.Banner{}, fmt.Errorf("tag %d: %w", tagID, repository.ErrInvalidReference)
+		}
+	}
+	draft.ID = banner.ID
+	if conflictID := s.conflict(draft); conflictID != 0 {
+		return models.Banner{}, fmt.Errorf("banner %d: %w", conflictID, repository.ErrExists)
+	}
+
+	banner.TagIDs = draft.TagIDs
+	banner.FeatureID = draft.FeatureID
+	banner.Content = draft.Content
+	banner.DefaultLocale = draft.DefaultLocale
+	banner.Locales = draft.Locales
+	banner.Platforms = draft.Platforms
+	banner.AppVersion = draft.AppVersion
+	banner.Rule = draft.Rule
+	banner.Template = draft.Template
+	banner.IsActive = draft.IsActive
+	banner.UpdatedAt = time.Now()
+	banner.Version++
+	s.banners[banner.ID] = banner
+	delete(s.drafts, banner.ID)
+
+	return copyBanner(banner), nil
+}
+
+func (s *Store) DiscardBannerDraft(ctx context.Context, id int, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banner, err := s.checkVersion(id, version)
+	if err != nil {
+		return err
+	}
+	if _, found := s.drafts[id]; !found {
+		return repository.ErrNoDraft
+	}
+
+	banner.Version++
+	s.banners[id] = banner
+	delete(s.drafts, id)
+
+	return nil
+}
+
+// checkVersion returns the banner if it is at version. The caller holds the
+// lock.
+func (s *Store) checkVersion(id int, version int64) (models.Banner, error) {
+	banner, found := s.banners[id]
+	if !found {
+		return models.Banner{}, repository.ErrNotFound
+	}
+	if banner.Version != version {
+		return models.Banner{}, repository.ErrVersionMismatch
+	}
+
+	return banner, nil
+}
+
+// withDraftFlag returns a copy of the banner with HasDraft set. The caller
+// holds the lock.
+func (s *Store) withDraftFlag(banner models.Banner) models.Banner {
+	banner = copyBanner(banner)
+	_, banner.HasDraft = s.drafts[banner.ID]
+
+	return banner
+}
+
+// allBannersAndDrafts returns the published and trashed banners and the
+// drafts, for checks of what refers to a tag or feature. The caller holds the
+// lock.
+func (s *Store) allBannersAndDrafts() []models.Banner {
+	result := make([]models.Banner, 0, len(s.banners)+len(s.trash)+len(s.drafts))
+	for _, banner := range s.banners {
+		result = append(result, banner)
+	}
+	for _, banner := range s.trash {
+		result = append(result, banner)
+	}
+	for _, draft := range s.drafts {
+		result = append(result, draft)
+	}
+
+	return result
+}
+
+func (s *Store) FindBannersFeatureTag(ctx context.Context, featureID, tagID int) ([]models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.Banner
+	for _, banner := range s.sortedBanners() {
+		if banner.FeatureID == featureID && slices.Contains(banner.TagIDs, tagID) {
+			result = append(result, copyBanner(banner))
+		}
+	}
+	if len(result) == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	return result, nil
+}
+
+func (s *Store) FindBannersParameters(ctx context.Context, params banners.RequestGetBanners) ([]models.Banner, error) {
+	if params.Path != "" {
+		return nil, errPathSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := s.filterBanners(params)
+	sort.Slice(result, func(i, j int) bool { return bannerBefore(result[i], result[j], params.Sort, params.Order) })
+
+	if c := params.After; c != nil {
+		after := models.Banner{ID: c.ID, CreatedAt: c.Time, UpdatedAt: c.Time}
+		i := sort.Search(len(result), func(i int) bool { return bannerBefore(after, result[i], params.Sort, params.Order) })
+		result = result[i:]
+	}
+	if params.Limit > 0 && len(result) > params.Limit {
+		result = result[:params.Limit]
+	}
+
+	for i := range result {
+		result[i] = s.withDraftFlag(result[i])
+	}
+
+	return result, nil
+}
+
+func (s *Store) CountBanners(ctx context.Context, params banners.RequestGetBanners) (int, error) {
+	if params.Path != "" {
+		return 0, errPathSearch
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.filterBanners(params)), nil
+}
+
+// filterBanners returns the banners matching params, ignoring the page. The
+// caller holds the lock.
+func (s *Store) filterBanners(params banners.RequestGetBanners) []models.Banner {
+	var result []models.Banner
+	for _, banner := range s.banners {
+		if len(params.FeatureIDs) > 0 && !slices.Contains(params.FeatureIDs, banner.FeatureID) {
+			continue
+		}
+		if len(params.TagIDs) > 0 && !slices.ContainsFunc(banner.TagIDs, func(id int) bool { return slices.Contains(params.TagIDs, id) }) {
+			continue
+		}
+		if params.IsActive != nil && banner.IsActive != *params.IsActive {
+			continue
+		}
+		if !inRange(banner.CreatedAt, params.CreatedAfter, params.CreatedBefore) || !inRange(banner.UpdatedAt, params.UpdatedAfter, params.UpdatedBefore) {
+			continue
+		}
+		if params.Text != "" && !containsWords(banner.Content, words(params.Text)) {
+			continue
+		}
+		result = append(result, banner)
+	}
+
+	return result
+}
+
+var errPathSearch = fmt.Errorf("%w: JSONPath search is not supported by the in-memory store", repository.ErrInvalidQuery)
+
+// containsWords is a rough stand-in for Postgres full-text search: every word
+// must occur in some string value of the content.
+func containsWords(content any, want []string) bool {
+	found := make(map[string]bool)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			for _, w := range words(v) {
+				found[w] = true
+			}
+		case map[string]any:
+			for _, item := range v {
+				walk(item)
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(content)
+
+	for _, w := range want {
+		if !found[w] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func inRange(t time.Time, from, to *time.Time) bool {
+	return (from == nil || !t.Before(*from)) && (to == nil || t.Before(*to))
+}
+
+// bannerBefore orders banners like the Postgres repository: by the sort
+// column, then by ID.
+func bannerBefore(a, b models.Banner, sortBy, order string) bool {
+	if order == banners.OrderDesc {
+		a, b = b, a
+	}
+
+	var ta, tb time.Time
+	switch sortBy {
+	case banners.SortCreatedAt:
+		ta, tb = a.CreatedAt, b.CreatedAt
+	case banners.SortUpdatedAt:
+		ta, tb = a.UpdatedAt, b.UpdatedAt
+	}
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+
+	return a.ID < b.ID
+}
+
+func (s *Store) DeleteBannerID(ctx context.Context, id int, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, found := s.banners[id]
+	if !found {
+		return repository.ErrNotFound
+	}
+	if stored.Version != version {
+		return repository.ErrVersionMismatch
+	}
+	now := time.Now()
+	stored.DeletedAt = &now
+	stored.Version++
+	s.trash[id] = stored
+	delete(s.banners, id)
+	for _, change := range s.changes {
+		if change.BannerID == id && change.Status == models.ChangeRequestPending {
+			s.decide(change, models.ChangeRequestCanceled, "", "")
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) FindTrashedBanners(ctx context.Context, limit int) ([]models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]models.Banner, 0, len(s.trash))
+	for _, banner := range s.trash {
+		result = append(result, s.withDraftFlag(banner))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].DeletedAt.Equal(*result[j].DeletedAt) {
+			return result[i].DeletedAt.After(*result[j].DeletedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (s *Store) FindTrashedBanner(ctx context.Context, id int) (models.Banner, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	banner, found := s.trash[id]
+	if !found {
+		return models.Banner{}, repository.ErrNotFound
+	}
+
+	return s.withDraftFlag(banner), nil
+}
+
+func (s *Store) RestoreBanner(ctx context.Context, id int, version int64) (models.Banner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banner, found := s.trash[id]
+	if !found {
+		return models.Banner{}, repository.ErrNotFound
+	}
+	if banner.Version != version {
+		return models.Banner{}, repository.ErrVersionMismatch
+	}
+	if conflictID := s.conflict(banner); conflictID != 0 {
+		return models.Banner{}, fmt.Errorf("banner %d: %w", conflictID, repository.ErrExists)
+	}
+	banner.DeletedAt = nil
+	banner.Version++
+	s.banners[id] = banner
+	delete(s.trash, id)
+
+	return s.withDraftFlag(banner), nil
+}
+
+// PurgeBanners deletes banners moved to the trash before the given time.
+func (s *Store) PurgeBanners(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, banner := range s.trash {
+		if banner.DeletedAt.Before(before) {
+			delete(s.trash, id)
+			delete(s.drafts, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *Store) CreateChangeRequest(ctx context.Context, change *models.ChangeRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createChangeRequest(change)
+}
+
+// createChangeRequest is CreateChangeRequest for a caller that holds the
+// lock.
+func (s *Store) createChangeRequest(change *models.ChangeRequest) error {
+	if _, err := s.checkVersion(change.BannerID, change.BaseVersion); err != nil {
+		return err
+	}
+	draft, found := s.drafts[change.BannerID]
+	if !found {
+		return repository.ErrNoDraft
+	}
+	if s.hasPendingChangeRequest(change.BannerID) {
+		return repository.ErrExists
+	}
+
+	draft = copyBanner(draft)
+	change.ID = s.nextID("change_requests")
+	change.TagIDs = draft.TagIDs
+	change.FeatureID = draft.FeatureID
+	change.Content = draft.Content
+	change.DefaultLocale = draft.DefaultLocale
+	change.Locales = draft.Locales
+	change.Platforms = draft.Platforms
+	change.AppVersion = draft.AppVersion
+	change.Rule = draft.Rule
+	change.Template = draft.Template
+	change.IsActive = draft.IsActive
+	change.Status = models.ChangeRequestPending
+	change.CreatedAt = time.Now()
+	change.ReviewedAt = nil
+	s.changes[change.ID] = copyChangeRequest(*change)
+
+	return nil
+}
+
+func (s *Store) FindChangeRequests(ctx context.Context, filter banners.ChangeRequestFilter) ([]models.ChangeRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.ChangeRequest
+	for _, change := range s.changes {
+		if filter.Status != "" && change.Status != filter.Status {
+			continue
+		}
+		if filter.BannerID != 0 && change.BannerID != filter.BannerID {
+			continue
+		}
+		result = append(result, copyChangeRequest(change))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+
+	return result, nil
+}
+
+func (s *Store) FindChangeRequest(ctx context.Context, id int) (models.ChangeRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	change, found := s.changes[id]
+	if !found {
+		return models.ChangeRequest{}, repository.ErrNotFound
+	}
+
+	return copyChangeRequest(change), nil
+}
+
+func (s *Store) ApproveChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, models.Banner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change, err := s.pendingChangeRequest(id)
+	if err != nil {
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+	banner, err := s.checkVersion(change.BannerID, change.BaseVersion)
+	if err != nil {
+		return models.ChangeRequest{}, models.Banner{}, fmt.Errorf("banner %d: %w", change.BannerID, repository.ErrVersionMismatch)
+	}
+
+	published, err := s.publish(banner, copyBanner(models.Banner{
+		ID:            change.BannerID,
+		TagIDs:        change.TagIDs,
+		FeatureID:     change.FeatureID,
+		Content:       change.Content,
+		DefaultLocale: change.DefaultLocale,
+		Locales:       change.Locales,
+		Platforms:     change.Platforms,
+		AppVersion:    change.AppVersion,
+		Rule:          change.Rule,
+		Template:      change.Template,
+		IsActive:      change.IsActive,
+	}))
+	if err != nil {
+		return models.ChangeRequest{}, models.Banner{}, err
+	}
+
+	return s.decide(change, models.ChangeRequestApproved, reviewer, comment), published, nil
+}
+
+func (s *Store) RejectChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change, err := s.pendingChangeRequest(id)
+	if err != nil {
+		return models.ChangeRequest{}, err
+	}
+
+	return s.decide(change, models.ChangeRequestRejected, reviewer, comment), nil
+}
+
+// pendingChangeRequest returns the change request if it is pending. The
+// caller holds the lock.
+func (s *Store) pendingChangeRequest(id int) (models.ChangeRequest, error) {
+	change, found := s.changes[id]
+	if !found {
+		return models.ChangeRequest{}, repository.ErrNotFound
+	}
+	if change.Status != models.ChangeRequestPending {
+		return models.ChangeRequest{}, repository.ErrDecided
+	}
+
+	return change, nil
+}
+
+// decide records the decision on the change request and returns a copy of
+// it. The caller holds the lock.
+func (s *Store) decide(change models.ChangeRequest, status, reviewer, comment string) models.ChangeRequest {
+	now := time.Now()
+	change.Status = status
+	change.Reviewer = reviewer
+	change.ReviewComment = comment
+	change.ReviewedAt = &now
+	s.changes[change.ID] = change
+
+	return copyChangeRequest(change)
+}
+
+func copyChangeRequest(c models.ChangeRequest) models.ChangeRequest {
+	banner := copyBanner(models.Banner{TagIDs: c.TagIDs, Content: c.Content, Locales: c.Locales, Platforms: c.Platforms, Template: c.Template})
+	c.TagIDs, c.Content, c.Locales, c.Platforms, c.Template = banner.TagIDs, banner.Content, banner.Locales, banner.Platforms, banner.Template
+
+	return c
+}
+
+func (s *Store) SaveBanners(ctx context.Context, banners []*models.Banner, author, comment string) ([]models.ChangeRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// All or nothing, as in a transaction.
+	for i, banner := range banners {
+		if banner.ID == 0 {
+			if conflictID := s.conflict(*banner); conflictID != 0 {
+				return nil, &repository.ConflictError{Index: i, BannerID: conflictID}
+			}
+			for _, earlier := range banners[:i] {
+				if earlier.ID == 0 && conflicts(*earlier, *banner) {
+					return nil, &repository.ConflictError{Index: i}
+				}
+			}
+			continue
+		}
+		if _, err := s.checkVersion(banner.ID, banner.Version); err != nil {
+			return nil, fmt.Errorf("banner %d: %w", banner.ID, err)
+		}
+		if s.needsApproval(*banner) && s.hasPendingChangeRequest(banner.ID) {
+			return nil, fmt.Errorf("banner %d has a pending change request: %w", banner.ID, repository.ErrExists)
+		}
+	}
+
+	var changes []models.ChangeRequest
+	for _, banner := range banners {
+		if banner.ID != 0 {
+			published := s.banners[banner.ID]
+			published.Version++
+			s.banners[banner.ID] = published
+			banner.Version = published.Version
+			banner.HasDraft = true
+			s.drafts[banner.ID] = copyBanner(*banner)
+
+			if s.needsApproval(*banner) {
+				change := models.ChangeRequest{BannerID: banner.ID, BaseVersion: banner.Version, Author: author, Comment: comment}
+				if err := s.createChangeRequest(&change); err != nil {
+					return nil, err
+				}
+				changes = append(changes, change)
+			}
+			continue
+		}
+
+		banner.ID = s.nextID("banners")
+		banner.Version = 1
+		s.banners[banner.ID] = copyBanner(*banner)
+	}
+
+	return changes, nil
+}
+
+// needsApproval reports whether the current feature of the banner or the
+// feature of draft requires approval. The caller holds the lock.
+func (s *Store) needsApproval(draft models.Banner) bool {
+	return s.features[s.banners[draft.ID].FeatureID].RequiresApproval || s.features[draft.FeatureID].RequiresApproval
+}
+
+// hasPendingChangeRequest reports whether the banner has a pending change
+// request. The caller holds the lock.
+func (s *Store) hasPendingChangeRequest(bannerID int) bool {
+	for _, c := range s.changes {
+		if c.BannerID == bannerID && c.Status == models.ChangeRequestPending {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Store) ExportBanners(ctx context.Context, fn func(banners.ExportedBanner) error) error {
+	s.mu.RLock()
+	exported := make([]banners.ExportedBanner, 0, len(s.banners))
+	for _, banner := range s.sortedBanners() {
+		e := banners.ExportedBanner{Banner: s.withDraftFlag(banner), TagNames: []string{}}
+		if feature, found := s.features[banner.FeatureID]; found {
+			e.FeatureName = &feature.Name
+		}
+		for _, tagID := range banner.TagIDs {
+			e.TagNames = append(e.TagNames, s.tags[tagID].Name)
+		}
+		exported = append(exported, e)
+	}
+	s.mu.RUnlock()
+
+	for _, banner := range exported {
+		if err := fn(banner); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortedBanners returns banners ordered by ID. The caller holds the lock.
+func (s *Store) sortedBanners() []models.Banner {
+	result := make([]models.Banner, 0, len(s.banners))
+	for _, banner := range s.banners {
+		result = append(result, banner)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result
+}
+
+func (s *Store) ReserveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey, expiredBefore, abandonedBefore time.Time) (*models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scope := idempotencyScope{key.Owner, key.Key, key.Method, key.Path}
+	existing, found := s.idempotencyKeys[scope]
+	if found && !existing.CreatedAt.Before(expiredBefore) &&
+		(existing.Status != 0 || !existing.CreatedAt.Before(abandonedBefore)) {
+		return &existing, nil
+	}
+
+	s.idempotencyKeys[scope] = *key
+
+	return nil, nil
+}
+
+func (s *Store) SaveIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idempotencyKeys[idempotencyScope{key.Owner, key.Key, key.Method, key.Path}] = *key
+
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotencyKeys, idempotencyScope{key.Owner, key.Key, key.Method, key.Path})
+
+	return nil
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"sync"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,25 +15,20 @@ type Postgres struct {
 	log *slog.Logger
 }
 
-var pgInit *Postgres
-
 func NewPostgres(ctx context.Context, cont string, log *slog.Logger) (*Postgres, error) {
-	var pgOnce sync.Once
-
-	pgOnce.Do(func() {
-		db, err := pgxpool.New(ctx, cont)
-		if err != nil {
-			fmt.Errorf("Cannot to create connection pool", logerr.Err(err))
-			return
-		}
-
-		pgInit = &Postgres{db, log}
-		if err := CreateTable(ctx, db, log); err != nil {
-			return
-		}
-	})
-
-	return pgInit, nil
+	db, err := pgxpool.New(ctx, cont)
+	if err != nil {
+		log.Error("Cannot to create connection pool", logerr.Err(err))
+		return nil, fmt.Errorf("cannot create connection pool: %w", err)
+	}
+
+	if err := CreateTable(ctx, db, log); err != nil {
+		log.Error("Cannot to create tables", logerr.Err(err))
+		db.Close()
+		return nil, err
+	}
+
+	return &Postgres{db, log}, nil
 }
 
 func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error {
@@ -48,7 +43,22 @@ func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("Failed to create banners table", logerr.Err(err))
+		return fmt.Errorf("Failed to create banners table: %w", err)
+	}
+
+	// version is bumped on every update for optimistic concurrency control.
+	_, err = db.Exec(ctx, `ALTER TABLE banners ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banners version column: %w", err)
+	}
+
+	// Deleted banners stay in the trash until they are restored or purged.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE banners ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS banners_deleted_at_idx ON banners (deleted_at) WHERE deleted_at IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banners deleted_at column: %w", err)
 	}
 
 	_, err = db.Exec(ctx, `
@@ -58,7 +68,7 @@ func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("Failed to create tags table", logerr.Err(err))
+		return fmt.Errorf("Failed to create tags table: %w", err)
 	}
 
 	_, err = db.Exec(ctx, `
@@ -71,7 +81,23 @@ func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("Failed to create banner_tags table", logerr.Err(err))
+		return fmt.Errorf("Failed to create banner_tags table: %w", err)
+	}
+
+	// Unpublished changes of banners, at most one per banner. Tags are kept
+	// as an array, since they are linked to the banner only on publish.
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS banner_drafts (
+			banner_id INTEGER PRIMARY KEY REFERENCES banners(id) ON DELETE CASCADE,
+			feature_id INTEGER,
+			tag_ids INTEGER[] NOT NULL DEFAULT '{}',
+			content JSONB,
+			is_active BOOLEAN,
+			updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create banner_drafts table: %w", err)
 	}
 
 	_, err = db.Exec(ctx, `
@@ -81,7 +107,104 @@ func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("Failed to create features table", logerr.Err(err))
+		return fmt.Errorf("Failed to create features table: %w", err)
+	}
+
+	_, err = db.Exec(ctx, `ALTER TABLE features ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT false`)
+	if err != nil {
+		return fmt.Errorf("Failed to add features requires_approval column: %w", err)
+	}
+
+	// Who turned requires_approval on or off. feature_id has no foreign key,
+	// so the record is kept after the feature is deleted.
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS feature_approval_changes (
+			id SERIAL PRIMARY KEY,
+			feature_id INTEGER NOT NULL,
+			requires_approval BOOLEAN NOT NULL,
+			changed_by TEXT NOT NULL,
+			comment TEXT NOT NULL DEFAULT '',
+			changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS feature_approval_changes_feature_id_idx ON feature_approval_changes (feature_id, id)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create feature_approval_changes table: %w", err)
+	}
+
+	// Banner drafts submitted for approval. banner_id has no foreign key, so
+	// decisions are kept after the banner is deleted; at most one request
+	// per banner is pending.
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS change_requests (
+			id SERIAL PRIMARY KEY,
+			banner_id INTEGER NOT NULL,
+			base_version BIGINT NOT NULL,
+			feature_id INTEGER,
+			tag_ids INTEGER[] NOT NULL DEFAULT '{}',
+			content JSONB,
+			is_active BOOLEAN,
+			status TEXT NOT NULL DEFAULT 'pending',
+			author TEXT NOT NULL,
+			comment TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			reviewer TEXT,
+			review_comment TEXT,
+			reviewed_at TIMESTAMPTZ
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS change_requests_pending_idx ON change_requests (banner_id) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS change_requests_status_id_idx ON change_requests (status, id)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create change_requests table: %w", err)
+	}
+
+	// Content variants by language tag; content is the one for
+	// default_locale and for users no variant matches.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE banners ADD COLUMN IF NOT EXISTS default_locale TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS locales JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE banner_drafts ADD COLUMN IF NOT EXISTS default_locale TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS locales JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS default_locale TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS locales JSONB NOT NULL DEFAULT '{}'
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banner locale columns: %w", err)
+	}
+
+	// Targeting: the platforms and the semver range of app versions the
+	// banner is shown to; empty means all.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE banners ADD COLUMN IF NOT EXISTS platforms TEXT[] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS app_version TEXT NOT NULL DEFAULT '';
+		ALTER TABLE banner_drafts ADD COLUMN IF NOT EXISTS platforms TEXT[] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS app_version TEXT NOT NULL DEFAULT '';
+		ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS platforms TEXT[] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS app_version TEXT NOT NULL DEFAULT ''
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banner targeting columns: %w", err)
+	}
+
+	// A targeting rule over user attributes; empty matches everyone.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE banners ADD COLUMN IF NOT EXISTS rule TEXT NOT NULL DEFAULT '';
+		ALTER TABLE banner_drafts ADD COLUMN IF NOT EXISTS rule TEXT NOT NULL DEFAULT '';
+		ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS rule TEXT NOT NULL DEFAULT ''
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banner rule column: %w", err)
+	}
+
+	// Placeholder settings of the content; NULL serves it as is.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE banners ADD COLUMN IF NOT EXISTS template JSONB;
+		ALTER TABLE banner_drafts ADD COLUMN IF NOT EXISTS template JSONB;
+		ALTER TABLE change_requests ADD COLUMN IF NOT EXISTS template JSONB
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add banner template column: %w", err)
 	}
 
 	_, err = db.Exec(ctx, `
@@ -93,7 +216,92 @@ func CreateTable(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error
 		)
 	`)
 	if err != nil {
-		return fmt.Errorf("Failed to create users table", logerr.Err(err))
+		return fmt.Errorf("Failed to create users table: %w", err)
+	}
+
+	if err := createUsernameIndex(ctx, db, log); err != nil {
+		return err
+	}
+
+	// Responses of create requests sent with an Idempotency-Key. status is 0
+	// while the request is in progress.
+	_, err = db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			owner TEXT NOT NULL DEFAULT '',
+			key TEXT,
+			method TEXT,
+			path TEXT,
+			fingerprint TEXT NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			header JSONB,
+			body BYTEA,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create idempotency_keys table: %w", err)
+	}
+
+	// Keys are scoped to the caller (owner), so a client can neither replay
+	// nor block another one's requests. Tables from before the owner column
+	// are keyed by (key, method, path) alone.
+	_, err = db.Exec(ctx, `
+		ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '',
+			DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+		CREATE UNIQUE INDEX IF NOT EXISTS idempotency_keys_owner_idx ON idempotency_keys (owner, key, method, path)
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to add idempotency_keys owner column: %w", err)
+	}
+
+	// Indexes for keyset pagination, filters and content search of GET /banner.
+	_, err = db.Exec(ctx, `
+		CREATE INDEX IF NOT EXISTS banners_created_at_id_idx ON banners (created_at, id);
+		CREATE INDEX IF NOT EXISTS banners_updated_at_id_idx ON banners (updated_at, id);
+		CREATE INDEX IF NOT EXISTS banners_feature_id_idx ON banners (feature_id);
+		CREATE INDEX IF NOT EXISTS banner_tags_tag_id_idx ON banner_tags (tag_id);
+		CREATE INDEX IF NOT EXISTS banners_content_path_idx ON banners USING GIN (content jsonb_path_ops);
+		CREATE INDEX IF NOT EXISTS banners_content_text_idx ON banners USING GIN (jsonb_to_tsvector('simple', content, '["string"]'))
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to create banner indexes: %w", err)
+	}
+
+	return nil
+}
+
+// createUsernameIndex makes usernames unique. Databases created before the
+// index may already have duplicates, and the index cannot be built over
+// them: such usernames are logged and the service starts without the index
+// until they are renamed or deleted.
+func createUsernameIndex(ctx context.Context, db *pgxpool.Pool, log *slog.Logger) error {
+	var exists bool
+	err := db.QueryRow(ctx, `SELECT to_regclass('users_username_idx') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("Failed to look up users username index: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	rows, err := db.Query(ctx, `SELECT username FROM users GROUP BY username HAVING count(*) > 1 ORDER BY username`)
+	if err != nil {
+		return fmt.Errorf("Failed to look up duplicate usernames: %w", err)
+	}
+	duplicates, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("Failed to look up duplicate usernames: %w", err)
+	}
+	if len(duplicates) > 0 {
+		log.Error("Usernames are not unique, users_username_idx is not created; rename or delete the duplicate users and restart",
+			slog.Any("usernames", duplicates))
+		return nil
+	}
+
+	_, err = db.Exec(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS users_username_idx ON users (username)`)
+	if err != nil {
+		return fmt.Errorf("Failed to create users username index: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,330 @@
+package banners
+
+import (
+	"banner/internal/lib/api/middlewares"
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	DefaultChangeRequestsLimit = 100
+	MaxChangeRequestsLimit     = 1000
+)
+
+// ChangeRequestFilter selects change requests, newest first. Zero fields do
+// not filter.
+type ChangeRequestFilter struct {
+	Status   string
+	BannerID int
+	Limit    int
+}
+
+// RequestChangeRequest is the body of POST /banner/{id}/change_requests.
+// Version is the banner version the draft is submitted at, unless If-Match
+// is sent.
+type RequestChangeRequest struct {
+	Version *int64 `json:"version,omitempty"`
+	Comment string `json:"comment"`
+}
+
+// RequestReview is the body of the approve and reject endpoints.
+type RequestReview struct {
+	Comment string `json:"comment"`
+}
+
+type ResponseChangeRequests struct {
+	Items []models.ChangeRequest `json:"items"`
+}
+
+// CreateChangeRequest submits the banner draft for approval by another
+// admin. The request keeps a copy of the draft, so later edits of the draft
+// need a new request.
+func CreateChangeRequest(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.createChangeRequest.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		var req RequestChangeRequest
+		if err := decodeOptionalBody(r, &req); err != nil {
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+
+		banner, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		version, err := expectedVersion(r, bannerID, req.Version)
+		if err == nil && version != banner.Version {
+			err = errPreconditionFailed
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, banner)
+			return
+		}
+
+		change := models.ChangeRequest{
+			BannerID:    bannerID,
+			BaseVersion: version,
+			Author:      middlewares.Username(r.Context()),
+			Comment:     req.Comment,
+		}
+		err = bannerRepo.CreateChangeRequest(r.Context(), &change)
+		switch {
+		case errors.Is(err, repository.ErrVersionMismatch) || errors.Is(err, repository.ErrNotFound):
+			responseConcurrentChange(w, r, log, bannerRepo, bannerID)
+			return
+		case errors.Is(err, repository.ErrNoDraft):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Banner has no draft to submit")
+			return
+		case errors.Is(err, repository.ErrExists):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				"Banner already has a pending change request, it must be approved or rejected first")
+			return
+		case err != nil:
+			log.Error("Failed to create change request", logerr.Err(err))
+			response.Internal(w, r, "Failed to create change request")
+			return
+		}
+
+		log.Info("Change request created", slog.Int("change_request_id", change.ID),
+			slog.Int("banner_id", bannerID), slog.String("author", change.Author))
+		render.Status(r, http.StatusCreated)
+		responseChangeRequest(w, r, change)
+	}
+}
+
+// ListChangeRequests returns change requests newest first, filtered by
+// status and banner_id.
+func ListChangeRequests(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := ChangeRequestFilter{Status: query.Get("status"), Limit: DefaultChangeRequestsLimit}
+		switch filter.Status {
+		case "", models.ChangeRequestPending, models.ChangeRequestApproved, models.ChangeRequestRejected, models.ChangeRequestCanceled:
+		default:
+			response.BadRequest(w, r, "status must be pending, approved, rejected or canceled")
+			return
+		}
+
+		bannerID, err := queryInt(query, "banner_id", true)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		if bannerID != nil {
+			filter.BannerID = *bannerID
+		}
+
+		limit, err := queryInt(query, "limit", true)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		if limit != nil {
+			if *limit < 1 || *limit > MaxChangeRequestsLimit {
+				response.BadRequest(w, r, "limit must be between 1 and "+strconv.Itoa(MaxChangeRequestsLimit))
+				return
+			}
+			filter.Limit = *limit
+		}
+
+		changes, err := bannerRepo.FindChangeRequests(r.Context(), filter)
+		if err != nil {
+			log.Error("Failed to find change requests", logerr.Err(err))
+			response.Internal(w, r, "Failed to find change requests")
+			return
+		}
+
+		if changes == nil {
+			changes = []models.ChangeRequest{}
+		}
+		render.JSON(w, r, ResponseChangeRequests{Items: changes})
+	}
+}
+
+func GetChangeRequest(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid change request ID")
+			return
+		}
+
+		change, err := bannerRepo.FindChangeRequest(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Change request not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find change request", logerr.Err(err))
+			response.Internal(w, r, "Failed to find change request")
+			return
+		}
+
+		responseChangeRequest(w, r, change)
+	}
+}
+
+// ApproveChangeRequest publishes a pending change request. Its author cannot
+// approve it.
+func ApproveChangeRequest(bannerRepo Banners, log *slog.Logger, bannerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.approveChangeRequest.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid change request ID")
+			return
+		}
+
+		var req RequestReview
+		if err := decodeOptionalBody(r, &req); err != nil {
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+
+		change, err := bannerRepo.FindChangeRequest(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Change request not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find change request", logerr.Err(err))
+			response.Internal(w, r, "Failed to find change request")
+			return
+		}
+
+		reviewer := middlewares.Username(r.Context())
+		if reviewer == change.Author {
+			response.Error(w, r, http.StatusForbidden, response.CodeForbidden, "Change requests must be approved by someone other than their author")
+			return
+		}
+
+		// The banner as it is before the change, for cache invalidation.
+		previous, err := bannerRepo.FindBannerId(r.Context(), change.BannerID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		change, banner, err := bannerRepo.ApproveChangeRequest(r.Context(), id, reviewer, req.Comment)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(w, r, "Change request not found")
+			return
+		case errors.Is(err, repository.ErrDecided):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Change request is not pending")
+			return
+		case errors.Is(err, repository.ErrVersionMismatch):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				"Banner was changed or deleted after the change request was made, reject it and submit a new one")
+			return
+		case errors.Is(err, repository.ErrExists):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				"A live banner has the same feature, targeting and one of the tags as the change request: "+err.Error())
+			return
+		case errors.Is(err, repository.ErrInvalidReference):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Change request refers to a deleted tag: "+err.Error())
+			return
+		case err != nil:
+			log.Error("Failed to approve change request", logerr.Err(err))
+			response.Internal(w, r, "Failed to approve change request")
+			return
+		}
+
+		log.Info("Change request approved", slog.Int("change_request_id", id), slog.Int("banner_id", banner.ID),
+			slog.Int64("version", banner.Version), slog.String("reviewer", reviewer))
+		invalidateCache(bannerCache, previous)
+		invalidateCache(bannerCache, banner)
+		responseChangeRequest(w, r, change)
+	}
+}
+
+// RejectChangeRequest closes a pending change request without publishing it.
+// Authors may reject their own requests to withdraw them.
+func RejectChangeRequest(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid change request ID")
+			return
+		}
+
+		var req RequestReview
+		if err := decodeOptionalBody(r, &req); err != nil {
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+
+		reviewer := middlewares.Username(r.Context())
+		change, err := bannerRepo.RejectChangeRequest(r.Context(), id, reviewer, req.Comment)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(w, r, "Change request not found")
+			return
+		case errors.Is(err, repository.ErrDecided):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Change request is not pending")
+			return
+		case err != nil:
+			log.Error("Failed to reject change request", logerr.Err(err))
+			response.Internal(w, r, "Failed to reject change request")
+			return
+		}
+
+		log.Info("Change request rejected", slog.Int("change_request_id", id), slog.String("reviewer", reviewer))
+		responseChangeRequest(w, r, change)
+	}
+}
+
+// decodeOptionalBody decodes a JSON body into v; an empty body leaves v as
+// it is.
+func decodeOptionalBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || len(body) == 0 {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// responseChangeRequest writes the change request as is: its status field is
+// the request status, not the "OK" of other responses.
+func responseChangeRequest(w http.ResponseWriter, r *http.Request, change models.ChangeRequest) {
+	if change.TagIDs == nil {
+		change.TagIDs = []int{}
+	}
+	render.JSON(w, r, change)
+}
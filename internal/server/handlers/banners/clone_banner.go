@@ -0,0 +1,176 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// MaxCloneTargets is the most banners one clone request may create.
+const MaxCloneTargets = 100
+
+// Target statuses of a clone report.
+const (
+	CloneCreated  = "created"
+	CloneConflict = "conflict"
+	CloneInvalid  = "invalid"
+	CloneFailed   = "failed"
+)
+
+// RequestCloneBanner lists where to copy a banner: to every feature of
+// FeatureIDs with every tag set of TagSets. Without FeatureIDs the clones
+// keep the feature of the banner, without TagSets its tags.
+type RequestCloneBanner struct {
+	FeatureIDs []int   `json:"feature_ids"`
+	TagSets    [][]int `json:"tag_sets"`
+	// Disabled creates the clones inactive; otherwise they are active if
+	// the banner is.
+	Disabled bool `json:"disabled"`
+}
+
+type CloneResult struct {
+	FeatureID int    `json:"feature_id"`
+	TagIDs    []int  `json:"tag_ids"`
+	Status    string `json:"status"`
+	BannerID  int    `json:"banner_id,omitempty"`
+	// ConflictingBannerID is the banner that already has the feature and
+	// one of the tags.
+	ConflictingBannerID int    `json:"conflicting_banner_id,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+type ResponseClone struct {
+	Created   int           `json:"created"`
+	Conflicts int           `json:"conflicts"`
+	Invalid   int           `json:"invalid"`
+	Failed    int           `json:"failed"`
+	Results   []CloneResult `json:"results"`
+}
+
+// CloneBanner copies the published content and settings of a banner to
+// other features and tag sets. Every target is created on its own and a
+// target whose feature already has a banner with one of its tags is reported
+// as a conflict, so the other targets are still created.
+func CloneBanner(bannerRepo Banners, log *slog.Logger, bannerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.cloneBanner.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		var req RequestCloneBanner
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+		if len(req.FeatureIDs) == 0 && len(req.TagSets) == 0 {
+			response.BadRequest(w, r, "feature_ids or tag_sets is required")
+			return
+		}
+		for _, tagIDs := range req.TagSets {
+			if len(tagIDs) == 0 {
+				response.BadRequest(w, r, "tag_sets must not contain empty sets")
+				return
+			}
+		}
+
+		source, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		featureIDs, tagSets := req.FeatureIDs, req.TagSets
+		if len(featureIDs) == 0 {
+			featureIDs = []int{source.FeatureID}
+		}
+		if len(tagSets) == 0 {
+			tagSets = [][]int{source.TagIDs}
+		}
+		if len(featureIDs)*len(tagSets) > MaxCloneTargets {
+			response.BadRequest(w, r, fmt.Sprintf("Clone must not have more than %d targets", MaxCloneTargets))
+			return
+		}
+
+		resp := ResponseClone{Results: make([]CloneResult, 0, len(featureIDs)*len(tagSets))}
+		for _, featureID := range featureIDs {
+			for _, tagIDs := range tagSets {
+				result := cloneTo(r, log, bannerRepo, bannerCache, source, featureID, tagIDs, req.Disabled)
+				switch result.Status {
+				case CloneCreated:
+					resp.Created++
+				case CloneConflict:
+					resp.Conflicts++
+				case CloneInvalid:
+					resp.Invalid++
+				case CloneFailed:
+					resp.Failed++
+				}
+				resp.Results = append(resp.Results, result)
+			}
+		}
+
+		log.Info("Banner cloned", slog.Int("banner_id", bannerID), slog.Int("created", resp.Created),
+			slog.Int("conflicts", resp.Conflicts), slog.Int("invalid", resp.Invalid), slog.Int("failed", resp.Failed))
+		render.JSON(w, r, resp)
+	}
+}
+
+// cloneTo creates one copy of the source banner and reports the outcome.
+func cloneTo(r *http.Request, log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache, source models.Banner, featureID int, tagIDs []int, disabled bool) CloneResult {
+	now := time.Now()
+	clone := source
+	clone.ID = 0
+	clone.FeatureID = featureID
+	clone.TagIDs = slices.Clone(tagIDs)
+	clone.IsActive = source.IsActive && !disabled
+	clone.HasDraft = false
+	clone.CreatedAt, clone.UpdatedAt = now, now
+
+	result := CloneResult{FeatureID: featureID, TagIDs: clone.TagIDs}
+	conflictID, err := bannerRepo.CreateBanner(r.Context(), &clone)
+	switch {
+	case errors.Is(err, repository.ErrExists):
+		result.Status = CloneConflict
+		result.ConflictingBannerID = conflictID
+		result.Error = fmt.Sprintf("Banner %d already has feature %d, the same targeting and one of the tags", conflictID, featureID)
+	case errors.Is(err, repository.ErrInvalidReference):
+		result.Status = CloneInvalid
+		result.Error = "Clone refers to a missing record: " + err.Error()
+	case err != nil:
+		log.Error("Failed to create banner clone", logerr.Err(err))
+		result.Status = CloneFailed
+		result.Error = "Failed to create banner"
+	default:
+		result.Status = CloneCreated
+		result.BannerID = clone.ID
+		invalidateCache(bannerCache, clone)
+	}
+
+	return result
+}
@@ -4,8 +4,12 @@ import (
 	response "banner/internal/lib/api/responses"
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
@@ -19,7 +23,19 @@ type RequestBanner struct {
 	TagIDs    []int                  `json:"tag_ids" validate:"required"`
 	FeatureID int                    `json:"feature_id" validate:"required"`
 	Content   map[string]interface{} `json:"content" validate:"required"`
-	IsActive  bool                   `json:"is_active" validate:"required"`
+	IsActive  *bool                  `json:"is_active" validate:"required"`
+	// DefaultLocale is the language of Content and Locales holds content
+	// in other languages, by BCP 47 language tag.
+	DefaultLocale string                            `json:"default_locale"`
+	Locales       map[string]map[string]interface{} `json:"locales"`
+	// Platforms and AppVersion, a semver range, restrict who sees the
+	// banner; empty means everyone.
+	Platforms  []string `json:"platforms"`
+	AppVersion string   `json:"app_version"`
+	// Rule is a targeting expression over the attributes of the user.
+	Rule string `json:"rule"`
+	// Template turns on placeholders in the content.
+	Template *models.Template `json:"template"`
 }
 
 type ResponseBanner struct {
@@ -29,22 +45,79 @@ type ResponseBanner struct {
 	FeatureID int                    `json:"feature_id"`
 	Content   map[string]interface{} `json:"content"`
 	IsActive  bool                   `json:"is_active"`
+	Version   int64                  `json:"version"`
+	HasDraft  bool                   `json:"has_draft"`
+
+	DefaultLocale string                            `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]interface{} `json:"locales,omitempty"`
+	Platforms     []string                          `json:"platforms,omitempty"`
+	AppVersion    string                            `json:"app_version,omitempty"`
+	Rule          string                            `json:"rule,omitempty"`
+	Template      *models.Template                  `json:"template,omitempty"`
 }
 
 type Banners interface {
-	CreateBanner(ctx context.Context, banner *models.Banner) error
-	FindBannerFeatureTag(ctx context.Context, featureID, tagID int) (*models.Banner, error)
-	DeleteBannerID(ctx context.Context, id int) error
+	// CreateBanner creates the banner unless a banner of its feature with
+	// the same targeting already has one of its tags; then it fails with
+	// repository.ErrExists and returns the ID of that banner.
+	CreateBanner(ctx context.Context, banner *models.Banner) (int, error)
+	// FindBannersFeatureTag returns the live banners of the feature with
+	// the tag, ordered by ID, or repository.ErrNotFound if there are none.
+	FindBannersFeatureTag(ctx context.Context, featureID, tagID int) ([]models.Banner, error)
+	// DeleteBannerID moves the banner to the trash if it is still at the
+	// given version.
+	DeleteBannerID(ctx context.Context, id int, version int64) error
+	// FindTrashedBanners returns up to limit banners in the trash, most
+	// recently deleted first.
+	FindTrashedBanners(ctx context.Context, limit int) ([]models.Banner, error)
+	FindTrashedBanner(ctx context.Context, id int) (models.Banner, error)
+	// RestoreBanner takes the banner out of the trash if it is still at
+	// version and returns it.
+	RestoreBanner(ctx context.Context, id int, version int64) (models.Banner, error)
 	FindBannersParameters(ctx context.Context, params RequestGetBanners) ([]models.Banner, error)
-	UpdateBanner(ctx context.Context, banner *models.Banner) error
+	CountBanners(ctx context.Context, params RequestGetBanners) (int, error)
 	FindBannerId(ctx context.Context, id int) (models.Banner, error)
+	// FindBannerDraft returns the banner as its draft would publish it,
+	// repository.ErrNoDraft if it has none.
+	FindBannerDraft(ctx context.Context, id int) (models.Banner, error)
+	// SaveBannerDraft stores draft as the draft of banner draft.ID if the
+	// banner is still at draft.Version, and sets draft.Version to the new
+	// version. The published banner does not change.
+	SaveBannerDraft(ctx context.Context, draft *models.Banner) error
+	// PublishBannerDraft replaces the banner with its draft, if it is
+	// still at version, and returns the published banner. It fails with
+	// repository.ErrApprovalRequired if the feature of the banner or of the
+	// draft requires approval and with repository.ErrExists if another live
+	// banner conflicts with the draft, as in CreateBanner.
+	PublishBannerDraft(ctx context.Context, id int, version int64) (models.Banner, error)
+	// DiscardBannerDraft deletes the draft if the banner is still at
+	// version.
+	DiscardBannerDraft(ctx context.Context, id int, version int64) error
+	// CreateChangeRequest submits the draft of banner change.BannerID, if
+	// the banner is still at change.BaseVersion, and fills in change from
+	// it. It fails with repository.ErrExists if a request is pending.
+	CreateChangeRequest(ctx context.Context, change *models.ChangeRequest) error
+	FindChangeRequests(ctx context.Context, filter ChangeRequestFilter) ([]models.ChangeRequest, error)
+	FindChangeRequest(ctx context.Context, id int) (models.ChangeRequest, error)
+	// ApproveChangeRequest publishes a pending request, if its banner is
+	// still at the base version and no other live banner conflicts with it,
+	// and records the decision. It returns the request and the published
+	// banner.
+	ApproveChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, models.Banner, error)
+	RejectChangeRequest(ctx context.Context, id int, reviewer, comment string) (models.ChangeRequest, error)
+	// SaveBanners creates the banners with a zero ID and saves the others
+	// as drafts if they are still at their version, in one transaction.
+	// Drafts of banners whose current or new feature requires approval are
+	// submitted as change requests of author, which it returns; it fails
+	// with repository.ErrExists if such a banner has a pending one, and with
+	// *repository.ConflictError if a new banner conflicts with a live one.
+	SaveBanners(ctx context.Context, banners []*models.Banner, author, comment string) ([]models.ChangeRequest, error)
+	// ExportBanners calls fn for every banner in ID order and stops at the
+	// first error.
+	ExportBanners(ctx context.Context, fn func(ExportedBanner) error) error
 }
 
-type BannerTags interface {
-	CreateBannerTag(ctx context.Context, bannerTag *models.BannerTag) error
-}
-
-func NewBanner(log *slog.Logger, bannerRepo Banners, bannerTagsRepository BannerTags) http.HandlerFunc {
+func NewBanner(log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const loggerOptions = "handlers.banners.createBanner.New"
 		log = log.With(
@@ -55,7 +128,7 @@ func NewBanner(log *slog.Logger, bannerRepo Banners, bannerTagsRepository Banner
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
 			log.Error("Failed to decode request body", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to decode request"))
+			response.BadRequest(w, r, "Failed to decode request")
 			return
 		}
 
@@ -63,46 +136,80 @@ func NewBanner(log *slog.Logger, bannerRepo Banners, bannerTagsRepository Banner
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		defaultLocale, locales, err := normalizeLocales(req.DefaultLocale, req.Locales)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		platforms, appVersion, err := normalizeTargeting(req.Platforms, req.AppVersion)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		targetingRule, err := normalizeRule(req.Rule)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		template, err := normalizeTemplate(req.Template, req.Content, locales)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
 			return
 		}
 
 		banner := models.Banner{
-			TagIDs:    req.TagIDs,
-			FeatureID: req.FeatureID,
-			Content:   req.Content,
-			IsActive:  req.IsActive,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			TagIDs:        req.TagIDs,
+			FeatureID:     req.FeatureID,
+			Content:       req.Content,
+			DefaultLocale: defaultLocale,
+			Locales:       locales,
+			Platforms:     platforms,
+			AppVersion:    appVersion,
+			Rule:          targetingRule,
+			Template:      template,
+			IsActive:      *req.IsActive,
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
 		}
 
-		err = bannerRepo.CreateBanner(r.Context(), &banner)
-		if err != nil {
+		conflictID, err := bannerRepo.CreateBanner(r.Context(), &banner)
+		switch {
+		case errors.Is(err, repository.ErrExists):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				fmt.Sprintf("Banner %d already has feature %d, the same targeting and one of the tags", conflictID, banner.FeatureID))
+			return
+		case errors.Is(err, repository.ErrInvalidReference):
+			response.BadRequest(w, r, "Banner refers to a missing record: "+err.Error())
+			return
+		case err != nil:
 			log.Error("Failed to create banner", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to create banner"))
+			response.Internal(w, r, "Failed to create banner")
 			return
 		}
 
 		log.Info("Banner added")
-		for _, tagID := range req.TagIDs {
-			bannerTag := models.BannerTag{
-				BannerID: banner.ID,
-				TagID:    tagID,
-			}
-			err = bannerTagsRepository.CreateBannerTag(r.Context(), &bannerTag)
-			if err != nil {
-				log.Error("Failed to create banner tag", logerr.Err(err))
-				render.JSON(w, r, response.Error("Failed to create banner tag"))
-				return
-			}
-		}
-
-		log.Info("Banner-tags added")
+		invalidateCache(bannerCache, banner)
+		render.Status(r, http.StatusCreated)
 		ResponseOK(w, r, banner)
 	}
 }
 
+// invalidateCache drops cached results, including "not found" ones, for
+// every feature and tag pair of the banner so changes show up immediately.
+func invalidateCache(bannerCache *cache.Cache, banner models.Banner) {
+	for _, tagID := range banner.TagIDs {
+		bannerCache.Delete(banner.FeatureID, tagID)
+	}
+}
+
+// ResponseOK writes the banner with its version, also as the ETag to send in
+// If-Match with the next change.
 func ResponseOK(w http.ResponseWriter, r *http.Request, banner models.Banner) {
+	w.Header().Set("ETag", bannerETag(banner))
 	render.JSON(w, r, ResponseBanner{
 		Response:  response.OK(),
 		ID:        banner.ID,
@@ -110,5 +217,14 @@ func ResponseOK(w http.ResponseWriter, r *http.Request, banner models.Banner) {
 		FeatureID: banner.FeatureID,
 		Content:   banner.Content,
 		IsActive:  banner.IsActive,
+		Version:   banner.Version,
+		HasDraft:  banner.HasDraft,
+
+		DefaultLocale: banner.DefaultLocale,
+		Locales:       banner.Locales,
+		Platforms:     banner.Platforms,
+		AppVersion:    banner.AppVersion,
+		Rule:          banner.Rule,
+		Template:      banner.Template,
 	})
 }
@@ -0,0 +1,69 @@
+package banners
+
+import (
+	"banner/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Columns GET /banner can sort by.
+const (
+	SortID        = "id"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+)
+
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var errInvalidCursor = errors.New("cursor is invalid or was issued for a different sort order")
+
+// Cursor is the position after the last banner of a page: its sort key and
+// ID, which breaks ties between banners with equal timestamps. Clients get it
+// as an opaque string.
+type Cursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	ID    int       `json:"id"`
+	Time  time.Time `json:"t,omitempty"`
+}
+
+func cursorAfter(banner models.Banner, sort, order string) Cursor {
+	c := Cursor{Sort: sort, Order: order, ID: banner.ID}
+	switch sort {
+	case SortCreatedAt:
+		c.Time = banner.CreatedAt
+	case SortUpdatedAt:
+		c.Time = banner.UpdatedAt
+	}
+
+	return c
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor and checks that it belongs to the requested
+// sort order, since a position in one order means nothing in another.
+func decodeCursor(s, sort, order string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errInvalidCursor
+	}
+	if c.Sort != sort || c.Order != order {
+		return nil, errInvalidCursor
+	}
+
+	return &c, nil
+}
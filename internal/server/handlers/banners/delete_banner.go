@@ -3,16 +3,22 @@ package banners
 import (
 	response "banner/internal/lib/api/responses"
 	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/render"
 )
 
-func DeleteBanner(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
+// DeleteBanner moves the banner to the trash, from which it can be restored
+// until it is purged.
+func DeleteBanner(log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const loggerOptions = "handlers.banners.deleteBanner.New"
 		log := log.With(
@@ -22,20 +28,51 @@ func DeleteBanner(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.Error("Invalid banner ID"))
+			response.BadRequest(w, r, "Invalid banner ID")
 			return
 		}
 
-		err = bannerRepo.DeleteBannerID(r.Context(), id)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.BadRequest(w, r, "Failed to read request body")
+			return
+		}
+
+		version, err := expectedVersion(r, id, versionOf(body))
+		if errors.Is(err, errPreconditionFailed) {
+			responseConcurrentChange(w, r, log, bannerRepo, id)
+			return
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, models.Banner{})
+			return
+		}
+
+		// The banner as it is before the delete, for cache invalidation.
+		previous, err := bannerRepo.FindBannerId(r.Context(), id)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		err = bannerRepo.DeleteBannerID(r.Context(), id, version)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			responseConcurrentChange(w, r, log, bannerRepo, id)
+			return
+		}
 		if err != nil {
 			log.Error("Failed to delete banner", logerr.Err(err))
-			render.Status(r, http.StatusInternalServerError)
-			render.JSON(w, r, response.Error("Failed to delete banner"))
+			response.Internal(w, r, "Failed to delete banner")
 			return
 		}
 
-		log.Info("Banner deleted")
-		render.Status(r, http.StatusNoContent)
+		log.Info("Banner moved to the trash", slog.Int("banner_id", id))
+		invalidateCache(bannerCache, previous)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
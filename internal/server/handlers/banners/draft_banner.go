@@ -0,0 +1,168 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// GetBannerDraft returns the banner as its draft would publish it, with the
+// banner version in ETag.
+func GetBannerDraft(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		draft, err := bannerRepo.FindBannerDraft(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNoDraft) {
+			response.NotFound(w, r, "Banner has no draft")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find banner draft", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner draft")
+			return
+		}
+
+		ResponseOK(w, r, draft)
+	}
+}
+
+// PublishBanner replaces the banner users see with its draft at once. Like
+// other changes, it needs the banner version in If-Match or the body. Drafts
+// of features that require approval are published by approving a change
+// request instead.
+func PublishBanner(bannerRepo Banners, log *slog.Logger, bannerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.publishBanner.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.BadRequest(w, r, "Failed to read request body")
+			return
+		}
+
+		previous, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		version, err := expectedVersion(r, bannerID, versionOf(body))
+		if err == nil && version != previous.Version {
+			err = errPreconditionFailed
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, previous)
+			return
+		}
+
+		banner, err := bannerRepo.PublishBannerDraft(r.Context(), bannerID, version)
+		switch {
+		case errors.Is(err, repository.ErrVersionMismatch) || errors.Is(err, repository.ErrNotFound):
+			responseConcurrentChange(w, r, log, bannerRepo, bannerID)
+			return
+		case errors.Is(err, repository.ErrNoDraft):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Banner has no draft to publish")
+			return
+		case errors.Is(err, repository.ErrApprovalRequired):
+			response.Error(w, r, http.StatusConflict, response.CodeApprovalRequired,
+				"Banner feature requires approval, submit the draft with POST /banner/{id}/change_requests")
+			return
+		case errors.Is(err, repository.ErrExists):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				"A live banner has the same feature, targeting and one of the tags as the draft: "+err.Error())
+			return
+		case errors.Is(err, repository.ErrInvalidReference):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Draft refers to a deleted tag: "+err.Error())
+			return
+		case err != nil:
+			log.Error("Failed to publish banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to publish banner")
+			return
+		}
+
+		log.Info("Banner published", slog.Int("banner_id", bannerID), slog.Int64("version", banner.Version))
+		invalidateCache(bannerCache, previous)
+		invalidateCache(bannerCache, banner)
+		ResponseOK(w, r, banner)
+	}
+}
+
+// DiscardBannerDraft deletes the draft, leaving the published banner as it
+// is.
+func DiscardBannerDraft(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.BadRequest(w, r, "Failed to read request body")
+			return
+		}
+
+		version, err := expectedVersion(r, bannerID, versionOf(body))
+		if errors.Is(err, errPreconditionFailed) {
+			responseConcurrentChange(w, r, log, bannerRepo, bannerID)
+			return
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, models.Banner{})
+			return
+		}
+
+		err = bannerRepo.DiscardBannerDraft(r.Context(), bannerID, version)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(w, r, "Banner not found")
+			return
+		case errors.Is(err, repository.ErrNoDraft):
+			response.NotFound(w, r, "Banner has no draft")
+			return
+		case errors.Is(err, repository.ErrVersionMismatch):
+			responseConcurrentChange(w, r, log, bannerRepo, bannerID)
+			return
+		case err != nil:
+			log.Error("Failed to discard banner draft", logerr.Err(err))
+			response.Internal(w, r, "Failed to discard banner draft")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,200 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+
+	// exportFlushRows is how often the export is flushed to the client.
+	exportFlushRows = 100
+)
+
+// ExportedBanner is a banner with the names of its feature and tags, as
+// written by GET /banner/export. FeatureName is nil if the feature does not
+// exist.
+type ExportedBanner struct {
+	models.Banner
+	FeatureName *string  `json:"feature_name"`
+	TagNames    []string `json:"tag_names"`
+}
+
+// csvExportHeader are the columns of a CSV export. Lists and content are
+// JSON, so the file can be imported back as is.
+var csvExportHeader = []string{
+	"banner_id", "feature_id", "feature_name", "tag_ids", "tag_names",
+	"content", "is_active", "version", "created_at", "updated_at",
+	"default_locale", "locales", "platforms", "app_version", "rule", "template",
+}
+
+// ExportBanners streams every banner with its tags and feature, as JSON
+// Lines or, with format=csv, as CSV.
+func ExportBanners(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.exportBanners.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = ExportFormatNDJSON
+		}
+
+		var writer bannerWriter
+		switch format {
+		case ExportFormatNDJSON:
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+			writer = ndjsonWriter{json.NewEncoder(w)}
+		case ExportFormatCSV:
+			w.Header().Set("Content-Type", ContentTypeCSV)
+			writer = &csvWriter{Writer: csv.NewWriter(w)}
+		default:
+			response.BadRequest(w, r, "format must be ndjson or csv")
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="banners.`+format+`"`)
+
+		rows := 0
+		controller := http.NewResponseController(w)
+		err := bannerRepo.ExportBanners(r.Context(), func(banner ExportedBanner) error {
+			if err := writer.Write(banner); err != nil {
+				return err
+			}
+			if rows++; rows%exportFlushRows == 0 {
+				controller.Flush()
+			}
+			return nil
+		})
+		if err != nil && rows == 0 {
+			// Nothing has been sent yet.
+			log.Error("Failed to export banners", logerr.Err(err))
+			w.Header().Del("Content-Disposition")
+			response.Internal(w, r, "Failed to export banners")
+			return
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			log.Error("Failed to export banners", logerr.Err(err), slog.Int("rows", rows))
+			// The status has been sent with the first rows, so the only way
+			// to tell the client the export is incomplete is to cut it off.
+			panic(http.ErrAbortHandler)
+		}
+
+		log.Info("Banners exported", slog.Int("rows", rows))
+	}
+}
+
+type bannerWriter interface {
+	Write(banner ExportedBanner) error
+	Flush() error
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n ndjsonWriter) Write(banner ExportedBanner) error {
+	return n.encoder.Encode(banner)
+}
+
+func (n ndjsonWriter) Flush() error {
+	return nil
+}
+
+// csvWriter writes the header with the first row, so that nothing is sent
+// if the export fails before it.
+type csvWriter struct {
+	*csv.Writer
+	headerDone bool
+}
+
+func (c *csvWriter) Write(banner ExportedBanner) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+
+	return c.Writer.Write(csvExportRecord(banner))
+}
+
+func (c *csvWriter) Flush() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+
+	return c.Writer.Error()
+}
+
+func (c *csvWriter) header() error {
+	if c.headerDone {
+		return nil
+	}
+	c.headerDone = true
+
+	return c.Writer.Write(csvExportHeader)
+}
+
+func csvExportRecord(banner ExportedBanner) []string {
+	tagIDs, _ := json.Marshal(nonNil(banner.TagIDs))
+	tagNames, _ := json.Marshal(nonNil(banner.TagNames))
+	platforms, _ := json.Marshal(nonNil(banner.Platforms))
+	content, _ := json.Marshal(banner.Content)
+	locales := "{}"
+	if len(banner.Locales) > 0 {
+		data, _ := json.Marshal(banner.Locales)
+		locales = string(data)
+	}
+	template := ""
+	if banner.Template != nil {
+		data, _ := json.Marshal(banner.Template)
+		template = string(data)
+	}
+
+	featureName := ""
+	if banner.FeatureName != nil {
+		featureName = *banner.FeatureName
+	}
+
+	return []string{
+		strconv.Itoa(banner.ID),
+		strconv.Itoa(banner.FeatureID),
+		featureName,
+		string(tagIDs),
+		string(tagNames),
+		string(content),
+		strconv.FormatBool(banner.IsActive),
+		strconv.FormatInt(banner.Version, 10),
+		banner.CreatedAt.Format(time.RFC3339Nano),
+		banner.UpdatedAt.Format(time.RFC3339Nano),
+		banner.DefaultLocale,
+		locales,
+		string(platforms),
+		banner.AppVersion,
+		banner.Rule,
+		template,
+	}
+}
+
+// nonNil makes an empty list encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+
+	return s
+}
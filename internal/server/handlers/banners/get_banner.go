@@ -3,58 +3,227 @@ package banners
 import (
 	response "banner/internal/lib/api/responses"
 	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/render"
 )
 
+const (
+	DefaultBannersLimit = 100
+	MaxBannersLimit     = 1000
+)
+
+// RequestGetBanners is the filter, sort order and page of GET /banner and
+// GET /banner/search. Empty ID lists, strings and nil fields do not filter.
+// Time ranges include the lower bound and exclude the upper one.
 type RequestGetBanners struct {
-	FeatureID *int `json:"feature_id"`
-	TagID     *int `json:"tag_id"`
-	Limit     *int `json:"limit"`
-	Offset    *int `json:"offset"`
+	FeatureIDs    []int      `json:"feature_ids"`
+	TagIDs        []int      `json:"tag_ids"`
+	IsActive      *bool      `json:"is_active"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+	UpdatedAfter  *time.Time `json:"updated_after"`
+	UpdatedBefore *time.Time `json:"updated_before"`
+	Text          string     `json:"q"`
+	Path          string     `json:"path"`
+	Sort          string     `json:"sort"`
+	Order         string     `json:"order"`
+	After         *Cursor    `json:"-"`
+	Limit         int        `json:"limit"`
+	IncludeTotal  bool       `json:"include_total"`
+}
+
+type ResponseGetBanners struct {
+	Items      []models.Banner `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Total      *int            `json:"total,omitempty"`
 }
 
 func GetBanners(bannerRepo Banners, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		req := ParseGetBannersRequest(r)
+		req, err := ParseGetBannersRequest(r)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
 
-		banners, err := bannerRepo.FindBannersParameters(r.Context(), req)
+		writeBannersPage(w, r, bannerRepo, logger, req)
+	}
+}
+
+// writeBannersPage finds a page of banners matching req and writes it with
+// the cursor of the next page.
+func writeBannersPage(w http.ResponseWriter, r *http.Request, bannerRepo Banners, logger *slog.Logger, req RequestGetBanners) {
+	// One extra row tells whether there is a next page.
+	page := req
+	page.Limit = req.Limit + 1
+	banners, err := bannerRepo.FindBannersParameters(r.Context(), page)
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		response.BadRequest(w, r, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get banner", logerr.Err(err))
+		response.Internal(w, r, "Failed to get banner")
+		return
+	}
+
+	resp := ResponseGetBanners{Items: banners}
+	if resp.Items == nil {
+		resp.Items = []models.Banner{}
+	}
+	if len(banners) > req.Limit {
+		resp.Items = banners[:req.Limit]
+		resp.NextCursor = cursorAfter(resp.Items[req.Limit-1], req.Sort, req.Order).Encode()
+	}
+
+	if req.IncludeTotal {
+		total, err := bannerRepo.CountBanners(r.Context(), req)
 		if err != nil {
-			render.Status(r, http.StatusInternalServerError)
-			logger.Error("Failed to get banner", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to get banner"))
+			logger.Error("Failed to count banners", logerr.Err(err))
+			response.Internal(w, r, "Failed to count banners")
 			return
 		}
+		resp.Total = &total
+	}
+
+	render.JSON(w, r, resp)
+}
 
-		render.JSON(w, r, banners)
+func ParseGetBannersRequest(r *http.Request) (RequestGetBanners, error) {
+	query := r.URL.Query()
+	req := RequestGetBanners{Sort: SortID, Order: OrderAsc, Limit: DefaultBannersLimit}
+
+	var err error
+	if req.FeatureIDs, err = queryInts(query, "feature_id"); err != nil {
+		return req, err
+	}
+	if req.TagIDs, err = queryInts(query, "tag_id"); err != nil {
+		return req, err
+	}
+	if req.IsActive, err = queryBool(query, "is_active"); err != nil {
+		return req, err
 	}
+	if req.CreatedAfter, err = queryTime(query, "created_after"); err != nil {
+		return req, err
+	}
+	if req.CreatedBefore, err = queryTime(query, "created_before"); err != nil {
+		return req, err
+	}
+	if req.UpdatedAfter, err = queryTime(query, "updated_after"); err != nil {
+		return req, err
+	}
+	if req.UpdatedBefore, err = queryTime(query, "updated_before"); err != nil {
+		return req, err
+	}
+	if req.IncludeTotal, err = queryFlag(query, "include_total"); err != nil {
+		return req, err
+	}
+
+	if limit, err := queryInt(query, "limit", true); err != nil {
+		return req, err
+	} else if limit != nil {
+		if *limit < 1 || *limit > MaxBannersLimit {
+			return req, fmt.Errorf("limit must be between 1 and %d", MaxBannersLimit)
+		}
+		req.Limit = *limit
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if sort != SortID && sort != SortCreatedAt && sort != SortUpdatedAt {
+			return req, fmt.Errorf("sort must be one of %s, %s, %s", SortID, SortCreatedAt, SortUpdatedAt)
+		}
+		req.Sort = sort
+	}
+	if order := query.Get("order"); order != "" {
+		if order != OrderAsc && order != OrderDesc {
+			return req, fmt.Errorf("order must be %s or %s", OrderAsc, OrderDesc)
+		}
+		req.Order = order
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if req.After, err = decodeCursor(cursor, req.Sort, req.Order); err != nil {
+			return req, err
+		}
+	}
+
+	return req, nil
+}
+
+// queryInt parses an optional integer query parameter.
+func queryInt(query url.Values, name string, nonNegative bool) (*int, error) {
+	str := query.Get(name)
+	if str == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+	if nonNegative && n < 0 {
+		return nil, fmt.Errorf("%s must not be negative", name)
+	}
+
+	return &n, nil
+}
+
+// queryInts parses a repeated integer query parameter, e.g. tag_id=1&tag_id=2.
+func queryInts(query url.Values, name string) ([]int, error) {
+	var ids []int
+	for _, str := range query[name] {
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", name)
+		}
+		ids = append(ids, n)
+	}
+
+	return ids, nil
 }
 
-func ParseGetBannersRequest(r *http.Request) RequestGetBanners {
-	req := RequestGetBanners{}
+func queryBool(query url.Values, name string) (*bool, error) {
+	str := query.Get(name)
+	if str == "" {
+		return nil, nil
+	}
 
-	if featureIDStr := r.URL.Query().Get("feature_id"); featureIDStr != "" {
-		featureID, _ := strconv.Atoi(featureIDStr)
-		req.FeatureID = &featureID
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
 	}
 
-	if tagIDStr := r.URL.Query().Get("tag_id"); tagIDStr != "" {
-		tagID, _ := strconv.Atoi(tagIDStr)
-		req.TagID = &tagID
+	return &b, nil
+}
+
+func queryFlag(query url.Values, name string) (bool, error) {
+	b, err := queryBool(query, name)
+	if b == nil {
+		return false, err
 	}
 
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		limit, _ := strconv.Atoi(limitStr)
-		req.Limit = &limit
+	return *b, err
+}
+
+func queryTime(query url.Values, name string) (*time.Time, error) {
+	str := query.Get(name)
+	if str == "" {
+		return nil, nil
 	}
 
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		offset, _ := strconv.Atoi(offsetStr)
-		req.Offset = &offset
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
 	}
 
-	return req
+	return &t, nil
 }
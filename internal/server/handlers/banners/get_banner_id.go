@@ -0,0 +1,38 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetBanner returns one banner with its version in ETag, to send in If-Match
+// with a change.
+func GetBanner(bannerRepo Banners, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		banner, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		ResponseOK(w, r, banner)
+	}
+}
@@ -0,0 +1,476 @@
+package banners
+
+import (
+	"banner/internal/lib/api/middlewares"
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeCSV    = "text/csv"
+
+	// ImportModeValidate only checks the rows, ImportModeUpsert also saves
+	// them.
+	ImportModeValidate = "validate"
+	ImportModeUpsert   = "upsert"
+
+	MaxImportRows  = 10000
+	MaxImportBytes = 32 << 20
+
+	// importComment is the comment of change requests an import submits.
+	importComment = "Imported"
+)
+
+// Row statuses of an import report.
+const (
+	ImportRowValid    = "valid"
+	ImportRowCreated  = "created"
+	ImportRowUpdated  = "updated"
+	ImportRowInvalid  = "invalid"
+	ImportRowSkipped  = "skipped"
+	ImportRowConflict = "conflict"
+	ImportRowFailed   = "failed"
+)
+
+// ImportRow is one banner of an import. A row with the ID of an existing
+// banner becomes its draft, as PATCH does, if the banner is still at
+// Version; if its current or new feature requires approval, the draft is
+// submitted as a change request. Other rows create new banners. Unknown
+// fields are ignored, so exported rows can be imported as they are.
+type ImportRow struct {
+	ID      int    `json:"banner_id"`
+	Version *int64 `json:"version"`
+	RequestBanner
+}
+
+type ImportResult struct {
+	// Row is the line of the row in the file, starting at 1.
+	Row      int    `json:"row"`
+	Status   string `json:"status"`
+	BannerID int    `json:"banner_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// CurrentVersion is the version of the banner a failed row is not
+	// based on, as in a 412 response.
+	CurrentVersion int64 `json:"current_version,omitempty"`
+	// ChangeRequestID is the change request that submits the draft of an
+	// updated row for approval.
+	ChangeRequestID int `json:"change_request_id,omitempty"`
+	// ConflictingBannerID is the live banner a conflict row has the
+	// feature, targeting and a tag of; 0 if it conflicts with another row.
+	ConflictingBannerID int `json:"conflicting_banner_id,omitempty"`
+}
+
+type ResponseImport struct {
+	Mode      string         `json:"mode"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Conflicts int            `json:"conflicts"`
+	Invalid   int            `json:"invalid"`
+	Failed    int            `json:"failed"`
+	Rows      []ImportResult `json:"rows"`
+}
+
+// importRow is a parsed row with its place in the report.
+type importRow struct {
+	result   *ImportResult
+	row      ImportRow
+	banner   models.Banner
+	previous *models.Banner
+}
+
+// ImportBanners creates banners and saves drafts of existing ones from JSON
+// Lines or CSV and reports the outcome of every row. By default all rows are
+// saved in one transaction, so an invalid row saves nothing; with
+// chunk_size=N valid rows are saved N at a time and invalid ones are
+// skipped. mode=validate checks the rows without saving them.
+func ImportBanners(log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.importBanners.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		query := r.URL.Query()
+		mode := query.Get("mode")
+		if mode == "" {
+			mode = ImportModeUpsert
+		}
+		if mode != ImportModeValidate && mode != ImportModeUpsert {
+			response.BadRequest(w, r, "mode must be validate or upsert")
+			return
+		}
+		chunkSize, err := queryInt(query, "chunk_size", true)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImportBytes))
+		if err != nil {
+			response.BadRequest(w, r, fmt.Sprintf("Request body must not be larger than %d bytes", MaxImportBytes))
+			return
+		}
+
+		var rows []*importRow
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == ContentTypeCSV {
+			rows, err = parseCSVRows(body)
+		} else {
+			rows, err = parseNDJSONRows(body)
+		}
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		if len(rows) == 0 {
+			response.BadRequest(w, r, "Import has no rows")
+			return
+		}
+		if len(rows) > MaxImportRows {
+			response.BadRequest(w, r, fmt.Sprintf("Import must not have more than %d rows", MaxImportRows))
+			return
+		}
+
+		valid, err := checkImportRows(r, bannerRepo, rows)
+		if err != nil {
+			log.Error("Failed to check import rows", logerr.Err(err))
+			response.Internal(w, r, "Failed to check import rows")
+			return
+		}
+
+		switch {
+		case mode == ImportModeValidate:
+			setStatus(valid, ImportRowValid, "")
+		case (chunkSize == nil || *chunkSize == 0) && len(valid) < len(rows):
+			setStatus(valid, ImportRowSkipped, "Not saved because other rows are invalid or failed")
+		default:
+			size := len(valid)
+			if chunkSize != nil && *chunkSize > 0 {
+				size = *chunkSize
+			}
+			for start := 0; start < len(valid); start += size {
+				chunk := valid[start:min(start+size, len(valid))]
+				saveImportChunk(r, log, bannerRepo, bannerCache, chunk)
+			}
+		}
+
+		resp := ResponseImport{Mode: mode, Rows: make([]ImportResult, 0, len(rows))}
+		for _, row := range rows {
+			switch row.result.Status {
+			case ImportRowCreated:
+				resp.Created++
+			case ImportRowUpdated:
+				resp.Updated++
+			case ImportRowConflict:
+				resp.Conflicts++
+			case ImportRowInvalid:
+				resp.Invalid++
+			case ImportRowFailed:
+				resp.Failed++
+			}
+			resp.Rows = append(resp.Rows, *row.result)
+		}
+
+		log.Info("Banners imported", slog.Int("created", resp.Created), slog.Int("updated", resp.Updated),
+			slog.Int("conflicts", resp.Conflicts), slog.Int("invalid", resp.Invalid), slog.Int("failed", resp.Failed))
+		render.JSON(w, r, resp)
+	}
+}
+
+// checkImportRows validates the rows, marks invalid ones, looks up the
+// banners the others update and marks those not based on the current
+// version of the banner as failed. It returns the rest.
+func checkImportRows(r *http.Request, bannerRepo Banners, rows []*importRow) ([]*importRow, error) {
+	validate := validator.New()
+	now := time.Now()
+
+	var valid []*importRow
+	for _, row := range rows {
+		if row.result.Status == ImportRowInvalid {
+			continue
+		}
+		if err := validate.Struct(row.row); err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+			continue
+		}
+
+		defaultLocale, locales, err := normalizeLocales(row.row.DefaultLocale, row.row.Locales)
+		if err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+			continue
+		}
+		platforms, appVersion, err := normalizeTargeting(row.row.Platforms, row.row.AppVersion)
+		if err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+			continue
+		}
+		targetingRule, err := normalizeRule(row.row.Rule)
+		if err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+			continue
+		}
+		template, err := normalizeTemplate(row.row.Template, row.row.Content, locales)
+		if err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+			continue
+		}
+
+		row.banner = models.Banner{
+			TagIDs:        row.row.TagIDs,
+			FeatureID:     row.row.FeatureID,
+			Content:       row.row.Content,
+			DefaultLocale: defaultLocale,
+			Locales:       locales,
+			Platforms:     platforms,
+			AppVersion:    appVersion,
+			Rule:          targetingRule,
+			Template:      template,
+			IsActive:      *row.row.IsActive,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if row.row.ID != 0 {
+			previous, err := bannerRepo.FindBannerId(r.Context(), row.row.ID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				if row.row.Version == nil {
+					row.result.Status = ImportRowInvalid
+					row.result.Error = fmt.Sprintf("version is required to update banner %d", previous.ID)
+					continue
+				}
+				if *row.row.Version != previous.Version {
+					row.result.Status = ImportRowFailed
+					row.result.Error = "Banner was changed by someone else, export it again and retry"
+					row.result.CurrentVersion = previous.Version
+					continue
+				}
+				row.previous = &previous
+				row.banner.ID = previous.ID
+				row.banner.Version = previous.Version
+				row.banner.CreatedAt = previous.CreatedAt
+			}
+		}
+
+		valid = append(valid, row)
+	}
+
+	return valid, nil
+}
+
+// saveImportChunk saves the rows in one transaction and records the outcome.
+func saveImportChunk(r *http.Request, log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache, chunk []*importRow) {
+	banners := make([]*models.Banner, len(chunk))
+	for i, row := range chunk {
+		banners[i] = &row.banner
+	}
+
+	changes, err := bannerRepo.SaveBanners(r.Context(), banners, middlewares.Username(r.Context()), importComment)
+	var conflict *repository.ConflictError
+	if errors.As(err, &conflict) {
+		row := chunk[conflict.Index]
+		setStatus(chunk, ImportRowFailed, fmt.Sprintf("Rows not saved: row %d conflicts with a banner", row.result.Row))
+		row.result.Status = ImportRowConflict
+		row.result.Error = conflict.Error()
+		row.result.ConflictingBannerID = conflict.BannerID
+		return
+	}
+	if err != nil {
+		detail := "Failed to save rows"
+		if errors.Is(err, repository.ErrInvalidReference) || errors.Is(err, repository.ErrNotFound) ||
+			errors.Is(err, repository.ErrVersionMismatch) || errors.Is(err, repository.ErrExists) {
+			detail = "Rows not saved: " + err.Error()
+		} else {
+			log.Error("Failed to save imported banners", logerr.Err(err))
+		}
+		setStatus(chunk, ImportRowFailed, detail)
+		return
+	}
+
+	changeIDs := make(map[int]int, len(changes))
+	for _, change := range changes {
+		changeIDs[change.BannerID] = change.ID
+	}
+	for _, row := range chunk {
+		row.result.BannerID = row.banner.ID
+		if row.previous != nil {
+			// Users keep seeing the published banner until the draft is
+			// published.
+			row.result.Status = ImportRowUpdated
+			row.result.ChangeRequestID = changeIDs[row.banner.ID]
+			continue
+		}
+		row.result.Status = ImportRowCreated
+		invalidateCache(bannerCache, row.banner)
+	}
+}
+
+func setStatus(rows []*importRow, status, detail string) {
+	for _, row := range rows {
+		row.result.Status = status
+		row.result.Error = detail
+	}
+}
+
+// parseNDJSONRows reads one banner per line. Blank lines are skipped and
+// rows that are not valid JSON are marked invalid.
+func parseNDJSONRows(body []byte) ([]*importRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, MaxImportBytes)
+
+	var rows []*importRow
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		row := &importRow{result: &ImportResult{Row: line}}
+		if err := json.Unmarshal(scanner.Bytes(), &row.row); err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = "Invalid JSON: " + err.Error()
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// parseCSVRows reads banners from CSV with a header row. The feature_id,
+// tag_ids, content and is_active columns are required, banner_id and
+// version are optional and other columns are ignored. tag_ids and content
+// are JSON.
+func parseCSVRows(body []byte) ([]*importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"feature_id", "tag_ids", "content", "is_active"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header has no %s column", name)
+		}
+	}
+
+	var rows []*importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, &importRow{result: &ImportResult{
+				Row:    parseErr.StartLine,
+				Status: ImportRowInvalid,
+				Error:  "Invalid CSV: " + parseErr.Err.Error(),
+			}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := &importRow{result: &ImportResult{Row: line}}
+		rows = append(rows, row)
+
+		if err := csvImportRow(record, columns, &row.row); err != nil {
+			row.result.Status = ImportRowInvalid
+			row.result.Error = err.Error()
+		}
+	}
+
+	return rows, nil
+}
+
+func csvImportRow(record []string, columns map[string]int, row *ImportRow) error {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var err error
+	if id := field("banner_id"); id != "" {
+		if row.ID, err = strconv.Atoi(id); err != nil {
+			return fmt.Errorf("banner_id must be an integer")
+		}
+	}
+	if version := field("version"); version != "" {
+		v, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return fmt.Errorf("version must be an integer")
+		}
+		row.Version = &v
+	}
+	if row.FeatureID, err = strconv.Atoi(field("feature_id")); err != nil {
+		return fmt.Errorf("feature_id must be an integer")
+	}
+	if err := json.Unmarshal([]byte(field("tag_ids")), &row.TagIDs); err != nil {
+		return fmt.Errorf("tag_ids must be a JSON array of integers")
+	}
+	if err := json.Unmarshal([]byte(field("content")), &row.Content); err != nil {
+		return fmt.Errorf("content must be a JSON object")
+	}
+	row.DefaultLocale = field("default_locale")
+	if locales := field("locales"); locales != "" {
+		if err := json.Unmarshal([]byte(locales), &row.Locales); err != nil {
+			return fmt.Errorf("locales must be a JSON object of content by language tag")
+		}
+	}
+	if platforms := field("platforms"); platforms != "" {
+		if err := json.Unmarshal([]byte(platforms), &row.Platforms); err != nil {
+			return fmt.Errorf("platforms must be a JSON array of strings")
+		}
+	}
+	row.AppVersion = field("app_version")
+	row.Rule = field("rule")
+	if template := field("template"); template != "" {
+		if err := json.Unmarshal([]byte(template), &row.Template); err != nil {
+			return fmt.Errorf("template must be a JSON object")
+		}
+	}
+	isActive, err := strconv.ParseBool(field("is_active"))
+	if err != nil {
+		return fmt.Errorf("is_active must be true or false")
+	}
+	row.IsActive = &isActive
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package banners
+
+import (
+	"banner/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// MaxLocales is the most content variants a banner may have.
+const MaxLocales = 50
+
+var errInvalidLang = errors.New("lang must be a BCP 47 language tag")
+
+// normalizeLocales checks the default locale and the keys of locales, which
+// must be BCP 47 language tags, and returns them in canonical form, so that
+// "en-us" is stored as "en-US". A variant for the default locale is an error:
+// the default content is that variant.
+func normalizeLocales(defaultLocale string, locales map[string]map[string]interface{}) (string, map[string]map[string]interface{}, error) {
+	if defaultLocale != "" {
+		tag, err := language.Parse(defaultLocale)
+		if err != nil {
+			return "", nil, fmt.Errorf("default_locale %q is not a BCP 47 language tag", defaultLocale)
+		}
+		defaultLocale = tag.String()
+	}
+	if len(locales) > MaxLocales {
+		return "", nil, fmt.Errorf("a banner must not have more than %d locales", MaxLocales)
+	}
+	if len(locales) == 0 {
+		return defaultLocale, nil, nil
+	}
+
+	normalized := make(map[string]map[string]interface{}, len(locales))
+	for locale, content := range locales {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return "", nil, fmt.Errorf("locale %q is not a BCP 47 language tag", locale)
+		}
+		if content == nil {
+			return "", nil, fmt.Errorf("content of locale %s is required", locale)
+		}
+		canonical := tag.String()
+		if canonical == defaultLocale {
+			return "", nil, fmt.Errorf("locale %s is the default locale, its content is content", locale)
+		}
+		if _, found := normalized[canonical]; found {
+			return "", nil, fmt.Errorf("locale %s is given twice", canonical)
+		}
+		normalized[canonical] = content
+	}
+
+	return defaultLocale, normalized, nil
+}
+
+// preferredLanguages returns the languages the user asks for, from the lang
+// query parameter or else the Accept-Language header, most preferred first.
+// A malformed header is ignored, as if it were not sent.
+func preferredLanguages(r *http.Request) ([]language.Tag, error) {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		var tags []language.Tag
+		for _, part := range strings.Split(lang, ",") {
+			tag, err := language.Parse(strings.TrimSpace(part))
+			if err != nil {
+				return nil, errInvalidLang
+			}
+			tags = append(tags, tag)
+		}
+		return tags, nil
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil {
+		return nil, nil
+	}
+
+	return tags, nil
+}
+
+// localize picks the content variant of the banner that best matches the
+// preferred languages, using the standard matching of golang.org/x/text, and
+// returns it with its locale. Without a match, or if the banner has no
+// variants, it returns the default content and locale.
+func localize(banner models.Banner, preferred []language.Tag) (map[string]interface{}, string) {
+	if len(banner.Locales) == 0 || len(preferred) == 0 {
+		return banner.Content, banner.DefaultLocale
+	}
+
+	// The default content comes first, as the matcher falls back to the
+	// first supported language.
+	locales := make([]string, 0, len(banner.Locales))
+	for locale := range banner.Locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	supported := []language.Tag{language.Und}
+	if banner.DefaultLocale != "" {
+		supported[0] = language.Make(banner.DefaultLocale)
+	}
+	for _, locale := range locales {
+		supported = append(supported, language.Make(locale))
+	}
+
+	_, i, confidence := language.NewMatcher(supported).Match(preferred...)
+	if i == 0 || confidence == language.No {
+		return banner.Content, banner.DefaultLocale
+	}
+	locale := locales[i-1]
+
+	return banner.Locales[locale], locale
+}
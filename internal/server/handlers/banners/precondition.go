@@ -0,0 +1,95 @@
+package banners
+
+import (
+	"banner/internal/lib/api/etag"
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+var (
+	errPreconditionRequired = errors.New("send the banner ETag in If-Match or its version in the body")
+	errPreconditionFailed   = errors.New("If-Match does not match the banner")
+	errVersionsDisagree     = errors.New("If-Match and version in the body refer to different versions")
+)
+
+// expectedVersion returns the banner version a change is based on, taken
+// from If-Match or the version field of the body. Changes without one are
+// refused, so that concurrent edits cannot silently overwrite each other.
+// If-Match: * is refused for the same reason.
+func expectedVersion(r *http.Request, bannerID int, bodyVersion *int64) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		if bodyVersion == nil {
+			return 0, errPreconditionRequired
+		}
+		return *bodyVersion, nil
+	}
+
+	id, version, ok := etag.Parse(header)
+	if !ok || id != bannerID {
+		return 0, errPreconditionFailed
+	}
+	if bodyVersion != nil && *bodyVersion != version {
+		return 0, errVersionsDisagree
+	}
+
+	return version, nil
+}
+
+// versionOf returns the version field of a JSON object body, if any.
+func versionOf(body []byte) *int64 {
+	var req struct {
+		Version *int64 `json:"version"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return nil
+	}
+
+	return req.Version
+}
+
+// responsePrecondition writes the error of a failed version check. current
+// is the banner as it is now; its version is reported on 412.
+func responsePrecondition(w http.ResponseWriter, r *http.Request, err error, current models.Banner) {
+	switch {
+	case errors.Is(err, errPreconditionRequired):
+		response.Error(w, r, http.StatusPreconditionRequired, response.CodePreconditionRequired, err.Error())
+	case errors.Is(err, errVersionsDisagree):
+		response.BadRequest(w, r, err.Error())
+	default:
+		w.Header().Set("ETag", bannerETag(current))
+		p := response.NewProblem(http.StatusPreconditionFailed, response.CodeVersionMismatch, "Banner was changed by someone else, fetch it and retry")
+		p.CurrentVersion = &current.Version
+		response.WriteProblem(w, r, p)
+	}
+}
+
+// bannerETag is the entity tag of a banner revision, shared by the admin
+// and user endpoints.
+func bannerETag(banner models.Banner) string {
+	return etag.Make(banner.ID, banner.Version)
+}
+
+// responseConcurrentChange answers a write that lost a race with another
+// one: 412 with the current version, or 404 if the banner is gone.
+func responseConcurrentChange(w http.ResponseWriter, r *http.Request, log *slog.Logger, bannerRepo Banners, bannerID int) {
+	current, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.NotFound(w, r, "Banner not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to find banner", logerr.Err(err))
+		response.Internal(w, r, "Failed to find banner")
+		return
+	}
+
+	responsePrecondition(w, r, errPreconditionFailed, current)
+}
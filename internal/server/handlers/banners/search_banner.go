@@ -0,0 +1,38 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const maxSearchLength = 1000
+
+// SearchBanners finds banners by the string values of their content (q, web
+// search syntax: words, "phrases", OR, -word) and/or a JSONPath predicate
+// over the content (path, e.g. `$.title like "Sale%"`). The GET /banner
+// filters, sorting and pagination apply as well.
+func SearchBanners(bannerRepo Banners, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := ParseGetBannersRequest(r)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+
+		query := r.URL.Query()
+		req.Text = strings.TrimSpace(query.Get("q"))
+		req.Path = strings.TrimSpace(query.Get("path"))
+		if req.Text == "" && req.Path == "" {
+			response.BadRequest(w, r, "q or path is required")
+			return
+		}
+		if len(req.Text) > maxSearchLength || len(req.Path) > maxSearchLength {
+			response.BadRequest(w, r, "q and path must not be longer than 1000 bytes")
+			return
+		}
+
+		writeBannersPage(w, r, bannerRepo, logger, req)
+	}
+}
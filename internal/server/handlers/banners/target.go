@@ -0,0 +1,203 @@
+package banners
+
+import (
+	"banner/internal/lib/rule"
+	"banner/internal/lib/semver"
+	"banner/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Platforms banners can be targeted at.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web"
+)
+
+var platforms = []string{PlatformIOS, PlatformAndroid, PlatformWeb}
+
+var (
+	errInvalidPlatform   = errors.New("platform must be one of ios, android, web")
+	errInvalidAppVersion = errors.New("app_version must be a semantic version, e.g. 7.2.1")
+)
+
+// maxAttributes bounds the attr[...] parameters of a user banner request.
+const maxAttributes = 50
+
+// rules keeps the compiled targeting rules of banners, which are evaluated
+// on every user banner request.
+var rules = rule.NewCache(10000)
+
+// normalizeTargeting checks the targeting of a banner and returns the
+// platforms lowercased, sorted and without duplicates, so that banners with
+// the same targeting store the same values.
+func normalizeTargeting(bannerPlatforms []string, appVersion string) ([]string, string, error) {
+	var normalized []string
+	for _, platform := range bannerPlatforms {
+		platform = strings.ToLower(strings.TrimSpace(platform))
+		if !slices.Contains(platforms, platform) {
+			return nil, "", fmt.Errorf("platform %q is not one of ios, android, web", platform)
+		}
+		if !slices.Contains(normalized, platform) {
+			normalized = append(normalized, platform)
+		}
+	}
+	slices.Sort(normalized)
+
+	appVersion = strings.TrimSpace(appVersion)
+	if appVersion != "" {
+		if _, err := semver.ParseRange(appVersion); err != nil {
+			return nil, "", fmt.Errorf("app_version %q is not a version range such as \">=7.2 <8\"", appVersion)
+		}
+	}
+
+	return normalized, appVersion, nil
+}
+
+// normalizeRule checks that the targeting rule of a banner compiles and
+// returns it trimmed.
+func normalizeRule(source string) (string, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return "", nil
+	}
+	if _, err := rule.Compile(source); err != nil {
+		return "", fmt.Errorf("rule: %w", err)
+	}
+
+	return source, nil
+}
+
+// target is who asks for a user banner: the platform and app version of the
+// client, where known, and the attributes for targeting rules.
+type target struct {
+	platform   string
+	version    *semver.Version
+	attributes rule.Attributes
+}
+
+// requestTarget reads the platform and app_version query parameters, or
+// else the X-Platform and X-App-Version headers, and the attributes from
+// attr[name] query parameters. Malformed headers are ignored, as if they
+// were not sent.
+func requestTarget(r *http.Request) (target, error) {
+	var t target
+
+	query := r.URL.Query()
+	for key, values := range query {
+		name, found := strings.CutPrefix(key, "attr[")
+		if !found {
+			continue
+		}
+		name, found = strings.CutSuffix(name, "]")
+		if !found || name == "" {
+			return target{}, fmt.Errorf("invalid attribute parameter %q, expected attr[name]", key)
+		}
+		if t.attributes == nil {
+			t.attributes = make(rule.Attributes)
+		}
+		if len(t.attributes) == maxAttributes {
+			return target{}, fmt.Errorf("at most %d attributes are allowed", maxAttributes)
+		}
+		t.attributes[name] = values[0]
+	}
+	platform, fromQuery := query.Get("platform"), true
+	if platform == "" {
+		platform, fromQuery = r.Header.Get("X-Platform"), false
+	}
+	if platform = strings.ToLower(strings.TrimSpace(platform)); platform != "" {
+		switch {
+		case slices.Contains(platforms, platform):
+			t.platform = platform
+		case fromQuery:
+			return target{}, errInvalidPlatform
+		}
+	}
+
+	appVersion, fromQuery := query.Get("app_version"), true
+	if appVersion == "" {
+		appVersion, fromQuery = r.Header.Get("X-App-Version"), false
+	}
+	if appVersion != "" {
+		version, err := semver.Parse(appVersion)
+		switch {
+		case err == nil:
+			t.version = &version
+		case fromQuery:
+			return target{}, errInvalidAppVersion
+		}
+	}
+
+	return t, nil
+}
+
+// matches reports whether the banner is for the target. A constraint the
+// target says nothing about does not match: a client that does not tell
+// its version must not get a banner for new versions only.
+func (t target) matches(banner models.Banner) bool {
+	if len(banner.Platforms) > 0 && !slices.Contains(banner.Platforms, t.platform) {
+		return false
+	}
+	if banner.AppVersion != "" {
+		if t.version == nil {
+			return false
+		}
+		versions, err := semver.ParseRange(banner.AppVersion)
+		if err != nil || !versions.Contains(*t.version) {
+			return false
+		}
+	}
+	if banner.Rule != "" {
+		r, err := rules.Compile(banner.Rule)
+		if err != nil || !r.Match(t.attributes) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// moreSpecific reports whether banner a is targeted more narrowly than b:
+// it has more constraints or, with the same ones, fewer platforms.
+func moreSpecific(a, b models.Banner) bool {
+	constraints := func(banner models.Banner) int {
+		n := 0
+		if len(banner.Platforms) > 0 {
+			n++
+		}
+		if banner.AppVersion != "" {
+			n++
+		}
+		if banner.Rule != "" {
+			n++
+		}
+		return n
+	}
+
+	if ca, cb := constraints(a), constraints(b); ca != cb {
+		return ca > cb
+	}
+
+	return len(a.Platforms) > 0 && len(a.Platforms) < len(b.Platforms)
+}
+
+// selectBanner returns the most specific of the banners that match the
+// target; among equally specific ones, the first. It returns false if none
+// matches.
+func selectBanner(candidates []models.Banner, t target) (models.Banner, bool) {
+	var (
+		selected models.Banner
+		found    bool
+	)
+	for _, banner := range candidates {
+		if t.matches(banner) && (!found || moreSpecific(banner, selected)) {
+			selected, found = banner, true
+		}
+	}
+
+	return selected, found
+}
@@ -0,0 +1,72 @@
+package banners
+
+import (
+	"banner/internal/lib/placeholder"
+	"banner/internal/models"
+	"fmt"
+	"sort"
+)
+
+// templates keeps the compiled content of banners with placeholders, so it
+// is parsed once per revision and language rather than on every user banner
+// request.
+var templates = placeholder.NewCache(10000)
+
+func templateOptions(template *models.Template) placeholder.Options {
+	return placeholder.Options{
+		Variables: template.Variables,
+		Escape:    template.Escape,
+		OnMissing: template.OnMissing,
+	}
+}
+
+// normalizeTemplate checks the placeholder settings of a banner and the
+// placeholders in its content in every language, and returns the settings
+// with the defaults spelled out.
+func normalizeTemplate(template *models.Template, content map[string]interface{}, locales map[string]map[string]interface{}) (*models.Template, error) {
+	if template == nil {
+		return nil, nil
+	}
+
+	normalized := *template
+	if normalized.Variables == nil {
+		normalized.Variables = []string{}
+	}
+	if normalized.Escape == "" {
+		normalized.Escape = placeholder.EscapeHTML
+	}
+	if normalized.OnMissing == "" {
+		normalized.OnMissing = placeholder.MissingEmpty
+	}
+	opts := templateOptions(&normalized)
+	if _, err := placeholder.Compile(nil, opts); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	if _, err := placeholder.Compile(content, opts); err != nil {
+		return nil, fmt.Errorf("template: content%w", err)
+	}
+	names := make([]string, 0, len(locales))
+	for locale := range locales {
+		names = append(names, locale)
+	}
+	sort.Strings(names)
+	for _, locale := range names {
+		if _, err := placeholder.Compile(locales[locale], opts); err != nil {
+			return nil, fmt.Errorf("template: locales/%s%w", locale, err)
+		}
+	}
+
+	return &normalized, nil
+}
+
+// renderTemplate fills the placeholders in content, the banner content in
+// the language of the request, from the attributes of the request.
+func renderTemplate(banner models.Banner, content map[string]interface{}, attributes map[string]string) (map[string]interface{}, error) {
+	template, err := templates.Compile(content, templateOptions(banner.Template))
+	if err != nil {
+		return nil, err
+	}
+
+	return template.Render(attributes)
+}
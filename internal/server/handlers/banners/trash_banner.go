@@ -0,0 +1,120 @@
+package banners
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"banner/internal/repository/cache"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// ListTrashedBanners returns deleted banners that have not been purged yet,
+// most recently deleted first.
+func ListTrashedBanners(bannerRepo Banners, log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := DefaultBannersLimit
+		n, err := queryInt(r.URL.Query(), "limit", true)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		if n != nil {
+			if *n < 1 || *n > MaxBannersLimit {
+				response.BadRequest(w, r, "limit must be between 1 and "+strconv.Itoa(MaxBannersLimit))
+				return
+			}
+			limit = *n
+		}
+
+		banners, err := bannerRepo.FindTrashedBanners(r.Context(), limit)
+		if err != nil {
+			log.Error("Failed to find trashed banners", logerr.Err(err))
+			response.Internal(w, r, "Failed to find trashed banners")
+			return
+		}
+
+		if banners == nil {
+			banners = []models.Banner{}
+		}
+		render.JSON(w, r, ResponseGetBanners{Items: banners})
+	}
+}
+
+// RestoreBanner takes a deleted banner out of the trash. Like other changes
+// it needs the banner version, which the trash listing shows.
+func RestoreBanner(bannerRepo Banners, log *slog.Logger, bannerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.banners.restoreBanner.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			response.BadRequest(w, r, "Failed to read request body")
+			return
+		}
+
+		trashed, err := bannerRepo.FindTrashedBanner(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found in the trash")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find trashed banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find trashed banner")
+			return
+		}
+
+		version, err := expectedVersion(r, bannerID, versionOf(body))
+		if err == nil && version != trashed.Version {
+			err = errPreconditionFailed
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, trashed)
+			return
+		}
+
+		banner, err := bannerRepo.RestoreBanner(r.Context(), bannerID, version)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			// Restored or purged meanwhile.
+			response.NotFound(w, r, "Banner not found in the trash")
+			return
+		case errors.Is(err, repository.ErrVersionMismatch):
+			// Restored and deleted again meanwhile.
+			if current, err := bannerRepo.FindTrashedBanner(r.Context(), bannerID); err == nil {
+				trashed = current
+			}
+			responsePrecondition(w, r, errPreconditionFailed, trashed)
+			return
+		case errors.Is(err, repository.ErrExists):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict,
+				"A live banner has the same feature, targeting and one of the tags: "+err.Error())
+			return
+		case err != nil:
+			log.Error("Failed to restore banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to restore banner")
+			return
+		}
+
+		log.Info("Banner restored", slog.Int("banner_id", bannerID), slog.Int64("version", banner.Version))
+		invalidateCache(bannerCache, banner)
+		ResponseOK(w, r, banner)
+	}
+}
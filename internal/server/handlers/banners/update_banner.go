@@ -3,70 +3,257 @@ package banners
 import (
 	response "banner/internal/lib/api/responses"
 	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 )
 
+// Media types PATCH /banner/{id} accepts. With plain JSON the fields present
+// in the body replace the stored ones, content as a whole; with a merge patch
+// (RFC 7396) content keys are merged and null removes a key; a JSON Patch
+// (RFC 6902) is a list of operations such as {"op": "replace", "path":
+// "/content/title", "value": "Sale"}.
+const (
+	ContentTypeJSON       = "application/json"
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// RequestUpdateBanner is the part of a banner PATCH can change, as the JSON
+// document patches are applied to. All fields must survive the patch.
+// Version is the precondition sent with plain JSON and merge patch bodies;
+// it is not part of the document.
 type RequestUpdateBanner struct {
 	TagIDs    []int                  `json:"tag_ids" validate:"required"`
-	FeatureID int                    `json:"feature_id" validate:"required"`
+	FeatureID *int                   `json:"feature_id" validate:"required"`
 	Content   map[string]interface{} `json:"content" validate:"required"`
-	IsActive  bool                   `json:"is_active" validate:"required"`
+	IsActive  *bool                  `json:"is_active" validate:"required"`
+	Version   *int64                 `json:"version,omitempty"`
+
+	DefaultLocale string                            `json:"default_locale"`
+	Locales       map[string]map[string]interface{} `json:"locales"`
+	Platforms     []string                          `json:"platforms"`
+	AppVersion    string                            `json:"app_version"`
+	Rule          string                            `json:"rule"`
+	Template      *models.Template                  `json:"template"`
 }
 
+var errPatchConflict = errors.New("patch cannot be applied to the banner")
+
+// UpdateBanner applies the patch to the draft of the banner, started from the
+// published banner if there is none. Users keep seeing the published banner
+// until the draft is published.
 func UpdateBanner(bannerRepo Banners, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bannerID, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
 			logger.Error("Invalid banner ID", logerr.Err(err))
-			render.JSON(w, r, response.Error("Invalid banner ID"))
+			response.BadRequest(w, r, "Invalid banner ID")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("Failed to read request body", logerr.Err(err))
+			response.BadRequest(w, r, "Failed to read request body")
 			return
 		}
 
-		var req RequestUpdateBanner
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			render.Status(r, http.StatusBadRequest)
+		banner, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Banner not found")
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to find banner", logerr.Err(err))
+			response.Internal(w, r, "Failed to find banner")
+			return
+		}
+
+		expected, err := expectedVersion(r, bannerID, versionOf(body))
+		if err == nil && expected != banner.Version {
+			err = errPreconditionFailed
+		}
+		if err != nil {
+			responsePrecondition(w, r, err, banner)
+			return
+		}
+
+		draft := banner
+		if banner.HasDraft {
+			draft, err = bannerRepo.FindBannerDraft(r.Context(), bannerID)
+			if errors.Is(err, repository.ErrNoDraft) || errors.Is(err, repository.ErrNotFound) {
+				// The draft was published, discarded or deleted meanwhile.
+				responseConcurrentChange(w, r, logger, bannerRepo, bannerID)
+				return
+			}
+			if err != nil {
+				logger.Error("Failed to find banner draft", logerr.Err(err))
+				response.Internal(w, r, "Failed to find banner draft")
+				return
+			}
+			// The save must be based on the version checked above.
+			draft.Version = banner.Version
+		}
+
+		req, err := patchBanner(draft, r.Header.Get("Content-Type"), body)
+		if errors.Is(err, errPatchConflict) {
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, err.Error())
+			return
+		}
+		if err != nil {
 			logger.Error("Failed to parse request body", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to parse request body"))
+			response.BadRequest(w, r, err.Error())
 			return
 		}
 
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			logger.Error("Invalid request", logerr.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
-		banner, err := bannerRepo.FindBannerId(r.Context(), bannerID)
+		defaultLocale, locales, err := normalizeLocales(req.DefaultLocale, req.Locales)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		platforms, appVersion, err := normalizeTargeting(req.Platforms, req.AppVersion)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		targetingRule, err := normalizeRule(req.Rule)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+		template, err := normalizeTemplate(req.Template, req.Content, locales)
 		if err != nil {
-			render.Status(r, http.StatusNotFound)
-			logger.Error("Failed to find banner")
-			render.JSON(w, r, response.Error("Banner not found"))
+			response.BadRequest(w, r, err.Error())
 			return
 		}
 
-		banner.TagIDs = req.TagIDs
-		banner.FeatureID = req.FeatureID
-		banner.Content = req.Content
-		banner.IsActive = req.IsActive
-		banner.UpdatedAt = time.Now()
+		draft.TagIDs = req.TagIDs
+		draft.FeatureID = *req.FeatureID
+		draft.Content = req.Content
+		draft.DefaultLocale = defaultLocale
+		draft.Locales = locales
+		draft.Platforms = platforms
+		draft.AppVersion = appVersion
+		draft.Rule = targetingRule
+		draft.Template = template
+		draft.IsActive = *req.IsActive
+		draft.UpdatedAt = time.Now()
 
-		if err := bannerRepo.UpdateBanner(r.Context(), &banner); err != nil {
-			render.Status(r, http.StatusInternalServerError)
-			logger.Error("Failed to update banner", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to update banner"))
+		err = bannerRepo.SaveBannerDraft(r.Context(), &draft)
+		if errors.Is(err, repository.ErrVersionMismatch) || errors.Is(err, repository.ErrNotFound) {
+			// Someone else changed or deleted the banner after we read it.
+			responseConcurrentChange(w, r, logger, bannerRepo, bannerID)
 			return
 		}
+		if err != nil {
+			logger.Error("Failed to save banner draft", logerr.Err(err))
+			response.Internal(w, r, "Failed to save banner draft")
+			return
+		}
+
+		ResponseOK(w, r, draft)
+	}
+}
 
-		ResponseOK(w, r, banner)
+// patchBanner applies a PATCH body of the given media type to the banner and
+// returns the result. Unknown fields and wrong types are errors.
+func patchBanner(banner models.Banner, contentType string, body []byte) (RequestUpdateBanner, error) {
+	var req RequestUpdateBanner
+
+	tagIDs := banner.TagIDs
+	if tagIDs == nil {
+		tagIDs = []int{}
+	}
+	// An empty object rather than null lets JSON Patch add single locales.
+	locales := banner.Locales
+	if locales == nil {
+		locales = map[string]map[string]interface{}{}
 	}
+	platforms := banner.Platforms
+	if platforms == nil {
+		platforms = []string{}
+	}
+	// Version is left out, so a version in a merge patch body does not
+	// end up in the document.
+	doc, err := json.Marshal(RequestUpdateBanner{
+		TagIDs:        tagIDs,
+		FeatureID:     &banner.FeatureID,
+		Content:       banner.Content,
+		IsActive:      &banner.IsActive,
+		DefaultLocale: banner.DefaultLocale,
+		Locales:       locales,
+		Platforms:     platforms,
+		AppVersion:    banner.AppVersion,
+		Rule:          banner.Rule,
+		Template:      banner.Template,
+	})
+	if err != nil {
+		return req, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case ContentTypeMergePatch:
+		if doc, err = jsonpatch.MergePatch(doc, body); err != nil {
+			return req, fmt.Errorf("invalid merge patch: %w", err)
+		}
+	case ContentTypeJSONPatch:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return req, fmt.Errorf("invalid JSON patch: %w", err)
+		}
+		if doc, err = patch.Apply(doc); err != nil {
+			return req, fmt.Errorf("%w: %w", errPatchConflict, err)
+		}
+	default:
+		if doc, err = replaceFields(doc, body); err != nil {
+			return req, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid banner after patch: %w", err)
+	}
+
+	return req, nil
+}
+
+// replaceFields overwrites the top-level fields of doc with those of body.
+func replaceFields(doc, body []byte) ([]byte, error) {
+	var fields, patch map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	for name, value := range patch {
+		fields[name] = value
+	}
+
+	return json.Marshal(fields)
 }
@@ -1,17 +1,25 @@
 package banners
 
 import (
+	"banner/internal/lib/api/etag"
 	response "banner/internal/lib/api/responses"
 	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/lib/placeholder"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"banner/internal/repository/cache"
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
 )
 
 type RequestGetBanner struct {
@@ -20,12 +28,12 @@ type RequestGetBanner struct {
 	UseLastRevision bool `json:"use_last_revision"`
 }
 
-func GetBannerUser(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
+func GetBannerUser(log *slog.Logger, bannerRepo Banners, bannerCache *cache.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const loggerOptions = "handlers.banners.userBanner.New"
 		log := log.With(
 			slog.String("options", loggerOptions),
-			slog.String("request_id", chi.URLParam(r, "request_id")))
+			slog.String("request_id", middleware.GetReqID(r.Context())))
 
 		featureIDStr := r.URL.Query().Get("feature_id")
 		tagIDStr := r.URL.Query().Get("tag_id")
@@ -33,15 +41,13 @@ func GetBannerUser(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
 
 		featureID, err := strconv.Atoi(featureIDStr)
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.Error("Invalid feature_id"))
+			response.BadRequest(w, r, "Invalid feature_id")
 			return
 		}
 
 		tagID, err := strconv.Atoi(tagIDStr)
 		if err != nil {
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.Error("Invalid tag_id"))
+			response.BadRequest(w, r, "Invalid tag_id")
 			return
 		}
 
@@ -59,43 +65,123 @@ func GetBannerUser(log *slog.Logger, bannerRepo Banners) http.HandlerFunc {
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		preferred, err := preferredLanguages(r)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
+			return
+		}
+
+		target, err := requestTarget(r)
+		if err != nil {
+			response.BadRequest(w, r, err.Error())
 			return
 		}
 
 		if req.UseLastRevision {
-			banner, err := bannerRepo.FindBannerFeatureTag(r.Context(), req.FeatureID, req.TagID)
+			candidates, err := bannerRepo.FindBannersFeatureTag(r.Context(), req.FeatureID, req.TagID)
 			if err != nil {
-				log.Error("Failed to find banner", logerr.Err(err))
-				render.Status(r, http.StatusNotFound)
-				render.JSON(w, r, response.Error("Failed to find banner"))
+				// While the database is failing, the last known banner is
+				// better than no banner at all.
+				if stale, found := bannerCache.GetStale(req.FeatureID, req.TagID); found && !errors.Is(err, repository.ErrNotFound) {
+					log.Warn("Serving stale banner, database unavailable", logerr.Err(err))
+					responseGetOK(w, r, log, stale, target, preferred, cache.StatusStale, noCache)
+					return
+				}
+
+				responseFindError(w, r, log, err)
 				return
 			}
-			cache.StorageBannerInCache(req.FeatureID, req.TagID, *banner)
-			responseGetOK(w, r, *banner)
+			bannerCache.Set(req.FeatureID, req.TagID, candidates)
+			responseGetOK(w, r, log, candidates, target, preferred, cache.StatusMiss, noCache)
 		} else {
-			banner, found := cache.GetBannerFromCache(req.FeatureID, req.TagID)
-			if found {
-				log.Info("Banner found in CACHE")
-				responseGetOK(w, r, *banner)
-			} else {
-				banner, err := bannerRepo.FindBannerFeatureTag(r.Context(), req.FeatureID, req.TagID)
-				if err != nil {
-					log.Error("Failed to find banner", logerr.Err(err))
-					render.Status(r, http.StatusNotFound)
-					render.JSON(w, r, response.Error("Failed to find banner"))
-					return
-				}
+			// The fetch is shared with concurrent requests for the same key,
+			// so it must not be cancelled when this request goes away.
+			ctx := context.WithoutCancel(r.Context())
+			candidates, status, err := bannerCache.Load(req.FeatureID, req.TagID, func() ([]models.Banner, error) {
+				return bannerRepo.FindBannersFeatureTag(ctx, req.FeatureID, req.TagID)
+			})
+			if err != nil {
+				responseFindError(w, r, log, err)
+				return
+			}
 
-				cache.StorageBannerInCache(req.FeatureID, req.TagID, *banner)
-				responseGetOK(w, r, *banner)
+			cacheControl := noCache
+			if status != cache.StatusStale {
+				cacheControl = maxAge(bannerCache.FreshFor(req.FeatureID, req.TagID))
 			}
+			responseGetOK(w, r, log, candidates, target, preferred, status, cacheControl)
 		}
 
 	}
 }
 
-func responseGetOK(w http.ResponseWriter, r *http.Request, banner models.Banner) {
-	render.JSON(w, r, banner.Content)
+func responseFindError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Info("Banner not found")
+		response.NotFound(w, r, "Banner not found")
+		return
+	}
+
+	log.Error("Failed to find banner", logerr.Err(err))
+	response.Internal(w, r, "Failed to find banner")
+}
+
+// noCache makes clients revalidate every time, e.g. for use_last_revision.
+const noCache = "private, no-cache"
+
+// maxAge lets clients reuse a response for what is left of the server-side
+// TTL, so they never see content older than the staleness budget.
+func maxAge(fresh time.Duration) string {
+	return "private, max-age=" + strconv.Itoa(int(fresh.Seconds()))
+}
+
+// responseGetOK writes the content of the candidate banner that matches the
+// target in the preferred language, or 304 Not Modified if the client already
+// has this revision in that language. The cache holds all candidates with all
+// their variants, so the banner and language are chosen here and are part of
+// the ETag. Placeholders are filled from the target attributes, which are
+// part of the URL. The X-Cache-Status header tells whether the banner came
+// from the cache and whether it is stale.
+func responseGetOK(w http.ResponseWriter, r *http.Request, log *slog.Logger, candidates []models.Banner, target target, preferred []language.Tag, status cache.Status, cacheControl string) {
+	w.Header().Set("Vary", "Accept-Language, X-Platform, X-App-Version")
+	banner, found := selectBanner(candidates, target)
+	if !found {
+		responseFindError(w, r, log, repository.ErrNotFound)
+		return
+	}
+
+	content, locale := localize(banner, preferred)
+	if banner.Template != nil {
+		rendered, err := renderTemplate(banner, content, target.attributes)
+		var missing *placeholder.MissingVariablesError
+		switch {
+		case errors.As(err, &missing):
+			response.Error(w, r, http.StatusUnprocessableEntity, response.CodeMissingVariables,
+				"Banner needs attributes "+strings.Join(missing.Names, ", "))
+			return
+		case err != nil:
+			log.Error("Failed to render banner template", logerr.Err(err))
+			response.Internal(w, r, "Failed to render banner")
+			return
+		}
+		content = rendered
+	}
+	tag := etag.WithVariant(bannerETag(banner), locale)
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Cache-Status", string(status))
+	if locale != "" {
+		w.Header().Set("Content-Language", locale)
+	}
+
+	if etag.NoneMatch(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	render.JSON(w, r, content)
 }
@@ -0,0 +1,48 @@
+package features
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DeleteFeature deletes a feature no banner uses.
+func DeleteFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.features.deleteFeature.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid feature ID")
+			return
+		}
+
+		err = featureRepo.DeleteFeature(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Feature not found")
+			return
+		}
+		if errors.Is(err, repository.ErrInUse) {
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Feature is used by banners, remove it from them first")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to delete feature", logerr.Err(err))
+			response.Internal(w, r, "Failed to delete feature")
+			return
+		}
+
+		log.Info("Feature deleted")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -14,17 +14,28 @@ import (
 )
 
 type RequestFeature struct {
-	Name string `json:"name" validate:"required"`
+	Name             string `json:"name" validate:"required"`
+	RequiresApproval bool   `json:"requires_approval"`
 }
 
 type ResponseFeature struct {
 	response.Response
-	ID   int    `json:"feature_id"`
-	Name string `json:"name"`
+	ID               int    `json:"feature_id"`
+	Name             string `json:"name"`
+	RequiresApproval bool   `json:"requires_approval"`
 }
 
 type Features interface {
 	CreateFeature(ctx context.Context, feature *models.Feature) error
+	FindFeatures(ctx context.Context) ([]models.Feature, error)
+	FindFeatureId(ctx context.Context, id int) (models.Feature, error)
+	// UpdateFeature records a FeatureApprovalChange by changedBy if
+	// RequiresApproval changes.
+	UpdateFeature(ctx context.Context, feature *models.Feature, changedBy, comment string) error
+	FindFeatureApprovalChanges(ctx context.Context, id int) ([]models.FeatureApprovalChange, error)
+	// DeleteFeature fails with repository.ErrInUse if banners have the
+	// feature.
+	DeleteFeature(ctx context.Context, id int) error
 }
 
 func NewFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
@@ -38,8 +49,7 @@ func NewFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("Failed to decode request body", logerr.Err(err))
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.Error("Failed to decode request"))
+			response.BadRequest(w, r, "Failed to decode request")
 			return
 		}
 
@@ -47,26 +57,25 @@ func NewFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
-		feature := models.Feature{Name: req.Name}
+		feature := models.Feature{Name: req.Name, RequiresApproval: req.RequiresApproval}
 		err = featureRepo.CreateFeature(r.Context(), &feature)
 		if err != nil {
 			log.Error("Failed to create feature", logerr.Err(err))
-			render.Status(r, http.StatusBadRequest)
-			render.JSON(w, r, response.Error("Failed to create feature"))
+			response.Internal(w, r, "Failed to create feature")
 			return
 		}
 
 		log.Info("Feature added")
-		ResponseOK(w, r, req.Name, feature.ID)
+		render.Status(r, http.StatusCreated)
+		ResponseOK(w, r, feature)
 	}
 }
 
-func ResponseOK(w http.ResponseWriter, r *http.Request, name string, feature_id int) {
+func ResponseOK(w http.ResponseWriter, r *http.Request, feature models.Feature) {
 	render.JSON(w, r, ResponseFeature{Response: response.OK(),
-		Name: name, ID: feature_id})
+		Name: feature.Name, ID: feature.ID, RequiresApproval: feature.RequiresApproval})
 }
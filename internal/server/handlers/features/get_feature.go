@@ -0,0 +1,58 @@
+package features
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type ResponseFeatures struct {
+	Items []models.Feature `json:"items"`
+}
+
+func ListFeatures(log *slog.Logger, featureRepo Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		features, err := featureRepo.FindFeatures(r.Context())
+		if err != nil {
+			log.Error("Failed to find features", logerr.Err(err))
+			response.Internal(w, r, "Failed to find features")
+			return
+		}
+
+		if features == nil {
+			features = []models.Feature{}
+		}
+		render.JSON(w, r, ResponseFeatures{Items: features})
+	}
+}
+
+func GetFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid feature ID")
+			return
+		}
+
+		feature, err := featureRepo.FindFeatureId(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Feature not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find feature", logerr.Err(err))
+			response.Internal(w, r, "Failed to find feature")
+			return
+		}
+
+		ResponseOK(w, r, feature)
+	}
+}
@@ -0,0 +1,123 @@
+package features
+
+import (
+	"banner/internal/lib/api/middlewares"
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+// RequestUpdateFeature holds the fields PATCH /features/{id} changes; the
+// missing ones are kept. Comment is recorded with a change of
+// requires_approval.
+type RequestUpdateFeature struct {
+	Name             *string `json:"name" validate:"omitempty,min=1"`
+	RequiresApproval *bool   `json:"requires_approval"`
+	Comment          string  `json:"comment"`
+}
+
+type ResponseFeatureApprovalChanges struct {
+	Items []models.FeatureApprovalChange `json:"items"`
+}
+
+// UpdateFeature renames a feature or turns approval of its banner changes on
+// or off. Who changed the approval, and when, is kept in the feature's
+// approval changes.
+func UpdateFeature(log *slog.Logger, featureRepo Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.features.updateFeature.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid feature ID")
+			return
+		}
+
+		var req RequestUpdateFeature
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("Failed to decode request body", logerr.Err(err))
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("Invalid request", logerr.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+		if req.Name == nil && req.RequiresApproval == nil {
+			response.BadRequest(w, r, "Nothing to update: name or requires_approval is required")
+			return
+		}
+
+		feature, err := featureRepo.FindFeatureId(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Feature not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find feature", logerr.Err(err))
+			response.Internal(w, r, "Failed to find feature")
+			return
+		}
+
+		if req.Name != nil {
+			feature.Name = *req.Name
+		}
+		if req.RequiresApproval != nil {
+			feature.RequiresApproval = *req.RequiresApproval
+		}
+
+		username := middlewares.Username(r.Context())
+		err = featureRepo.UpdateFeature(r.Context(), &feature, username, req.Comment)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Feature not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to update feature", logerr.Err(err))
+			response.Internal(w, r, "Failed to update feature")
+			return
+		}
+
+		log.Info("Feature updated", slog.Bool("requires_approval", feature.RequiresApproval), slog.String("username", username))
+		ResponseOK(w, r, feature)
+	}
+}
+
+// ListFeatureApprovalChanges returns who turned approval of the feature on
+// or off, newest first. The changes are kept after the feature is deleted.
+func ListFeatureApprovalChanges(log *slog.Logger, featureRepo Features) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid feature ID")
+			return
+		}
+
+		changes, err := featureRepo.FindFeatureApprovalChanges(r.Context(), id)
+		if err != nil {
+			log.Error("Failed to find feature approval changes", logerr.Err(err))
+			response.Internal(w, r, "Failed to find feature approval changes")
+			return
+		}
+
+		if changes == nil {
+			changes = []models.FeatureApprovalChange{}
+		}
+		render.JSON(w, r, ResponseFeatureApprovalChanges{Items: changes})
+	}
+}
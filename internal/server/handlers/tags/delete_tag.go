@@ -0,0 +1,48 @@
+package tags
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DeleteTag deletes a tag no banner uses.
+func DeleteTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.tags.deleteTag.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid tag ID")
+			return
+		}
+
+		err = tagRepo.DeleteTag(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Tag not found")
+			return
+		}
+		if errors.Is(err, repository.ErrInUse) {
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "Tag is used by banners, remove it from them first")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to delete tag", logerr.Err(err))
+			response.Internal(w, r, "Failed to delete tag")
+			return
+		}
+
+		log.Info("Tag deleted")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
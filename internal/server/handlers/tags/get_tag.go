@@ -0,0 +1,58 @@
+package tags
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type ResponseTags struct {
+	Items []models.Tag `json:"items"`
+}
+
+func ListTags(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := tagRepo.FindTags(r.Context())
+		if err != nil {
+			log.Error("Failed to find tags", logerr.Err(err))
+			response.Internal(w, r, "Failed to find tags")
+			return
+		}
+
+		if tags == nil {
+			tags = []models.Tag{}
+		}
+		render.JSON(w, r, ResponseTags{Items: tags})
+	}
+}
+
+func GetTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid tag ID")
+			return
+		}
+
+		tag, err := tagRepo.FindTagId(r.Context(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Tag not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to find tag", logerr.Err(err))
+			response.Internal(w, r, "Failed to find tag")
+			return
+		}
+
+		ResponseOK(w, r, tag.Name, tag.ID)
+	}
+}
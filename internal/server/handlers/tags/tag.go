@@ -24,6 +24,11 @@ type ResponseTag struct {
 
 type Tag interface {
 	CreateTag(ctx context.Context, tag *models.Tag) error
+	FindTags(ctx context.Context) ([]models.Tag, error)
+	FindTagId(ctx context.Context, id int) (models.Tag, error)
+	UpdateTag(ctx context.Context, tag *models.Tag) error
+	// DeleteTag fails with repository.ErrInUse if banners have the tag.
+	DeleteTag(ctx context.Context, id int) error
 }
 
 func NewTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
@@ -37,7 +42,7 @@ func NewTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("Failed to decode request body", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to decode request"))
+			response.BadRequest(w, r, "Failed to decode request")
 			return
 		}
 
@@ -45,7 +50,7 @@ func NewTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
@@ -53,11 +58,12 @@ func NewTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
 		err = tagRepo.CreateTag(r.Context(), &tag)
 		if err != nil {
 			log.Error("Failed to create tag", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to create tag"))
+			response.Internal(w, r, "Failed to create tag")
 			return
 		}
 
 		log.Info("Tag added")
+		render.Status(r, http.StatusCreated)
 		ResponseOK(w, r, req.Name, tag.ID)
 	}
 }
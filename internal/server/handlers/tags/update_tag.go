@@ -0,0 +1,61 @@
+package tags
+
+import (
+	response "banner/internal/lib/api/responses"
+	logerr "banner/internal/lib/logger/logerr"
+	"banner/internal/models"
+	"banner/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+// UpdateTag renames a tag.
+func UpdateTag(log *slog.Logger, tagRepo Tag) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const loggerOptions = "handlers.tags.updateTag.New"
+		log := log.With(
+			slog.String("options", loggerOptions),
+			slog.String("request_id", middleware.GetReqID(r.Context())))
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			response.BadRequest(w, r, "Invalid tag ID")
+			return
+		}
+
+		var req RequestTag
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("Failed to decode request body", logerr.Err(err))
+			response.BadRequest(w, r, "Failed to decode request")
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("Invalid request", logerr.Err(err))
+			response.ValidationError(w, r, validateErr)
+			return
+		}
+
+		tag := models.Tag{ID: id, Name: req.Name}
+		err = tagRepo.UpdateTag(r.Context(), &tag)
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(w, r, "Tag not found")
+			return
+		}
+		if err != nil {
+			log.Error("Failed to update tag", logerr.Err(err))
+			response.Internal(w, r, "Failed to update tag")
+			return
+		}
+
+		log.Info("Tag updated")
+		ResponseOK(w, r, tag.Name, tag.ID)
+	}
+}
@@ -34,7 +34,7 @@ func Login(log *slog.Logger, userRepo user.User, jwt *jwt.JWTSecret) http.Handle
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("Failed to decode request body", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to decode request"))
+			response.BadRequest(w, r, "Failed to decode request")
 			return
 		}
 
@@ -42,25 +42,33 @@ func Login(log *slog.Logger, userRepo user.User, jwt *jwt.JWTSecret) http.Handle
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
+		// The same answer for an unknown user and a wrong password does not
+		// reveal which usernames exist.
 		user, err := userRepo.FindUserUsername(r.Context(), req.Username)
 		if err != nil {
 			log.Error("User not found with login")
-			render.JSON(w, r, response.Error("Invalid username"))
+			response.Error(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid username or password")
 			return
 		}
 
 		errAuth := password.ComparePasswordHash(req.Password, user.Password)
 		if errAuth != nil {
 			log.Error("Invalid password")
-			render.JSON(w, r, response.Error("Invalid password"))
+			response.Error(w, r, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid username or password")
 			return
 		}
 
 		token, err := jwt.GenerateToken(user.Username, user.Role, time.Second*600)
+		if err != nil {
+			log.Error("Failed to generate token", logerr.Err(err))
+			response.Internal(w, r, "Failed to generate token")
+			return
+		}
+
 		log.Info("User authenticated")
 		ResponseAuthOK(w, r, req.Username, user.ID, user.Role, token)
 	}
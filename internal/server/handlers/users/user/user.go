@@ -5,7 +5,9 @@ import (
 	password "banner/internal/lib/auth/password"
 	logerr "banner/internal/lib/logger/logerr"
 	"banner/internal/models"
+	"banner/internal/repository"
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 
@@ -42,7 +44,7 @@ func NewUser(log *slog.Logger, u User) http.HandlerFunc {
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("Failed to decode request body", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to decode request"))
+			response.BadRequest(w, r, "Failed to decode request")
 			return
 		}
 
@@ -50,20 +52,31 @@ func NewUser(log *slog.Logger, u User) http.HandlerFunc {
 		if err := validator.New().Struct(req); err != nil {
 			validateErr := err.(validator.ValidationErrors)
 			log.Error("Invalid request", logerr.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.ValidationError(w, r, validateErr)
 			return
 		}
 
 		hashPass, err := password.HashPassword(req.Password)
+		if err != nil {
+			log.Error("Failed to hash password", logerr.Err(err))
+			response.Internal(w, r, "Failed to create user")
+			return
+		}
+
 		user := models.User{Username: req.Username, Password: hashPass, Role: "user"}
 		err = u.CreateUser(r.Context(), &user)
+		if errors.Is(err, repository.ErrExists) {
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, "User with this name already exists")
+			return
+		}
 		if err != nil {
 			log.Error("Failed to create user", logerr.Err(err))
-			render.JSON(w, r, response.Error("Failed to create user"))
+			response.Internal(w, r, "Failed to create user")
 			return
 		}
 
 		log.Info("User added")
+		render.Status(r, http.StatusCreated)
 		ResponseOK(w, r, req.Username, user.ID, user.Role)
 	}
 }
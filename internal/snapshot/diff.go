@@ -0,0 +1,134 @@
+package snapshot
+
+import (
+	"banner/internal/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TableDiff lists the keys of rows an import adds, changes and removes.
+type TableDiff struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+func (t TableDiff) Empty() bool {
+	return len(t.Added)+len(t.Changed)+len(t.Removed) == 0
+}
+
+// Diff is what importing a snapshot changes in the database.
+type Diff struct {
+	Features   TableDiff
+	Tags       TableDiff
+	Banners    TableDiff
+	BannerTags TableDiff
+	Drafts     TableDiff
+}
+
+// Compare returns the changes that turn current into target.
+func Compare(current, target *Snapshot) Diff {
+	featureKey := func(f models.Feature) string { return strconv.Itoa(f.ID) }
+	tagKey := func(t models.Tag) string { return strconv.Itoa(t.ID) }
+	bannerKey := func(b Banner) string { return strconv.Itoa(b.ID) }
+	bannerTagKey := func(bt models.BannerTag) string { return fmt.Sprintf("%d/%d", bt.BannerID, bt.TagID) }
+	draftKey := func(d Draft) string { return strconv.Itoa(d.BannerID) }
+
+	return Diff{
+		Features:   compareTable(current.Features, target.Features, featureKey),
+		Tags:       compareTable(current.Tags, target.Tags, tagKey),
+		Banners:    compareTable(current.Banners, target.Banners, bannerKey),
+		BannerTags: compareTable(current.BannerTags, target.BannerTags, bannerTagKey),
+		Drafts:     compareTable(current.Drafts, target.Drafts, draftKey),
+	}
+}
+
+func (d Diff) Empty() bool {
+	return d.Features.Empty() && d.Tags.Empty() && d.Banners.Empty() && d.BannerTags.Empty() && d.Drafts.Empty()
+}
+
+// Print writes a summary per table followed by the keys of changed rows.
+// Banner tags are keyed as banner_id/tag_id and drafts by banner_id; drafts
+// missing from the target, as in version 1 archives, are listed as removed.
+func (d Diff) Print(w io.Writer) {
+	tables := []struct {
+		name string
+		diff TableDiff
+	}{
+		{"features", d.Features},
+		{"tags", d.Tags},
+		{"banners", d.Banners},
+		{"banner_tags", d.BannerTags},
+		{"banner_drafts", d.Drafts},
+	}
+
+	for _, table := range tables {
+		fmt.Fprintf(w, "%-15s +%d ~%d -%d\n", table.name+":", len(table.diff.Added), len(table.diff.Changed), len(table.diff.Removed))
+		for _, keys := range []struct {
+			label string
+			keys  []string
+		}{{"added", table.diff.Added}, {"changed", table.diff.Changed}, {"removed", table.diff.Removed}} {
+			if len(keys.keys) > 0 {
+				fmt.Fprintf(w, "  %s: %s\n", keys.label, strings.Join(keys.keys, ", "))
+			}
+		}
+	}
+}
+
+// compareTable matches rows by key. Rows with the same key are compared by
+// their JSON encoding, which is how they are stored in the archive.
+func compareTable[T any](current, target []T, key func(T) string) TableDiff {
+	currentRows := make(map[string]T, len(current))
+	for _, row := range current {
+		currentRows[key(row)] = row
+	}
+
+	var diff TableDiff
+	for _, row := range target {
+		k := key(row)
+		old, found := currentRows[k]
+		switch {
+		case !found:
+			diff.Added = append(diff.Added, k)
+		case !sameJSON(old, row):
+			diff.Changed = append(diff.Changed, k)
+		}
+		delete(currentRows, k)
+	}
+	for k := range currentRows {
+		diff.Removed = append(diff.Removed, k)
+	}
+
+	sortKeys(diff.Added)
+	sortKeys(diff.Changed)
+	sortKeys(diff.Removed)
+
+	return diff
+}
+
+func sameJSON(a, b any) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// sortKeys orders keys numerically by each /-separated part.
+func sortKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := strings.Split(keys[i], "/"), strings.Split(keys[j], "/")
+		for n := 0; n < len(a) && n < len(b); n++ {
+			x, _ := strconv.Atoi(a[n])
+			y, _ := strconv.Atoi(b[n])
+			if x != y {
+				return x < y
+			}
+		}
+		return len(a) < len(b)
+	})
+}
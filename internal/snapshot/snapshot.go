@@ -0,0 +1,114 @@
+// Package snapshot is the archive format of `banner snapshot`: every
+// feature, tag, banner, banner tag and banner draft with their IDs, as
+// gzipped JSON.
+package snapshot
+
+import (
+	"banner/internal/models"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Format identifies snapshot archives.
+	Format = "banner-snapshot"
+	// Version is the archive layout written by Write. Read accepts this and
+	// older versions. Version 1 archives have no drafts.
+	Version = 2
+)
+
+// Banner is a stored banner row; its tags are in Snapshot.BannerTags.
+// Banners in the trash have DeletedAt set.
+type Banner struct {
+	ID        int                    `json:"id"`
+	FeatureID int                    `json:"feature_id"`
+	Content   map[string]interface{} `json:"content"`
+	IsActive  bool                   `json:"is_active"`
+	Version   int64                  `json:"version"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	DeletedAt *time.Time             `json:"deleted_at,omitempty"`
+	// DefaultLocale and Locales are the localized content, Platforms,
+	// AppVersion and Rule the targeting, and Template the placeholder
+	// settings, as in models.Banner.
+	DefaultLocale string                            `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]interface{} `json:"locales,omitempty"`
+	Platforms     []string                          `json:"platforms,omitempty"`
+	AppVersion    string                            `json:"app_version,omitempty"`
+	Rule          string                            `json:"rule,omitempty"`
+	Template      *models.Template                  `json:"template,omitempty"`
+}
+
+// Draft is the unpublished change of banner BannerID, with its tags, as in
+// models.Banner.
+type Draft struct {
+	BannerID      int                               `json:"banner_id"`
+	FeatureID     int                               `json:"feature_id"`
+	TagIDs        []int                             `json:"tag_ids"`
+	Content       map[string]interface{}            `json:"content"`
+	IsActive      bool                              `json:"is_active"`
+	UpdatedAt     time.Time                         `json:"updated_at"`
+	DefaultLocale string                            `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]interface{} `json:"locales,omitempty"`
+	Platforms     []string                          `json:"platforms,omitempty"`
+	AppVersion    string                            `json:"app_version,omitempty"`
+	Rule          string                            `json:"rule,omitempty"`
+	Template      *models.Template                  `json:"template,omitempty"`
+}
+
+// Snapshot holds the banner configuration tables ordered by key. Users,
+// change requests and idempotency keys are not part of it.
+type Snapshot struct {
+	Format     string             `json:"format"`
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Features   []models.Feature   `json:"features"`
+	Tags       []models.Tag       `json:"tags"`
+	Banners    []Banner           `json:"banners"`
+	BannerTags []models.BannerTag `json:"banner_tags"`
+	Drafts     []Draft            `json:"banner_drafts,omitempty"`
+}
+
+// Write writes the snapshot as a gzipped JSON archive of the current
+// version.
+func Write(w io.Writer, snap *Snapshot) error {
+	snap.Format = Format
+	snap.Version = Version
+
+	zw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(zw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snap); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads an archive written by Write and checks its format and version.
+func Read(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot archive: %w", err)
+	}
+	defer zr.Close()
+
+	var snap Snapshot
+	if err := json.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if snap.Format != Format {
+		return nil, fmt.Errorf("not a snapshot archive: format is %q", snap.Format)
+	}
+	if snap.Version < 1 || snap.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is not supported, this build reads up to %d", snap.Version, Version)
+	}
+
+	return &snap, nil
+}
@@ -0,0 +1,132 @@
+package snapshot
+
+import (
+	"banner/internal/models"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSnapshot() *Snapshot {
+	created := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	return &Snapshot{
+		CreatedAt: created,
+		Features:  []models.Feature{{ID: 1, Name: "onboarding"}, {ID: 4, Name: "promo"}},
+		Tags:      []models.Tag{{ID: 2, Name: "new-users"}},
+		Banners: []Banner{
+			{ID: 7, FeatureID: 1, Content: map[string]interface{}{"title": "Hi", "priority": 2.0}, IsActive: true, Version: 3, CreatedAt: created, UpdatedAt: created,
+				DefaultLocale: "en", Locales: map[string]map[string]interface{}{"de": {"title": "Hallo"}}},
+			{ID: 9, FeatureID: 4, Content: map[string]interface{}{}, Version: 1, CreatedAt: created, UpdatedAt: created, DeletedAt: &created,
+				Platforms: []string{"android", "ios"}, AppVersion: ">=7.2", Rule: `country == "KZ"`,
+				Template: &models.Template{Variables: []string{"name"}, OnMissing: "keep"}},
+		},
+		BannerTags: []models.BannerTag{{BannerID: 7, TagID: 2}},
+		Drafts: []Draft{
+			{BannerID: 7, FeatureID: 4, TagIDs: []int{2}, Content: map[string]interface{}{"title": "Draft"}, UpdatedAt: created, Rule: `country == "KZ"`},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testSnapshot()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := testSnapshot()
+	want.Format, want.Version = Format, Version
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadRejects(t *testing.T) {
+	tests := []struct {
+		name, json, err string
+	}{
+		{"other format", `{"format": "other", "version": 1}`, "not a snapshot archive"},
+		{"newer version", `{"format": "banner-snapshot", "version": 99}`, "version 99 is not supported"},
+		{"no version", `{"format": "banner-snapshot"}`, "version 0 is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(tt.json))
+			zw.Close()
+
+			_, err := Read(&buf)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Read() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := Read(strings.NewReader(`{"format": "banner-snapshot"}`)); err == nil {
+		t.Error("Read() of plain JSON succeeded, want error")
+	}
+}
+
+func TestReadVersion1(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"format": "banner-snapshot", "version": 1, "features": [{"id": 1, "name": "onboarding"}], "tags": [], "banners": [], "banner_tags": []}`))
+	zw.Close()
+
+	snap, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if snap.Version != 1 || len(snap.Features) != 1 || snap.Drafts != nil {
+		t.Errorf("Read() = %+v", snap)
+	}
+
+	// Importing it drops the drafts of the database, which the diff shows.
+	diff := Compare(testSnapshot(), snap)
+	if diff.Empty() || !reflect.DeepEqual(diff.Drafts, TableDiff{Removed: []string{"7"}}) {
+		t.Errorf("Compare().Drafts = %+v, want draft 7 removed", diff.Drafts)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	current := testSnapshot()
+	target := testSnapshot()
+
+	if diff := Compare(current, target); !diff.Empty() {
+		t.Fatalf("Compare() of equal snapshots = %+v, want empty", diff)
+	}
+
+	target.Features = target.Features[:1]
+	target.Tags = append(target.Tags, models.Tag{ID: 10, Name: "vip"}, models.Tag{ID: 3, Name: "old"})
+	target.Banners[0].Content["title"] = "Hello"
+	target.BannerTags = []models.BannerTag{{BannerID: 7, TagID: 10}, {BannerID: 7, TagID: 3}}
+	target.Drafts = nil
+
+	diff := Compare(current, target)
+	want := Diff{
+		Features:   TableDiff{Removed: []string{"4"}},
+		Tags:       TableDiff{Added: []string{"3", "10"}},
+		Banners:    TableDiff{Changed: []string{"7"}},
+		BannerTags: TableDiff{Added: []string{"7/3", "7/10"}, Removed: []string{"7/2"}},
+		Drafts:     TableDiff{Removed: []string{"7"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Compare() = %+v, want %+v", diff, want)
+	}
+
+	var out bytes.Buffer
+	diff.Print(&out)
+	if !strings.Contains(out.String(), "banner_tags:    +2 ~0 -1\n  added: 7/3, 7/10\n  removed: 7/2\nbanner_drafts:  +0 ~0 -1\n  removed: 7\n") {
+		t.Errorf("Print() =\n%s", out.String())
+	}
+}
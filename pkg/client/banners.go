@@ -0,0 +1,567 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Banner struct {
+	ID        int            `json:"banner_id"`
+	TagIDs    []int          `json:"tag_ids"`
+	FeatureID int            `json:"feature_id"`
+	Content   map[string]any `json:"content"`
+	IsActive  bool           `json:"is_active"`
+	// Version grows with every change, of the draft too. Updates,
+	// publishes and deletes must send the version they are based on.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// HasDraft tells whether the banner has unpublished changes.
+	HasDraft bool `json:"has_draft"`
+	// DeletedAt is set on banners in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// DefaultLocale is the language of Content; Locales holds the content
+	// in other languages by BCP 47 tag.
+	DefaultLocale string                    `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]any `json:"locales,omitempty"`
+	// Platforms and AppVersion, a semver range such as ">=7.2 <8",
+	// restrict the banner to users of these platforms and app versions.
+	// Empty means everyone.
+	Platforms  []string `json:"platforms,omitempty"`
+	AppVersion string   `json:"app_version,omitempty"`
+	// Rule is a targeting expression over user attributes, such as
+	// `country == "KZ" and days_since_signup > 7`. Empty means everyone.
+	Rule string `json:"rule,omitempty"`
+	// Template turns on placeholders such as {{ name }} in the content.
+	Template *BannerTemplate `json:"template,omitempty"`
+}
+
+// BannerTemplate are the placeholder settings of a banner. Placeholders are
+// filled from the user attributes given to TargetedUserBanner.
+type BannerTemplate struct {
+	// Variables are the attributes placeholders may use.
+	Variables []string `json:"variables"`
+	// Escape is html (the default), url or none.
+	Escape string `json:"escape,omitempty"`
+	// OnMissing is what a placeholder without a value or a default turns
+	// into: empty (the default), keep or an error (422) with "error".
+	OnMissing string `json:"on_missing,omitempty"`
+}
+
+type NewBanner struct {
+	TagIDs    []int          `json:"tag_ids"`
+	FeatureID int            `json:"feature_id"`
+	Content   map[string]any `json:"content"`
+	IsActive  bool           `json:"is_active"`
+
+	DefaultLocale string                    `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]any `json:"locales,omitempty"`
+	Platforms     []string                  `json:"platforms,omitempty"`
+	AppVersion    string                    `json:"app_version,omitempty"`
+	Rule          string                    `json:"rule,omitempty"`
+	Template      *BannerTemplate           `json:"template,omitempty"`
+}
+
+// BannerPatch changes the fields that are set; Content and Locales replace
+// the stored ones as a whole.
+type BannerPatch struct {
+	TagIDs    []int          `json:"tag_ids,omitempty"`
+	FeatureID *int           `json:"feature_id,omitempty"`
+	Content   map[string]any `json:"content,omitempty"`
+	IsActive  *bool          `json:"is_active,omitempty"`
+
+	DefaultLocale *string                   `json:"default_locale,omitempty"`
+	Locales       map[string]map[string]any `json:"locales,omitempty"`
+	// Platforms, AppVersion and Rule set to empty values target everyone.
+	Platforms  *[]string `json:"platforms,omitempty"`
+	AppVersion *string   `json:"app_version,omitempty"`
+	Rule       *string   `json:"rule,omitempty"`
+	// Template replaces the placeholder settings; RemoveTemplate turns
+	// placeholders off.
+	Template       *BannerTemplate `json:"-"`
+	RemoveTemplate bool            `json:"-"`
+}
+
+// Sort orders and directions of ListOptions.
+const (
+	SortID        = "id"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	OrderAsc      = "asc"
+	OrderDesc     = "desc"
+)
+
+// ListOptions filters and pages banner lists. Zero fields do not filter.
+// Pass BannerPage.NextCursor as Cursor, with the same Sort and Order, for
+// the next page.
+type ListOptions struct {
+	FeatureIDs    []int
+	TagIDs        []int
+	IsActive      *bool
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Sort          string
+	Order         string
+	Limit         int
+	Cursor        string
+	IncludeTotal  bool
+}
+
+// SearchOptions is a banner search: Query is full-text search over the
+// content strings and Path a JSONPath predicate over the content. At least
+// one of them is required.
+type SearchOptions struct {
+	Query string
+	Path  string
+	ListOptions
+}
+
+type BannerPage struct {
+	Items      []Banner `json:"items"`
+	NextCursor string   `json:"next_cursor"`
+	// Total is set if IncludeTotal was requested.
+	Total *int `json:"total"`
+}
+
+func (o ListOptions) values() url.Values {
+	q := url.Values{}
+	for _, id := range o.FeatureIDs {
+		q.Add("feature_id", strconv.Itoa(id))
+	}
+	for _, id := range o.TagIDs {
+		q.Add("tag_id", strconv.Itoa(id))
+	}
+	if o.IsActive != nil {
+		q.Set("is_active", strconv.FormatBool(*o.IsActive))
+	}
+	for name, t := range map[string]time.Time{
+		"created_after":  o.CreatedAfter,
+		"created_before": o.CreatedBefore,
+		"updated_after":  o.UpdatedAfter,
+		"updated_before": o.UpdatedBefore,
+	} {
+		if !t.IsZero() {
+			q.Set(name, t.Format(time.RFC3339Nano))
+		}
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Order != "" {
+		q.Set("order", o.Order)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.IncludeTotal {
+		q.Set("include_total", "true")
+	}
+
+	return q
+}
+
+func (c *Client) ListBanners(ctx context.Context, opts ListOptions) (*BannerPage, error) {
+	var page BannerPage
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/banner", query: opts.values()}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+func (c *Client) SearchBanners(ctx context.Context, opts SearchOptions) (*BannerPage, error) {
+	q := opts.ListOptions.values()
+	if opts.Query != "" {
+		q.Set("q", opts.Query)
+	}
+	if opts.Path != "" {
+		q.Set("path", opts.Path)
+	}
+
+	var page BannerPage
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/banner/search", query: q}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+func (c *Client) GetBanner(ctx context.Context, id int) (*Banner, error) {
+	var banner Banner
+	_, err := c.do(ctx, request{method: http.MethodGet, path: bannerPath(id)}, &banner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &banner, nil
+}
+
+// CreateBanner creates a banner. If a banner of the feature with the same
+// targeting already has one of its tags, the error is a 409.
+func (c *Client) CreateBanner(ctx context.Context, banner NewBanner) (*Banner, error) {
+	if banner.TagIDs == nil {
+		banner.TagIDs = []int{}
+	}
+
+	var created Banner
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/banner", body: banner}, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// UpdateBanner applies the patch to the draft of the banner if the banner is
+// still at version, and returns the draft. Otherwise the error is a 412
+// *Error with the CurrentVersion. Users see the change once the draft is
+// published with PublishBanner.
+func (c *Client) UpdateBanner(ctx context.Context, id int, version int64, patch BannerPatch) (*Banner, error) {
+	body := struct {
+		BannerPatch
+		Template json.RawMessage `json:"template,omitempty"`
+		Version  int64           `json:"version"`
+	}{BannerPatch: patch, Version: version}
+	switch {
+	case patch.RemoveTemplate:
+		body.Template = json.RawMessage("null")
+	case patch.Template != nil:
+		data, err := json.Marshal(patch.Template)
+		if err != nil {
+			return nil, err
+		}
+		body.Template = data
+	}
+
+	var updated Banner
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: bannerPath(id), body: body}, &updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// GetBannerDraft returns the banner as its draft would publish it; the error
+// is a 404 if there is no draft.
+func (c *Client) GetBannerDraft(ctx context.Context, id int) (*Banner, error) {
+	var draft Banner
+	_, err := c.do(ctx, request{method: http.MethodGet, path: bannerPath(id) + "/draft"}, &draft)
+	if err != nil {
+		return nil, err
+	}
+
+	return &draft, nil
+}
+
+// PublishBanner replaces the banner users see with its draft if the banner
+// is still at version, and returns the published banner. If the feature
+// requires approval, the error has Code CodeApprovalRequired and the draft
+// is published with CreateChangeRequest instead.
+func (c *Client) PublishBanner(ctx context.Context, id int, version int64) (*Banner, error) {
+	body := map[string]int64{"version": version}
+
+	var published Banner
+	_, err := c.do(ctx, request{method: http.MethodPost, path: bannerPath(id) + "/publish", body: body}, &published)
+	if err != nil {
+		return nil, err
+	}
+
+	return &published, nil
+}
+
+// DiscardBannerDraft deletes the draft if the banner is still at version.
+func (c *Client) DiscardBannerDraft(ctx context.Context, id int, version int64) error {
+	body := map[string]int64{"version": version}
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: bannerPath(id) + "/draft", body: body}, nil)
+
+	return err
+}
+
+// DeleteBanner moves the banner to the trash if it is still at version.
+func (c *Client) DeleteBanner(ctx context.Context, id int, version int64) error {
+	body := map[string]int64{"version": version}
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: bannerPath(id), body: body}, nil)
+
+	return err
+}
+
+// ListTrash returns up to limit deleted banners that have not been purged,
+// most recently deleted first. A zero limit is the server default.
+func (c *Client) ListTrash(ctx context.Context, limit int) ([]Banner, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var page BannerPage
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/banner/trash", query: q}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Items, nil
+}
+
+// RestoreBanner takes the banner out of the trash if it is still at the
+// version the trash shows, and returns it. If a live banner of its feature
+// with the same targeting has one of its tags, the error is a 409.
+func (c *Client) RestoreBanner(ctx context.Context, id int, version int64) (*Banner, error) {
+	body := map[string]int64{"version": version}
+
+	var restored Banner
+	_, err := c.do(ctx, request{method: http.MethodPost, path: bannerPath(id) + "/restore", body: body}, &restored)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restored, nil
+}
+
+// Clone statuses of CloneResult.
+const (
+	CloneCreated  = "created"
+	CloneConflict = "conflict"
+	CloneInvalid  = "invalid"
+	CloneFailed   = "failed"
+)
+
+// CloneOptions lists where CloneBanner copies a banner: to every feature of
+// FeatureIDs with every tag set of TagSets. Without FeatureIDs the clones
+// keep the feature of the banner, without TagSets its tags.
+type CloneOptions struct {
+	FeatureIDs []int   `json:"feature_ids,omitempty"`
+	TagSets    [][]int `json:"tag_sets,omitempty"`
+	// Disabled creates the clones inactive.
+	Disabled bool `json:"disabled"`
+}
+
+type CloneReport struct {
+	Created   int           `json:"created"`
+	Conflicts int           `json:"conflicts"`
+	Invalid   int           `json:"invalid"`
+	Failed    int           `json:"failed"`
+	Results   []CloneResult `json:"results"`
+}
+
+type CloneResult struct {
+	FeatureID int    `json:"feature_id"`
+	TagIDs    []int  `json:"tag_ids"`
+	Status    string `json:"status"`
+	BannerID  int    `json:"banner_id"`
+	// ConflictingBannerID is the banner of the feature that already has
+	// one of the tags.
+	ConflictingBannerID int    `json:"conflicting_banner_id"`
+	Error               string `json:"error"`
+}
+
+// CloneBanner copies the published content and settings of the banner to
+// other features and tag sets. Targets that conflict with an existing banner
+// are reported, not created; the others are.
+func (c *Client) CloneBanner(ctx context.Context, id int, opts CloneOptions) (*CloneReport, error) {
+	var report CloneReport
+	_, err := c.do(ctx, request{method: http.MethodPost, path: bannerPath(id) + "/clone", body: opts}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// UserBanner returns the content of the banner users with the tag see for
+// the feature, on the platform and app version given with WithApp.
+// useLastRevision skips the server cache and the client one, if any.
+func (c *Client) UserBanner(ctx context.Context, featureID, tagID int, useLastRevision bool) (map[string]any, error) {
+	content, _, err := c.LocalizedUserBanner(ctx, featureID, tagID, "", useLastRevision)
+	return content, err
+}
+
+// LocalizedUserBanner is UserBanner in the language that best matches lang,
+// a comma-separated list of BCP 47 tags, most preferred first. It also
+// returns the language of the content, empty if the banner does not say.
+// An empty lang returns the default content.
+func (c *Client) LocalizedUserBanner(ctx context.Context, featureID, tagID int, lang string, useLastRevision bool) (map[string]any, string, error) {
+	return c.TargetedUserBanner(ctx, featureID, tagID, UserBannerOptions{Lang: lang, UseLastRevision: useLastRevision})
+}
+
+// UserBannerOptions describe the user a banner is asked for.
+type UserBannerOptions struct {
+	// Lang is as in LocalizedUserBanner.
+	Lang string
+	// Attributes are what the targeting rules of banners are evaluated
+	// against, such as "country" or "days_since_signup".
+	Attributes      map[string]string
+	UseLastRevision bool
+}
+
+// TargetedUserBanner is LocalizedUserBanner for a user with attributes, so
+// banners with targeting rules can match them.
+func (c *Client) TargetedUserBanner(ctx context.Context, featureID, tagID int, opts UserBannerOptions) (map[string]any, string, error) {
+	lang, useLastRevision := opts.Lang, opts.UseLastRevision
+	attrs := url.Values{}
+	for name, value := range opts.Attributes {
+		attrs.Set("attr["+name+"]", value)
+	}
+
+	key := userBannerKey{featureID, tagID, lang, attrs.Encode()}
+	var cached userBannerEntry
+	if c.cache != nil {
+		var found bool
+		if cached, found = c.cache.get(key); found && !useLastRevision && time.Now().Before(cached.expires) {
+			content, err := decodeContent(cached.content)
+			return content, cached.language, err
+		}
+	}
+
+	q := attrs
+	q.Set("feature_id", strconv.Itoa(featureID))
+	q.Set("tag_id", strconv.Itoa(tagID))
+	if lang != "" {
+		q.Set("lang", lang)
+	}
+	if useLastRevision {
+		q.Set("use_last_revision", "true")
+	}
+	req := request{method: http.MethodGet, path: "/user_banner", query: q, header: http.Header{}}
+	if c.platform != "" {
+		req.header.Set("X-Platform", c.platform)
+	}
+	if c.appVersion != "" {
+		req.header.Set("X-App-Version", c.appVersion)
+	}
+	if cached.etag != "" {
+		req.header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		if c.cache != nil && IsNotFound(err) {
+			c.cache.delete(key)
+		}
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	content := cached.content
+	if resp.StatusCode != http.StatusNotModified {
+		if content, err = io.ReadAll(resp.Body); err != nil {
+			return nil, "", fmt.Errorf("GET /user_banner: %w", err)
+		}
+	}
+	if c.cache != nil {
+		c.cache.set(key, content, resp.Header)
+	}
+
+	decoded, err := decodeContent(content)
+	return decoded, resp.Header.Get("Content-Language"), err
+}
+
+func decodeContent(data []byte) (map[string]any, error) {
+	var content map[string]any
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("GET /user_banner: failed to decode response: %w", err)
+	}
+
+	return content, nil
+}
+
+// Import formats and modes of ImportBanners.
+const (
+	ImportNDJSON = "application/x-ndjson"
+	ImportCSV    = "text/csv"
+
+	ImportModeValidate = "validate"
+	ImportModeUpsert   = "upsert"
+)
+
+type ImportOptions struct {
+	// ContentType is ImportNDJSON (the default) or ImportCSV.
+	ContentType string
+	// Mode is ImportModeUpsert (the default) or ImportModeValidate.
+	Mode string
+	// ChunkSize saves rows in transactions of that many rows; 0 saves all
+	// rows in one transaction.
+	ChunkSize int
+}
+
+type ImportReport struct {
+	Mode      string      `json:"mode"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Conflicts int         `json:"conflicts"`
+	Invalid   int         `json:"invalid"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Status   string `json:"status"`
+	BannerID int    `json:"banner_id"`
+	Error    string `json:"error"`
+	// CurrentVersion is set on rows that failed because the banner was
+	// changed since the version they carry.
+	CurrentVersion int64 `json:"current_version"`
+	// ChangeRequestID is the change request that submitted the draft of
+	// an updated row, if its feature requires approval.
+	ChangeRequestID int `json:"change_request_id"`
+	// ConflictingBannerID is the live banner a row with status conflict
+	// has the feature, targeting and a tag of; 0 if it conflicts with
+	// another row of the import.
+	ConflictingBannerID int `json:"conflicting_banner_id"`
+}
+
+func (c *Client) ImportBanners(ctx context.Context, data io.Reader, opts ImportOptions) (*ImportReport, error) {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = ImportNDJSON
+	}
+	q := url.Values{}
+	if opts.Mode != "" {
+		q.Set("mode", opts.Mode)
+	}
+	if opts.ChunkSize > 0 {
+		q.Set("chunk_size", strconv.Itoa(opts.ChunkSize))
+	}
+
+	var report ImportReport
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/banner/import", query: q, body: data, contentType: contentType}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ExportBanners streams every banner in format "ndjson" or "csv". The
+// caller closes the returned reader.
+func (c *Client) ExportBanners(ctx context.Context, format string) (io.ReadCloser, error) {
+	q := url.Values{}
+	if format != "" {
+		q.Set("format", format)
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: "/banner/export", query: q})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func bannerPath(id int) string {
+	return fmt.Sprintf("/banner/%d", id)
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxCachedBanners = 10_000
+
+// WithUserBannerCache keeps UserBanner results in memory for up to ttl. An
+// entry is never kept longer than the service allows with Cache-Control, so
+// a cached banner is no older than one the service itself would return;
+// after that it is revalidated with its ETag. UserBanner with
+// useLastRevision always asks the service.
+func WithUserBannerCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cache = &userBannerCache{ttl: ttl, entries: make(map[userBannerKey]userBannerEntry)}
+	}
+}
+
+// userBannerKey includes the requested languages and the encoded user
+// attributes, as the service picks the content by them.
+type userBannerKey struct {
+	featureID, tagID int
+	lang             string
+	attributes       string
+}
+
+type userBannerEntry struct {
+	// content is the response body, decoded anew for every caller so
+	// they cannot change each other's maps.
+	content  []byte
+	language string
+	etag     string
+	expires  time.Time
+}
+
+type userBannerCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[userBannerKey]userBannerEntry
+}
+
+func (c *userBannerCache) get(key userBannerKey) (userBannerEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[key]
+	return e, found
+}
+
+// set stores the response content for as long as both the TTL and the
+// Cache-Control of the response allow.
+func (c *userBannerCache) set(key userBannerKey, content []byte, header http.Header) {
+	e := userBannerEntry{
+		content:  content,
+		language: header.Get("Content-Language"),
+		etag:     header.Get("ETag"),
+		expires:  time.Now().Add(min(c.ttl, maxAge(header.Get("Cache-Control")))),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.entries[key]; !found && len(c.entries) >= maxCachedBanners {
+		c.evict()
+	}
+	c.entries[key] = e
+}
+
+func (c *userBannerCache) delete(key userBannerKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// evict drops expired entries, or an arbitrary one if none has expired.
+func (c *userBannerCache) evict() {
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < maxCachedBanners {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
+
+// maxAge returns the max-age of a Cache-Control header, or zero if the
+// response must be revalidated.
+func maxAge(cacheControl string) time.Duration {
+	age := time.Duration(0)
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return 0
+			}
+			age = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return age
+}
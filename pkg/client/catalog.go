@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type Tag struct {
+	ID   int    `json:"tag_id"`
+	Name string `json:"name"`
+}
+
+type Feature struct {
+	ID   int    `json:"feature_id"`
+	Name string `json:"name"`
+	// RequiresApproval means drafts of the feature's banners are published
+	// by approving a change request.
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+func (c *Client) ListTags(ctx context.Context) ([]Tag, error) {
+	var resp struct {
+		Items []Tag `json:"items"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/tags"}, &resp)
+
+	return resp.Items, err
+}
+
+func (c *Client) GetTag(ctx context.Context, id int) (*Tag, error) {
+	return c.tag(ctx, request{method: http.MethodGet, path: tagPath(id)})
+}
+
+func (c *Client) CreateTag(ctx context.Context, name string) (*Tag, error) {
+	return c.tag(ctx, request{method: http.MethodPost, path: "/tags", body: named{name}})
+}
+
+func (c *Client) RenameTag(ctx context.Context, id int, name string) (*Tag, error) {
+	return c.tag(ctx, request{method: http.MethodPatch, path: tagPath(id), body: named{name}})
+}
+
+// DeleteTag deletes a tag no banner has; otherwise the error is a 409.
+func (c *Client) DeleteTag(ctx context.Context, id int) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: tagPath(id)}, nil)
+	return err
+}
+
+func (c *Client) ListFeatures(ctx context.Context) ([]Feature, error) {
+	var resp struct {
+		Items []Feature `json:"items"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/features"}, &resp)
+
+	return resp.Items, err
+}
+
+func (c *Client) GetFeature(ctx context.Context, id int) (*Feature, error) {
+	return c.feature(ctx, request{method: http.MethodGet, path: featurePath(id)})
+}
+
+func (c *Client) CreateFeature(ctx context.Context, name string) (*Feature, error) {
+	return c.feature(ctx, request{method: http.MethodPost, path: "/features", body: named{name}})
+}
+
+func (c *Client) RenameFeature(ctx context.Context, id int, name string) (*Feature, error) {
+	return c.feature(ctx, request{method: http.MethodPatch, path: featurePath(id), body: named{name}})
+}
+
+// SetFeatureApproval turns approval of banner changes of the feature on or
+// off.
+func (c *Client) SetFeatureApproval(ctx context.Context, id int, required bool) (*Feature, error) {
+	body := map[string]bool{"requires_approval": required}
+	return c.feature(ctx, request{method: http.MethodPatch, path: featurePath(id), body: body})
+}
+
+// DeleteFeature deletes a feature no banner has; otherwise the error is a
+// 409.
+func (c *Client) DeleteFeature(ctx context.Context, id int) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: featurePath(id)}, nil)
+	return err
+}
+
+type named struct {
+	Name string `json:"name"`
+}
+
+func (c *Client) tag(ctx context.Context, req request) (*Tag, error) {
+	var tag Tag
+	if _, err := c.do(ctx, req, &tag); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+func (c *Client) feature(ctx context.Context, req request) (*Feature, error) {
+	var feature Feature
+	if _, err := c.do(ctx, req, &feature); err != nil {
+		return nil, err
+	}
+
+	return &feature, nil
+}
+
+func tagPath(id int) string {
+	return fmt.Sprintf("/tags/%d", id)
+}
+
+func featurePath(id int) string {
+	return fmt.Sprintf("/features/%d", id)
+}
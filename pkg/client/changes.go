@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Change request statuses.
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+	ChangeRequestCanceled = "canceled"
+)
+
+// ChangeRequest is a banner draft submitted for approval by another admin.
+type ChangeRequest struct {
+	ID            int            `json:"change_request_id"`
+	BannerID      int            `json:"banner_id"`
+	BaseVersion   int64          `json:"base_version"`
+	TagIDs        []int          `json:"tag_ids"`
+	FeatureID     int            `json:"feature_id"`
+	Content       map[string]any `json:"content"`
+	IsActive      bool           `json:"is_active"`
+	Status        string         `json:"status"`
+	Author        string         `json:"author"`
+	Comment       string         `json:"comment"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Reviewer      string         `json:"reviewer"`
+	ReviewComment string         `json:"review_comment"`
+	ReviewedAt    *time.Time     `json:"reviewed_at"`
+}
+
+// ChangeRequestOptions filters ListChangeRequests. Zero fields do not
+// filter.
+type ChangeRequestOptions struct {
+	Status   string
+	BannerID int
+	Limit    int
+}
+
+// CreateChangeRequest submits the banner draft for approval, if the banner is
+// still at version. Editing the draft afterwards makes the request stale.
+func (c *Client) CreateChangeRequest(ctx context.Context, bannerID int, version int64, comment string) (*ChangeRequest, error) {
+	body := struct {
+		Version int64  `json:"version"`
+		Comment string `json:"comment,omitempty"`
+	}{version, comment}
+
+	return c.changeRequest(ctx, request{method: http.MethodPost, path: bannerPath(bannerID) + "/change_requests", body: body})
+}
+
+// ListChangeRequests returns change requests newest first.
+func (c *Client) ListChangeRequests(ctx context.Context, opts ChangeRequestOptions) ([]ChangeRequest, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	if opts.BannerID != 0 {
+		query.Set("banner_id", strconv.Itoa(opts.BannerID))
+	}
+	if opts.Limit != 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var resp struct {
+		Items []ChangeRequest `json:"items"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/change_requests", query: query}, &resp)
+
+	return resp.Items, err
+}
+
+func (c *Client) GetChangeRequest(ctx context.Context, id int) (*ChangeRequest, error) {
+	return c.changeRequest(ctx, request{method: http.MethodGet, path: changeRequestPath(id)})
+}
+
+// ApproveChangeRequest publishes the change. The author of the request cannot
+// approve it, and a request whose banner changed since cannot be approved;
+// both are errors.
+func (c *Client) ApproveChangeRequest(ctx context.Context, id int, comment string) (*ChangeRequest, error) {
+	return c.changeRequest(ctx, request{method: http.MethodPost, path: changeRequestPath(id) + "/approve", body: review{comment}})
+}
+
+// RejectChangeRequest closes the request without publishing it. Authors can
+// reject their own requests to withdraw them.
+func (c *Client) RejectChangeRequest(ctx context.Context, id int, comment string) (*ChangeRequest, error) {
+	return c.changeRequest(ctx, request{method: http.MethodPost, path: changeRequestPath(id) + "/reject", body: review{comment}})
+}
+
+type review struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+func (c *Client) changeRequest(ctx context.Context, req request) (*ChangeRequest, error) {
+	var change ChangeRequest
+	if _, err := c.do(ctx, req, &change); err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+func changeRequestPath(id int) string {
+	return fmt.Sprintf("/change_requests/%d", id)
+}
@@ -0,0 +1,302 @@
+// Package client is a Go client for the banner service API.
+//
+//	c, err := client.New("http://localhost:8080")
+//	if err != nil { ... }
+//	if err := c.Login(ctx, "admin", password); err != nil { ... }
+//	page, err := c.ListBanners(ctx, client.ListOptions{TagIDs: []int{1}})
+//
+// Errors returned by the service are *Error with the problem details.
+//
+// Requests that fail with a network error, 429 or 502-504 are retried with
+// backoff (see WithRetry); creates get an Idempotency-Key so a retry never
+// makes a duplicate. With WithCredentials the client logs in again when the
+// token expires, and WithUserBannerCache keeps user banners in memory.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultTimeout = 30 * time.Second
+
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	retry   RetryPolicy
+	cache   *userBannerCache
+
+	// platform and appVersion are sent with user banner requests, set by
+	// WithApp.
+	platform, appVersion string
+
+	// name and password are set by WithCredentials to log in again when
+	// the token expires; logins collapses concurrent logins into one.
+	name, password string
+	logins         singleflight.Group
+
+	mu    sync.RWMutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with. The default
+// one times out after 30 seconds.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// WithToken sets the token from a previous Login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithCredentials makes the client log in as the user before the first
+// request and again whenever the token is rejected, so a long-running
+// service never sees an expired token.
+func WithCredentials(name, password string) Option {
+	return func(c *Client) {
+		c.name, c.password = name, password
+	}
+}
+
+// WithApp tells the service the platform (ios, android or web) and version
+// of the app, so user banners targeted at other platforms or versions are
+// not returned. Either may be empty if unknown.
+func WithApp(platform, version string) Option {
+	return func(c *Client) {
+		c.platform, c.appVersion = platform, version
+	}
+}
+
+// New returns a client of the service at baseURL, such as
+// http://localhost:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	c := &Client{baseURL: u, http: &http.Client{Timeout: defaultTimeout}, retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Token returns the token requests are authorized with.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// request is one API call. Body is encoded as JSON unless it is an
+// io.Reader, which is sent as is with ContentType.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        any
+	contentType string
+	header      http.Header
+}
+
+// do sends the request and decodes a successful JSON response into out, if
+// it is not nil. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, req request, out any) (*http.Response, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("%s %s: failed to decode response: %w", req.method, req.path, err)
+		}
+	}
+
+	return resp, nil
+}
+
+// send sends the request and returns the response of a successful one with
+// the body still open. Failed attempts are retried as the retry policy
+// allows, and a rejected token is renewed once if the client has
+// credentials.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	body, err := newBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.method == http.MethodPost && c.retry.MaxAttempts > 1 && req.header.Get(headerIdempotencyKey) == "" {
+		req.header = req.header.Clone()
+		if req.header == nil {
+			req.header = http.Header{}
+		}
+		req.header.Set(headerIdempotencyKey, newIdempotencyKey())
+	}
+
+	relogin := c.canLogin() && req.path != loginPath
+	if relogin && c.Token() == "" {
+		if err := c.renewToken(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		token := c.Token()
+		resp, err := c.sendOnce(ctx, req, body, token)
+
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && relogin && body.replayable() {
+			resp.Body.Close()
+			relogin = false
+			if err := c.renewToken(ctx, token); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+
+		wait, retry := c.retry.next(attempt, req, resp, err)
+		if !retry || !body.replayable() {
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", req.method, req.path, err)
+			}
+			if resp.StatusCode >= http.StatusBadRequest {
+				defer resp.Body.Close()
+				return nil, readError(resp)
+			}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", req.method, req.path, err)
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req request, body *requestBody, token string) (*http.Response, error) {
+	httpReq, err := c.newRequest(ctx, req, body, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.http.Do(httpReq)
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, body *requestBody, token string) (*http.Request, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	reader, err := body.reader()
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if body.contentType != "" {
+		httpReq.Header.Set("Content-Type", body.contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return httpReq, nil
+}
+
+// requestBody is the body of a request, which can be sent again if it was
+// encoded from a value or is an io.Seeker.
+type requestBody struct {
+	data        []byte
+	stream      io.Reader
+	contentType string
+	sent        bool
+}
+
+func newBody(req request) (*requestBody, error) {
+	body := &requestBody{contentType: req.contentType}
+	switch b := req.body.(type) {
+	case nil:
+	case io.Reader:
+		body.stream = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: failed to encode request: %w", req.method, req.path, err)
+		}
+		body.data = data
+		if body.contentType == "" {
+			body.contentType = "application/json"
+		}
+	}
+
+	return body, nil
+}
+
+func (b *requestBody) replayable() bool {
+	if b.stream == nil {
+		return true
+	}
+	_, seeker := b.stream.(io.Seeker)
+
+	return seeker || !b.sent
+}
+
+func (b *requestBody) reader() (io.Reader, error) {
+	defer func() { b.sent = true }()
+
+	switch {
+	case b.stream == nil && b.data == nil:
+		return nil, nil
+	case b.stream == nil:
+		return bytes.NewReader(b.data), nil
+	}
+
+	if seeker, ok := b.stream.(io.Seeker); ok && b.sent {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.stream, nil
+}
@@ -0,0 +1,671 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"banner/internal/app"
+	jwt "banner/internal/lib/auth/jwt"
+	password "banner/internal/lib/auth/password"
+	"banner/internal/models"
+	"banner/internal/repository/cache"
+	"banner/internal/repository/memory"
+	"banner/pkg/client"
+)
+
+const (
+	adminName     = "admin"
+	reviewerName  = "reviewer"
+	adminPassword = "admin-password"
+)
+
+// testServer serves the real router on in-memory repositories. Handlers in
+// wrap run before the router and can fail requests.
+type testServer struct {
+	*httptest.Server
+	jwt *jwt.JWTSecret
+
+	mu   sync.Mutex
+	wrap func(w http.ResponseWriter, r *http.Request, next http.Handler)
+}
+
+func newTestServer(t *testing.T, cacheTTL time.Duration) *testServer {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	bannerCache := cache.New(cache.Options{TTL: cacheTTL, HardTTL: time.Hour, MaxEntries: 100, Shards: 1})
+	t.Cleanup(bannerCache.Close)
+
+	hash, err := password.HashPassword(adminPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{adminName, reviewerName} {
+		store.CreateUser(context.Background(), &models.User{Username: name, Password: hash, Role: "admin"})
+	}
+
+	s := &testServer{jwt: jwt.NewJWTSecret("client-test-secret", log)}
+	router, err := app.NewRouter(app.Dependencies{
+		Log:                     log,
+		Features:                store,
+		Tags:                    store,
+		Users:                   store,
+		Banners:                 store,
+		Idempotency:             store,
+		Cache:                   bannerCache,
+		JWT:                     s.jwt,
+		IdempotencyTTL:          time.Hour,
+		IdempotencyLockTimeout:  time.Minute,
+		IdempotencyMaxBodyBytes: 1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		wrap := s.wrap
+		s.mu.Unlock()
+
+		if wrap == nil {
+			router.ServeHTTP(w, r)
+			return
+		}
+		wrap(w, r, router)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) setWrap(wrap func(w http.ResponseWriter, r *http.Request, next http.Handler)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wrap = wrap
+}
+
+func newAdminClient(t *testing.T, s *testServer, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	opts = append([]client.Option{
+		client.WithCredentials(adminName, adminPassword),
+		client.WithRetry(client.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}),
+	}, opts...)
+	c, err := client.New(s.URL, opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	feature, err := c.CreateFeature(ctx, "onboarding")
+	if err != nil {
+		t.Fatalf("CreateFeature() error = %v", err)
+	}
+	tag, err := c.CreateTag(ctx, "new-users")
+	if err != nil {
+		t.Fatalf("CreateTag() error = %v", err)
+	}
+	if _, err := c.RenameTag(ctx, tag.ID, "newcomers"); err != nil {
+		t.Fatalf("RenameTag() error = %v", err)
+	}
+	if tags, err := c.ListTags(ctx); err != nil || len(tags) != 1 || tags[0].Name != "newcomers" {
+		t.Fatalf("ListTags() = %v, %v; want the renamed tag", tags, err)
+	}
+
+	banner, err := c.CreateBanner(ctx, client.NewBanner{
+		TagIDs:    []int{tag.ID},
+		FeatureID: feature.ID,
+		Content:   map[string]any{"title": "Welcome"},
+		IsActive:  true,
+	})
+	if err != nil {
+		t.Fatalf("CreateBanner() error = %v", err)
+	}
+
+	page, err := c.ListBanners(ctx, client.ListOptions{TagIDs: []int{tag.ID}, IncludeTotal: true})
+	if err != nil {
+		t.Fatalf("ListBanners() error = %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != banner.ID || page.Total == nil || *page.Total != 1 {
+		t.Fatalf("ListBanners() = %+v, want the created banner", page)
+	}
+
+	active := false
+	updated, err := c.UpdateBanner(ctx, banner.ID, banner.Version, client.BannerPatch{IsActive: &active})
+	if err != nil {
+		t.Fatalf("UpdateBanner() error = %v", err)
+	}
+	if updated.IsActive || updated.Version != banner.Version+1 {
+		t.Fatalf("UpdateBanner() = %+v, want an inactive banner at the next version", updated)
+	}
+
+	_, err = c.UpdateBanner(ctx, banner.ID, banner.Version, client.BannerPatch{IsActive: &active})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusPreconditionFailed ||
+		apiErr.CurrentVersion == nil || *apiErr.CurrentVersion != updated.Version {
+		t.Fatalf("UpdateBanner() at an old version error = %v, want 412 with the current version", err)
+	}
+
+	if content, err := c.UserBanner(ctx, feature.ID, tag.ID, true); err != nil || content["title"] != "Welcome" {
+		t.Fatalf("UserBanner() with a draft = %v, %v; want the published content", content, err)
+	}
+	published, err := c.PublishBanner(ctx, banner.ID, updated.Version)
+	if err != nil {
+		t.Fatalf("PublishBanner() error = %v", err)
+	}
+	if published.IsActive || published.HasDraft {
+		t.Fatalf("PublishBanner() = %+v, want the inactive banner without a draft", published)
+	}
+	if _, err := c.GetBannerDraft(ctx, banner.ID); !client.IsNotFound(err) {
+		t.Fatalf("GetBannerDraft() after publish error = %v, want 404", err)
+	}
+
+	if err := c.DeleteTag(ctx, tag.ID); !client.IsStatus(err, http.StatusConflict) {
+		t.Fatalf("DeleteTag() of a used tag error = %v, want 409", err)
+	}
+
+	if err := c.DeleteBanner(ctx, banner.ID, published.Version); err != nil {
+		t.Fatalf("DeleteBanner() error = %v", err)
+	}
+	if _, err := c.GetBanner(ctx, banner.ID); !client.IsNotFound(err) {
+		t.Fatalf("GetBanner() of a deleted banner error = %v, want 404", err)
+	}
+
+	trash, err := c.ListTrash(ctx, 0)
+	if err != nil || len(trash) != 1 || trash[0].ID != banner.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("ListTrash() = %+v, %v, want the deleted banner", trash, err)
+	}
+	if _, err := c.RestoreBanner(ctx, banner.ID, published.Version); !client.IsStatus(err, http.StatusPreconditionFailed) {
+		t.Fatalf("RestoreBanner() at the version before the delete error = %v, want 412", err)
+	}
+	restored, err := c.RestoreBanner(ctx, banner.ID, trash[0].Version)
+	if err != nil {
+		t.Fatalf("RestoreBanner() error = %v", err)
+	}
+	if _, err := c.GetBanner(ctx, restored.ID); err != nil {
+		t.Fatalf("GetBanner() of a restored banner error = %v", err)
+	}
+
+	promo, err := c.CreateFeature(ctx, "promo")
+	if err != nil {
+		t.Fatalf("CreateFeature() error = %v", err)
+	}
+	report, err := c.CloneBanner(ctx, banner.ID, client.CloneOptions{FeatureIDs: []int{feature.ID, promo.ID}})
+	if err != nil {
+		t.Fatalf("CloneBanner() error = %v", err)
+	}
+	if report.Created != 1 || report.Conflicts != 1 || report.Results[0].ConflictingBannerID != banner.ID ||
+		report.Results[1].Status != client.CloneCreated || report.Results[1].FeatureID != promo.ID {
+		t.Fatalf("CloneBanner() = %+v, want a conflict with the banner and a clone to promo", report)
+	}
+	if clone, err := c.GetBanner(ctx, report.Results[1].BannerID); err != nil || clone.FeatureID != promo.ID || clone.TagIDs[0] != tag.ID {
+		t.Fatalf("GetBanner() of the clone = %+v, %v", clone, err)
+	}
+}
+
+func TestClientImportExport(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	feature, err := c.CreateFeature(ctx, "promo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.CreateTag(ctx, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := `{"feature_id": ` + strconv.Itoa(feature.ID) + `, "tag_ids": [` + strconv.Itoa(tag.ID) + `], "content": {"title": "Sale"}, "is_active": true}` + "\n"
+	report, err := c.ImportBanners(ctx, strings.NewReader(rows), client.ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportBanners() error = %v", err)
+	}
+	if report.Created != 1 {
+		t.Fatalf("ImportBanners() = %+v, want one created banner", report)
+	}
+
+	export, err := c.ExportBanners(ctx, "ndjson")
+	if err != nil {
+		t.Fatalf("ExportBanners() error = %v", err)
+	}
+	defer export.Close()
+	data, err := io.ReadAll(export)
+	if err != nil || !strings.Contains(string(data), `"Sale"`) {
+		t.Fatalf("ExportBanners() = %s, %v; want the imported banner", data, err)
+	}
+}
+
+func TestClientRenewsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+
+	expired, err := s.jwt.GenerateToken(adminName, "admin", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newAdminClient(t, s, client.WithToken(expired))
+
+	if _, err := c.ListFeatures(ctx); err != nil {
+		t.Fatalf("ListFeatures() with an expired token error = %v", err)
+	}
+	if c.Token() == expired {
+		t.Fatal("Token() is still the expired token")
+	}
+
+	withoutCredentials, err := client.New(s.URL, client.WithToken(expired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withoutCredentials.ListFeatures(ctx); !client.IsStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("ListFeatures() without credentials error = %v, want 401", err)
+	}
+}
+
+func TestClientRetriesCreateWithoutDuplicates(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+	if _, err := c.ListFeatures(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt is handled, but its response is lost on the way.
+	var (
+		attempts atomic.Int64
+		keys     sync.Map
+	)
+	s.setWrap(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method != http.MethodPost || r.URL.Path != "/features" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		keys.Store(r.Header.Get("Idempotency-Key"), true)
+		if attempts.Add(1) == 1 {
+			next.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	feature, err := c.CreateFeature(ctx, "checkout")
+	if err != nil {
+		t.Fatalf("CreateFeature() error = %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts.Load())
+	}
+	n := 0
+	keys.Range(func(key, _ any) bool {
+		if key == "" {
+			t.Error("attempt without Idempotency-Key")
+		}
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("attempts used %d Idempotency-Keys, want 1", n)
+	}
+
+	features, err := c.ListFeatures(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 1 || features[0].ID != feature.ID {
+		t.Fatalf("ListFeatures() = %v, want only the retried feature", features)
+	}
+}
+
+func TestClientRetryGivesUp(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	var attempts atomic.Int64
+	s.setWrap(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.URL.Path == "/tags" {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	if _, err := c.ListTags(ctx); !client.IsStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("ListTags() error = %v, want 503", err)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts.Load())
+	}
+}
+
+func TestClientUserBannerCache(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		// serverTTL is the server cache TTL, which bounds the client one.
+		serverTTL    time.Duration
+		wantRequests int64
+		wantNotMod   int64
+	}{
+		{name: "fresh entries are served locally", serverTTL: time.Minute, wantRequests: 1},
+		{name: "stale entries are revalidated", serverTTL: 0, wantRequests: 3, wantNotMod: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.serverTTL)
+			c := newAdminClient(t, s, client.WithUserBannerCache(time.Minute))
+
+			feature, err := c.CreateFeature(ctx, "onboarding")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag, err := c.CreateTag(ctx, "new-users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.CreateBanner(ctx, client.NewBanner{
+				TagIDs:    []int{tag.ID},
+				FeatureID: feature.ID,
+				Content:   map[string]any{"title": "Welcome"},
+				IsActive:  true,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var requests, notModified atomic.Int64
+			s.setWrap(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+				if r.URL.Path == "/user_banner" {
+					requests.Add(1)
+					rec := httptest.NewRecorder()
+					next.ServeHTTP(rec, r)
+					if rec.Code == http.StatusNotModified {
+						notModified.Add(1)
+					}
+					for name, values := range rec.Header() {
+						w.Header()[name] = values
+					}
+					w.WriteHeader(rec.Code)
+					w.Write(rec.Body.Bytes())
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+
+			for i := 0; i < 3; i++ {
+				content, err := c.UserBanner(ctx, feature.ID, tag.ID, false)
+				if err != nil {
+					t.Fatalf("UserBanner() error = %v", err)
+				}
+				if content["title"] != "Welcome" {
+					t.Fatalf("UserBanner() = %v, want the banner content", content)
+				}
+				// Callers get their own maps.
+				content["title"] = "changed"
+			}
+			if requests.Load() != tt.wantRequests || notModified.Load() != tt.wantNotMod {
+				t.Fatalf("requests = %d with %d not modified, want %d with %d",
+					requests.Load(), notModified.Load(), tt.wantRequests, tt.wantNotMod)
+			}
+
+			if _, err := c.UserBanner(ctx, feature.ID, tag.ID, true); err != nil {
+				t.Fatalf("UserBanner(useLastRevision) error = %v", err)
+			}
+			if requests.Load() != tt.wantRequests+1 {
+				t.Fatal("UserBanner(useLastRevision) was served from the client cache")
+			}
+		})
+	}
+}
+
+func TestClientLocalizedUserBanner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s, client.WithUserBannerCache(time.Minute))
+
+	feature, err := c.CreateFeature(ctx, "onboarding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.CreateTag(ctx, "new-users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	banner, err := c.CreateBanner(ctx, client.NewBanner{
+		TagIDs:        []int{tag.ID},
+		FeatureID:     feature.ID,
+		Content:       map[string]any{"title": "Welcome"},
+		IsActive:      true,
+		DefaultLocale: "en",
+		Locales:       map[string]map[string]any{"de-de": {"title": "Willkommen"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateBanner() error = %v", err)
+	}
+	if _, found := banner.Locales["de-DE"]; !found || banner.DefaultLocale != "en" {
+		t.Fatalf("CreateBanner() = %+v, want canonical locales", banner)
+	}
+
+	// The cache keeps every language apart.
+	for i := 0; i < 2; i++ {
+		for _, tt := range []struct{ lang, wantTitle, wantLanguage string }{
+			{lang: "de", wantTitle: "Willkommen", wantLanguage: "de-DE"},
+			{lang: "", wantTitle: "Welcome", wantLanguage: "en"},
+			{lang: "fr, en-GB", wantTitle: "Welcome", wantLanguage: "en"},
+		} {
+			content, language, err := c.LocalizedUserBanner(ctx, feature.ID, tag.ID, tt.lang, false)
+			if err != nil {
+				t.Fatalf("LocalizedUserBanner(%q) error = %v", tt.lang, err)
+			}
+			if content["title"] != tt.wantTitle || language != tt.wantLanguage {
+				t.Fatalf("LocalizedUserBanner(%q) = %v in %q, want %q in %q",
+					tt.lang, content, language, tt.wantTitle, tt.wantLanguage)
+			}
+		}
+	}
+
+	if _, _, err := c.LocalizedUserBanner(ctx, feature.ID, tag.ID, "!", false); !client.IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("LocalizedUserBanner() with an invalid lang error = %v, want 400", err)
+	}
+}
+
+func TestClientTargetedUserBanner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	feature, err := c.CreateFeature(ctx, "onboarding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.CreateTag(ctx, "new-users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, banner := range []client.NewBanner{
+		{Content: map[string]any{"title": "Welcome"}},
+		{Content: map[string]any{"title": "New on iOS"}, Platforms: []string{"ios"}, AppVersion: ">=7.2"},
+	} {
+		banner.TagIDs, banner.FeatureID, banner.IsActive = []int{tag.ID}, feature.ID, true
+		if _, err := c.CreateBanner(ctx, banner); err != nil {
+			t.Fatalf("CreateBanner() error = %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		platform, version, want string
+	}{
+		{platform: "ios", version: "7.3.0", want: "New on iOS"},
+		{platform: "ios", version: "7.1.9", want: "Welcome"},
+		{platform: "android", version: "7.3.0", want: "Welcome"},
+		{want: "Welcome"},
+	} {
+		app := newAdminClient(t, s, client.WithApp(tt.platform, tt.version))
+		content, err := app.UserBanner(ctx, feature.ID, tag.ID, false)
+		if err != nil {
+			t.Fatalf("UserBanner() on %s %s error = %v", tt.platform, tt.version, err)
+		}
+		if content["title"] != tt.want {
+			t.Fatalf("UserBanner() on %s %s = %v, want %q", tt.platform, tt.version, content, tt.want)
+		}
+	}
+}
+
+func TestClientUserBannerAttributes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s, client.WithUserBannerCache(time.Minute))
+
+	feature, err := c.CreateFeature(ctx, "promo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.CreateTag(ctx, "everyone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, banner := range []client.NewBanner{
+		{Content: map[string]any{"title": "Hello"}},
+		{Content: map[string]any{"title": "Salem"}, Rule: `country == "KZ" and days_since_signup > 7`},
+	} {
+		banner.TagIDs, banner.FeatureID, banner.IsActive = []int{tag.ID}, feature.ID, true
+		if _, err := c.CreateBanner(ctx, banner); err != nil {
+			t.Fatalf("CreateBanner() error = %v", err)
+		}
+	}
+	_, err = c.CreateBanner(ctx, client.NewBanner{TagIDs: []int{tag.ID}, FeatureID: feature.ID, Content: map[string]any{}, Rule: "country =="})
+	if !client.IsStatus(err, http.StatusBadRequest) {
+		t.Fatalf("CreateBanner() with an invalid rule error = %v, want 400", err)
+	}
+
+	// The cache must keep the answers for different users apart.
+	for _, tt := range []struct {
+		attrs map[string]string
+		want  string
+	}{
+		{attrs: map[string]string{"country": "KZ", "days_since_signup": "30"}, want: "Salem"},
+		{attrs: map[string]string{"country": "KZ", "days_since_signup": "1"}, want: "Hello"},
+		{want: "Hello"},
+		{attrs: map[string]string{"country": "KZ", "days_since_signup": "30"}, want: "Salem"},
+	} {
+		content, _, err := c.TargetedUserBanner(ctx, feature.ID, tag.ID, client.UserBannerOptions{Attributes: tt.attrs})
+		if err != nil {
+			t.Fatalf("TargetedUserBanner(%v) error = %v", tt.attrs, err)
+		}
+		if content["title"] != tt.want {
+			t.Fatalf("TargetedUserBanner(%v) = %v, want %q", tt.attrs, content, tt.want)
+		}
+	}
+}
+
+func TestClientTemplatedUserBanner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	feature, err := c.CreateFeature(ctx, "cashback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := c.CreateTag(ctx, "customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	banner, err := c.CreateBanner(ctx, client.NewBanner{
+		TagIDs: []int{tag.ID}, FeatureID: feature.ID, IsActive: true,
+		Content:  map[string]any{"title": "Hi {{ name | 'friend' }}, your cashback is {{ amount }}"},
+		Template: &client.BannerTemplate{Variables: []string{"name", "amount"}, OnMissing: "error"},
+	})
+	if err != nil {
+		t.Fatalf("CreateBanner() error = %v", err)
+	}
+
+	content, _, err := c.TargetedUserBanner(ctx, feature.ID, tag.ID, client.UserBannerOptions{Attributes: map[string]string{"amount": "5%"}})
+	if err != nil || content["title"] != "Hi friend, your cashback is 5%" {
+		t.Fatalf("TargetedUserBanner() = %v, %v", content, err)
+	}
+	if _, err := c.UserBanner(ctx, feature.ID, tag.ID, false); !client.IsStatus(err, http.StatusUnprocessableEntity) {
+		t.Fatalf("UserBanner() without attributes error = %v, want 422", err)
+	}
+
+	draft, err := c.UpdateBanner(ctx, banner.ID, banner.Version, client.BannerPatch{RemoveTemplate: true})
+	if err != nil || draft.Template != nil {
+		t.Fatalf("UpdateBanner() removing the template = %+v, %v", draft, err)
+	}
+}
+
+func TestClientChangeRequests(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, time.Minute)
+	c := newAdminClient(t, s)
+
+	feature, err := c.CreateFeature(ctx, "checkout")
+	if err != nil {
+		t.Fatalf("CreateFeature() error = %v", err)
+	}
+	if feature, err = c.SetFeatureApproval(ctx, feature.ID, true); err != nil || !feature.RequiresApproval {
+		t.Fatalf("SetFeatureApproval() = %+v, %v", feature, err)
+	}
+	banner, err := c.CreateBanner(ctx, client.NewBanner{FeatureID: feature.ID, TagIDs: []int{}, Content: map[string]any{"title": "Old"}, IsActive: true})
+	if err != nil {
+		t.Fatalf("CreateBanner() error = %v", err)
+	}
+	draft, err := c.UpdateBanner(ctx, banner.ID, banner.Version, client.BannerPatch{Content: map[string]any{"title": "New"}})
+	if err != nil {
+		t.Fatalf("UpdateBanner() error = %v", err)
+	}
+
+	_, err = c.PublishBanner(ctx, banner.ID, draft.Version)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != client.CodeApprovalRequired {
+		t.Fatalf("PublishBanner() error = %v, want %s", err, client.CodeApprovalRequired)
+	}
+
+	change, err := c.CreateChangeRequest(ctx, banner.ID, draft.Version, "New title")
+	if err != nil {
+		t.Fatalf("CreateChangeRequest() error = %v", err)
+	}
+	if _, err := c.ApproveChangeRequest(ctx, change.ID, ""); !client.IsStatus(err, http.StatusForbidden) {
+		t.Fatalf("ApproveChangeRequest() by the author error = %v, want 403", err)
+	}
+	pending, err := c.ListChangeRequests(ctx, client.ChangeRequestOptions{Status: client.ChangeRequestPending})
+	if err != nil || len(pending) != 1 || pending[0].ID != change.ID {
+		t.Fatalf("ListChangeRequests() = %+v, %v", pending, err)
+	}
+
+	reviewer, err := client.New(s.URL, client.WithCredentials(reviewerName, adminPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	approved, err := reviewer.ApproveChangeRequest(ctx, change.ID, "OK")
+	if err != nil {
+		t.Fatalf("ApproveChangeRequest() error = %v", err)
+	}
+	if approved.Status != client.ChangeRequestApproved || approved.Reviewer != reviewerName || approved.Author != adminName {
+		t.Fatalf("approved change request = %+v", approved)
+	}
+	if published, err := c.GetBanner(ctx, banner.ID); err != nil || published.HasDraft || published.Content["title"] != "New" {
+		t.Fatalf("GetBanner() after approval = %+v, %v", published, err)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Error codes of the service, in Error.Code.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeVersionMismatch      = "version_mismatch"
+	CodePreconditionRequired = "precondition_required"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeApprovalRequired     = "approval_required"
+	CodeInternal             = "internal_error"
+)
+
+// Error is an error response of the service (RFC 7807 problem details).
+type Error struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors"`
+	// CurrentVersion is the version of the banner when a change was
+	// refused because it was based on an older one.
+	CurrentVersion *int64 `json:"current_version"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, field := range e.Errors {
+		msg += fmt.Sprintf("; %s: %s", field.Field, field.Message)
+	}
+
+	return msg
+}
+
+// IsStatus reports whether err is an error response with the given HTTP
+// status.
+func IsStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+func IsNotFound(err error) bool {
+	return IsStatus(err, http.StatusNotFound)
+}
+
+// readError reads an error response. Bodies that are not problem details
+// keep the status and the start of the body as the detail.
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	apiErr := &Error{}
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Status == 0 {
+		apiErr = &Error{Detail: string(data[:min(len(data), 200)])}
+	}
+	apiErr.Status = resp.StatusCode
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const headerIdempotencyKey = "Idempotency-Key"
+
+// RetryPolicy says how failed requests are retried. A request is retried if
+// it could not be sent or got 429, 502, 503 or 504, and a create also while
+// the service is still handling its previous attempt. Updates and deletes
+// carry the banner version, so a retry of one that did succeed fails with
+// 412 instead of applying twice.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first one; 1
+	// disables retries.
+	MaxAttempts int
+	// MinBackoff is the longest wait before the first retry; it doubles
+	// with each next one up to MaxBackoff. The waits are random within
+	// these bounds, unless the service asks for one with Retry-After.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// WithRetry sets the retry policy instead of DefaultRetryPolicy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// next reports whether the attempt should be retried and after how long.
+func (p RetryPolicy) next(attempt int, req request, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if err != nil {
+		// The context is done, so another attempt would fail as well.
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	case http.StatusConflict:
+		// A conflict with Retry-After means the request with this
+		// Idempotency-Key is still in progress.
+		if req.header.Get(headerIdempotencyKey) == "" || resp.Header.Get("Retry-After") == "" {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return p.backoff(attempt), true
+}
+
+// backoff returns a random wait up to the exponential bound ("full
+// jitter"), so clients that failed together do not retry together.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.MinBackoff
+	for i := 1; i < attempt && bound < p.MaxBackoff; i++ {
+		bound *= 2
+	}
+	bound = min(bound, p.MaxBackoff)
+	if bound <= 0 {
+		return 0
+	}
+
+	return rand.N(bound + 1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	crand.Read(key)
+
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+type User struct {
+	ID   int    `json:"user_id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Login gets a token for the user and authorizes the next requests with it.
+func (c *Client) Login(ctx context.Context, name, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: loginPath, body: credentials{name, password}}, &resp)
+	if err != nil {
+		return err
+	}
+
+	c.SetToken(resp.Token)
+
+	return nil
+}
+
+// CreateUser registers a user with the regular role.
+func (c *Client) CreateUser(ctx context.Context, name, password string) (*User, error) {
+	var user User
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/users", body: credentials{name, password}}, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+const loginPath = "/login"
+
+func (c *Client) canLogin() bool {
+	return c.name != ""
+}
+
+// renewToken logs in with the credentials of the client unless the token
+// has changed from stale since, i.e. a concurrent request renewed it.
+func (c *Client) renewToken(ctx context.Context, stale string) error {
+	_, err, _ := c.logins.Do("", func() (any, error) {
+		if c.Token() != stale {
+			return nil, nil
+		}
+		return nil, c.Login(ctx, c.name, c.password)
+	})
+
+	return err
+}
+
+type credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}